@@ -2,33 +2,68 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"github.com/aylei/kubectl-debug/pkg/agent"
-	"log"
+	"k8s.io/klog"
 	"os"
 )
 
 func main() {
 
-	var configFile string
+	var configFile, listenAddress, verifyAudit, verifyKeyFile string
+	var authorization bool
 	flag.StringVar(&configFile, "config.file", "", "Config file location.")
+	flag.StringVar(&listenAddress, "listen.address", "", "Address to listen on, overrides listen_address of the config file.")
+	flag.BoolVar(&authorization, "authorization", false, "Authorize the debug requests, overrides authorization of the config file.")
+	flag.StringVar(&verifyAudit, "verify.audit", "", "Verify the chain of the audit file and exit.")
+	flag.StringVar(&verifyKeyFile, "verify.key-file", "", "The audit_key_file of the agent which wrote the audit file verified by -verify.audit.")
+	// -v sets the verbosity of the logs, which go to stderr
+	klog.InitFlags(nil)
 	flag.Parse()
+	defer klog.Flush()
+
+	if len(verifyAudit) > 0 {
+		if len(verifyKeyFile) < 1 {
+			fmt.Fprintln(os.Stderr, "-verify.audit requires -verify.key-file")
+			os.Exit(1)
+		}
+		key, err := agent.ReadAuditKey(verifyKeyFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		chain, err := agent.VerifyAuditFile(verifyAudit, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "audit file %s is broken after %d records: %v\n", verifyAudit, chain.Records, err)
+			os.Exit(1)
+		}
+		// records removed from the end only show against the last record of the webhook
+		fmt.Printf("audit file %s is intact, %d records, the last is record %d with hash %s\n", verifyAudit, chain.Records, chain.LastSequence, chain.LastHash)
+		return
+	}
 
 	config, err := agent.LoadFile(configFile)
 	if err != nil {
-		log.Fatalf("error reading config %v", err)
+		klog.Fatalf("error reading config %v", err)
 		os.Exit(1)
 	}
+	if len(listenAddress) > 0 {
+		config.ListenAddress = listenAddress
+	}
+	if authorization {
+		config.Authorization = true
+	}
 
 	server, err := agent.NewServer(config)
 	if err != nil {
-		log.Fatal(err)
+		klog.Fatal(err)
 		os.Exit(1)
 	}
 
 	if err := server.Run(); err != nil {
-		log.Fatal(err)
+		klog.Fatal(err)
 		os.Exit(1)
 	}
 
-	log.Println("sever stopped, see you next time!")
+	klog.Info("sever stopped, see you next time!")
 }
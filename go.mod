@@ -4,17 +4,22 @@ go 1.13
 
 require (
 	github.com/Nvveen/Gotty v0.0.0-20120604004816-cd527374f1e5
+	github.com/docker/distribution v0.0.0-20170726174610-edc3ab29cdff
 	github.com/docker/docker v0.7.3-0.20190327010347-be7ac8be2ae0
 	github.com/docker/go-units v0.3.3
+	github.com/prometheus/client_golang v0.9.2
 	github.com/spf13/cobra v0.0.0-20180319062004-c439c4fa0937
 	github.com/spf13/pflag v1.0.1
+	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
 	golang.org/x/sys v0.0.0-20190312061237-fead79001313
 	gopkg.in/yaml.v2 v2.2.1
 	k8s.io/api v0.0.0
 	k8s.io/apimachinery v0.0.0
 	k8s.io/cli-runtime v0.0.0
 	k8s.io/client-go v0.0.0
+	k8s.io/klog v0.3.1
 	k8s.io/kubernetes v1.15.0
+	k8s.io/utils v0.0.0-20190221042446-c2654d5206da
 )
 
 replace (
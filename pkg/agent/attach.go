@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// outputWatcher tells whether the debug container has written anything yet,
+// which bounds the attach timeout
+type outputWatcher struct {
+	once sync.Once
+	seen chan struct{}
+}
+
+func newOutputWatcher() *outputWatcher {
+	return &outputWatcher{seen: make(chan struct{})}
+}
+
+// Wrap returns a writer marking the output as seen on its first write
+func (w *outputWatcher) Wrap(wc io.WriteCloser) io.WriteCloser {
+	return &watchedWriter{WriteCloser: wc, watcher: w}
+}
+
+// Seen returns true once the debug container has written anything
+func (w *outputWatcher) Seen() bool {
+	select {
+	case <-w.seen:
+		return true
+	default:
+		return false
+	}
+}
+
+type watchedWriter struct {
+	io.WriteCloser
+	watcher *outputWatcher
+}
+
+func (w *watchedWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.watcher.once.Do(func() { close(w.watcher.seen) })
+	}
+	return w.WriteCloser.Write(p)
+}
+
+// activityWatcher records the last time anything went through the streams of the
+// session, which bounds the session idle timeout of the agent
+type activityWatcher struct {
+	// lastActivity is the unix nano timestamp of the last read or write
+	lastActivity int64
+}
+
+func newActivityWatcher() *activityWatcher {
+	return &activityWatcher{lastActivity: time.Now().UnixNano()}
+}
+
+func (w *activityWatcher) touch() {
+	atomic.StoreInt64(&w.lastActivity, time.Now().UnixNano())
+}
+
+// Idle returns how long the streams have been idle
+func (w *activityWatcher) Idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&w.lastActivity)))
+}
+
+// WrapReader returns a reader recording activity on every read
+func (w *activityWatcher) WrapReader(r io.Reader) io.Reader {
+	return &activityReader{Reader: r, watcher: w}
+}
+
+// WrapWriter returns a writer recording activity on every write
+func (w *activityWatcher) WrapWriter(wc io.WriteCloser) io.WriteCloser {
+	return &activityWriter{WriteCloser: wc, watcher: w}
+}
+
+type activityReader struct {
+	io.Reader
+	watcher *activityWatcher
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.watcher.touch()
+	}
+	return n, err
+}
+
+type activityWriter struct {
+	io.WriteCloser
+	watcher *activityWatcher
+}
+
+func (w *activityWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.watcher.touch()
+	}
+	return w.WriteCloser.Write(p)
+}
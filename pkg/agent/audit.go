@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aylei/kubectl-debug/pkg/util"
+	"io/ioutil"
+	"k8s.io/klog"
+	"os"
+	"sync"
+	"time"
+)
+
+// the events of the audit records
+const (
+	auditRefused = "refused"
+	auditStarted = "started"
+	auditEnded   = "ended"
+)
+
+// AuditRecord is a line of the audit log of the agent, every record holds the hmac of the
+// previous line of the log, so that a modified, inserted or removed record breaks the chain
+type AuditRecord struct {
+	Sequence uint64    `json:"sequence"`
+	Time     time.Time `json:"time"`
+	// Event is refused for a request denied by the authorization, started once the debug
+	// container runs, and ended once the session is over, including sessions which failed
+	Event string `json:"event"`
+	User  string `json:"user,omitempty"`
+	// UserVerified is set if the user was authenticated by the authorization of the agent,
+	// the user is the one claimed by the client otherwise
+	UserVerified      bool       `json:"userVerified"`
+	ClientAddress     string     `json:"clientAddress,omitempty"`
+	Node              string     `json:"node,omitempty"`
+	Namespace         string     `json:"namespace,omitempty"`
+	Pod               string     `json:"pod,omitempty"`
+	Container         string     `json:"container,omitempty"`
+	TargetContainerID string     `json:"targetContainerID,omitempty"`
+	Runtime           string     `json:"runtime,omitempty"`
+	Image             string     `json:"image,omitempty"`
+	Command           []string   `json:"command,omitempty"`
+	ContainerID       string     `json:"containerID,omitempty"`
+	StartTime         *time.Time `json:"startTime,omitempty"`
+	EndTime           *time.Time `json:"endTime,omitempty"`
+	ExitCode          *int       `json:"exitCode,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	PreviousHash      string     `json:"previousHash"`
+}
+
+// auditor appends the audit records to the audit file and posts them to the webhook
+type auditor struct {
+	mu       sync.Mutex
+	file     string
+	webhook  string
+	node     string
+	key      []byte
+	sequence uint64
+	// lastHash is the hmac of the last record written
+	lastHash string
+}
+
+// AuditChain is the end of a verified audit file, compare it with the last record
+// received by the webhook to detect records removed from the end of the file
+type AuditChain struct {
+	Records      int
+	LastSequence uint64
+	LastHash     string
+}
+
+// newAuditor returns the auditor of the config, or nil if auditing is disabled, the chain
+// of an existing audit file is continued
+func newAuditor(config *Config) (*auditor, error) {
+	if len(config.AuditFile) < 1 && len(config.AuditWebhook) < 1 {
+		return nil, nil
+	}
+	node, _ := os.Hostname()
+	a := &auditor{file: config.AuditFile, webhook: config.AuditWebhook, node: node}
+	if len(a.file) > 0 {
+		// an unkeyed hash would let whoever may write the file rewrite the whole chain
+		if len(config.AuditKeyFile) < 1 {
+			return nil, fmt.Errorf("audit_file requires audit_key_file")
+		}
+		key, err := ReadAuditKey(config.AuditKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		a.key = key
+		last, err := lastLine(a.file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error reading audit file %s: %v", a.file, err)
+		}
+		if len(last) > 0 {
+			var record AuditRecord
+			if err := json.Unmarshal(last, &record); err != nil {
+				return nil, fmt.Errorf("error parsing the last record of audit file %s: %v", a.file, err)
+			}
+			a.sequence = record.Sequence
+			a.lastHash = auditHash(a.key, last)
+		}
+	}
+	return a, nil
+}
+
+// write chains and writes the record, an agent which cannot write its audit file
+// keeps serving, so the failure is logged as an error and the record is still posted
+func (a *auditor) write(record *AuditRecord) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	record.Time = time.Now()
+	record.Node = a.node
+	record.Sequence = a.sequence + 1
+	record.PreviousHash = a.lastHash
+	line, err := json.Marshal(record)
+	if err != nil {
+		klog.Errorf("error encoding audit record: %v", err)
+		return
+	}
+	if len(a.file) > 0 {
+		// the chain goes on past a record missing from the file, whose verification then
+		// points at the gap the webhook holds the record of
+		if err := term.AppendAuditFile(a.file, line); err != nil {
+			klog.Errorf("error writing audit record %d to %s: %v", record.Sequence, a.file, err)
+		}
+	}
+	a.sequence = record.Sequence
+	a.lastHash = auditHash(a.key, line)
+	if len(a.webhook) > 0 {
+		// the webhook orders the records by their sequence, the posts may overtake each other
+		sequence, hash := record.Sequence, a.lastHash
+		go func() {
+			if err := term.PostAuditWebhook(a.webhook, line, hash); err != nil {
+				klog.Errorf("error posting audit record %d: %v", sequence, err)
+			}
+		}()
+	}
+}
+
+// auditHash is the hmac-sha256 of the line, or its sha256 without a key, which only
+// happens without an audit file
+func auditHash(key, line []byte) string {
+	if len(key) < 1 {
+		sum := sha256.Sum256(line)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(line)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ReadAuditKey reads the hmac key of the audit chain, the key itself is never logged
+func ReadAuditKey(filename string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error reading audit key file %s: %v", filename, err)
+	}
+	key := bytes.TrimSpace(content)
+	if len(key) < 1 {
+		return nil, fmt.Errorf("audit key file %s is empty", filename)
+	}
+	return key, nil
+}
+
+func lastLine(filename string) ([]byte, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var last []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	return last, scanner.Err()
+}
+
+// VerifyAuditFile checks the chain of the audit file with the key of the agent and returns
+// its end, the first record may continue a previous, e.g. rotated, file
+func VerifyAuditFile(filename string, key []byte) (AuditChain, error) {
+	var chain AuditChain
+	file, err := os.Open(filename)
+	if err != nil {
+		return chain, err
+	}
+	defer file.Close()
+	var previous AuditRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		// blank lines are skipped like the agent does when it continues the chain
+		if len(scanner.Bytes()) < 1 {
+			continue
+		}
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return chain, fmt.Errorf("line %d: invalid audit record: %v", line, err)
+		}
+		if chain.Records > 0 {
+			if record.Sequence != previous.Sequence+1 {
+				return chain, fmt.Errorf("line %d: record %d follows record %d, records are missing", line, record.Sequence, previous.Sequence)
+			}
+			if !hmac.Equal([]byte(record.PreviousHash), []byte(chain.LastHash)) {
+				return chain, fmt.Errorf("line %d: record %d does not chain to record %d, the log was modified or the key is wrong", line, record.Sequence, previous.Sequence)
+			}
+		}
+		previous = record
+		chain.Records++
+		chain.LastSequence, chain.LastHash = record.Sequence, auditHash(key, scanner.Bytes())
+	}
+	return chain, scanner.Err()
+}
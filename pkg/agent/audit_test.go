@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aylei/kubectl-debug/pkg/util"
+)
+
+func newTestAuditor(t *testing.T, dir, webhook string) *auditor {
+	keyFile := filepath.Join(dir, "audit.key")
+	if err := ioutil.WriteFile(keyFile, []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newAuditor(&Config{AuditFile: filepath.Join(dir, "audit.log"), AuditKeyFile: keyFile, AuditWebhook: webhook})
+	if err != nil {
+		t.Fatalf("error creating the auditor: %v", err)
+	}
+	return a
+}
+
+func TestAuditFileRequiresKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := newAuditor(&Config{AuditFile: filepath.Join(dir, "audit.log")}); err == nil {
+		t.Errorf("got no error for an audit file without a key")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "empty.key"), []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newAuditor(&Config{AuditFile: filepath.Join(dir, "audit.log"), AuditKeyFile: filepath.Join(dir, "empty.key")}); err == nil {
+		t.Errorf("got no error for an empty key")
+	}
+}
+
+func TestVerifyAuditFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := newTestAuditor(t, dir, "")
+	for _, pod := range []string{"web", "db", "cache"} {
+		a.write(&AuditRecord{Event: auditStarted, Pod: pod})
+	}
+	filename := filepath.Join(dir, "audit.log")
+
+	chain, err := VerifyAuditFile(filename, []byte("s3cr3t"))
+	if err != nil {
+		t.Fatalf("error verifying the audit file: %v", err)
+	}
+	if chain.Records != 3 || chain.LastSequence != 3 || chain.LastHash != a.lastHash {
+		t.Errorf("got chain %+v, want 3 records ending with %s", chain, a.lastHash)
+	}
+
+	// a blank line between the records and a trailing one, e.g. left by an editor
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	blank := append(append(append([]byte{}, lines[0]...), '\n'), bytes.Join(lines[1:], nil)...)
+	if err := ioutil.WriteFile(filename, append(blank, '\n'), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if chain, err := VerifyAuditFile(filename, []byte("s3cr3t")); err != nil || chain.Records != 3 {
+		t.Errorf("got chain %+v and error %v with blank lines, want 3 records", chain, err)
+	}
+	a = newTestAuditor(t, dir, "")
+	if a.sequence != 3 || a.lastHash != chain.LastHash {
+		t.Errorf("got the chain continued at record %d with hash %s, want record 3 with %s", a.sequence, a.lastHash, chain.LastHash)
+	}
+
+	// whoever rewrites the chain without the key does not get it verified
+	if _, err := VerifyAuditFile(filename, []byte("guessed")); err == nil {
+		t.Errorf("got no error verifying with the wrong key")
+	}
+	content, err = ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := bytes.Replace(content, []byte(`"pod":"db"`), []byte(`"pod":"xx"`), 1)
+	if err := ioutil.WriteFile(filename, modified, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAuditFile(filename, []byte("s3cr3t")); err == nil || !strings.Contains(err.Error(), "modified") {
+		t.Errorf("got error %v verifying a modified record", err)
+	}
+}
+
+func TestAuditRecordPostedWhenFileWriteFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	type post struct {
+		record AuditRecord
+		hash   string
+	}
+	posts := make(chan post, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var record AuditRecord
+		if err := json.NewDecoder(req.Body).Decode(&record); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		posts <- post{record: record, hash: req.Header.Get(term.AuditHashHeader)}
+	}))
+	defer webhook.Close()
+	a := newTestAuditor(t, dir, webhook.URL)
+	// the audit file cannot be created in a missing directory
+	a.file = filepath.Join(dir, "missing", "audit.log")
+
+	a.write(&AuditRecord{Event: auditEnded, Pod: "web"})
+	select {
+	case p := <-posts:
+		if p.record.Pod != "web" || p.record.Sequence != 1 {
+			t.Errorf("got posted record %+v, want record 1 of web", p.record)
+		}
+		if p.hash != a.lastHash {
+			t.Errorf("got posted hash %q, want %q", p.hash, a.lastHash)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the record was not posted")
+	}
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"fmt"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"net/http"
+	"strings"
+)
+
+// serviceAccountTokenFile is the token of the agent, which authenticates it to the other agents
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// authorizer gates the requests on the rbac of the requesting user, the bearer token of
+// the request is authenticated by a TokenReview, then the user must be allowed to create
+// the configured subresource of the target pod of a debug request, or to access the
+// subresource of the nodes for the other apis, by a SubjectAccessReview
+type authorizer struct {
+	client      kubernetes.Interface
+	subresource string
+}
+
+func newAuthorizer(subresource string) (*authorizer, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("authorization requires to run in the cluster: %v", err)
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &authorizer{client: client, subresource: subresource}, nil
+}
+
+// authorizationError carries the http status the request is refused with
+type authorizationError struct {
+	status  int
+	message string
+}
+
+func (e *authorizationError) Error() string {
+	return e.message
+}
+
+// authenticate returns the user of the bearer token of the request
+func (a *authorizer) authenticate(req *http.Request) (*authenticationv1.UserInfo, error) {
+	header := req.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, &authorizationError{status: http.StatusUnauthorized,
+			message: "the agent requires a bearer token, client certificates cannot be verified by the agent"}
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: strings.TrimPrefix(header, "Bearer ")},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reviewing token: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, &authorizationError{status: http.StatusUnauthorized, message: "invalid bearer token"}
+	}
+	return &review.Status.User, nil
+}
+
+// authorize checks that the user may debug the container of the pod, or the node if the
+// pod is empty, and returns the authenticated user name
+func (a *authorizer) authorize(req *http.Request, namespace, pod, containerId string) (string, error) {
+	user, err := a.authenticate(req)
+	if err != nil {
+		return "", err
+	}
+	attributes := &authorizationv1.ResourceAttributes{
+		Namespace:   namespace,
+		Verb:        "create",
+		Resource:    "pods",
+		Subresource: a.subresource,
+		Name:        pod,
+	}
+	if len(pod) < 1 {
+		// a standalone debug container on the node is as powerful as the node proxy
+		attributes = &authorizationv1.ResourceAttributes{Verb: "create", Resource: "nodes", Subresource: "proxy"}
+	}
+	what := attributes.Resource + "/" + attributes.Subresource
+	if len(pod) > 0 {
+		what += fmt.Sprintf(" of pod %s in namespace %s", pod, namespace)
+	}
+	if err := a.review(user, attributes, what); err != nil {
+		return "", err
+	}
+	if len(containerId) > 0 {
+		// the pod is given by the client, make sure the container is actually part of it
+		if err := a.checkContainer(namespace, pod, containerId); err != nil {
+			return "", err
+		}
+	}
+	return user.Username, nil
+}
+
+// authorizeNode checks that the user may access the subresource of the nodes, with the
+// verb of the http method like the kubelet does, and returns the authenticated user name
+func (a *authorizer) authorizeNode(req *http.Request, subresource string) (string, error) {
+	user, err := a.authenticate(req)
+	if err != nil {
+		return "", err
+	}
+	attributes := &authorizationv1.ResourceAttributes{Verb: methodVerb(req.Method), Resource: "nodes", Subresource: subresource}
+	if err := a.review(user, attributes, "nodes/"+subresource); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+// review checks the attributes for the user with a SubjectAccessReview, what describes
+// the resource in the error of a denied access
+func (a *authorizer) review(user *authenticationv1.UserInfo, attributes *authorizationv1.ResourceAttributes, what string) error {
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: attributes,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              extra,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error reviewing access: %v", err)
+	}
+	if !review.Status.Allowed {
+		message := fmt.Sprintf("user %s cannot %s %s", user.Username, attributes.Verb, what)
+		if len(review.Status.Reason) > 0 {
+			message += ": " + review.Status.Reason
+		}
+		return &authorizationError{status: http.StatusForbidden, message: message}
+	}
+	return nil
+}
+
+// methodVerb maps the http method to the verb of the access review
+func methodVerb(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	}
+	return "get"
+}
+
+func (a *authorizer) checkContainer(namespace, pod, containerId string) error {
+	p, err := a.client.CoreV1().Pods(namespace).Get(pod, v1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("error getting pod %s: %v", pod, err)
+	}
+	for _, status := range p.Status.ContainerStatuses {
+		if status.ContainerID == containerId {
+			return nil
+		}
+	}
+	return &authorizationError{status: http.StatusForbidden,
+		message: fmt.Sprintf("container %s does not belong to pod %s in namespace %s", containerId, pod, namespace)}
+}
+
+// writeAuthorizationError writes the error with its status, or 500 for a failed review
+func writeAuthorizationError(w http.ResponseWriter, err error) {
+	if e, ok := err.(*authorizationError); ok {
+		http.Error(w, e.message, e.status)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
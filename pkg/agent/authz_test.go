@@ -0,0 +1,84 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newFakeAuthorizer authenticates the token "valid" as alice, who may only access
+// the allowed subresource of the nodes
+func newFakeAuthorizer(allowed string) (*authorizer, *[]authorizationv1.ResourceAttributes) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "valid" {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "alice"}}
+		}
+		return true, review, nil
+	})
+	var reviewed []authorizationv1.ResourceAttributes
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		reviewed = append(reviewed, *attributes)
+		review.Status.Allowed = review.Spec.User == "alice" && attributes.Resource == "nodes" && attributes.Subresource == allowed
+		return true, review, nil
+	})
+	return &authorizer{client: client, subresource: "exec"}, &reviewed
+}
+
+func TestAuthorizedRoutes(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		subresource string
+		allowed     string
+		wantStatus  int
+	}{
+		{name: "allowed", token: "valid", subresource: "proxy", allowed: "proxy", wantStatus: http.StatusOK},
+		{name: "no token", subresource: "proxy", allowed: "proxy", wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", token: "forged", subresource: "proxy", allowed: "proxy", wantStatus: http.StatusUnauthorized},
+		{name: "denied", token: "valid", subresource: "metrics", allowed: "proxy", wantStatus: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		authorizer, reviewed := newFakeAuthorizer(test.allowed)
+		s := &Server{authorizer: authorizer}
+		handler := s.authorized(test.subresource, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("sessions"))
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil)
+		if len(test.token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		if recorder.Code != test.wantStatus {
+			t.Errorf("%s: got status %d, want %d: %s", test.name, recorder.Code, test.wantStatus, recorder.Body.String())
+		}
+		if test.wantStatus == http.StatusOK {
+			if len(*reviewed) != 1 || (*reviewed)[0].Verb != "get" {
+				t.Errorf("%s: got access reviews %+v, want a single get", test.name, *reviewed)
+			}
+		}
+	}
+}
+
+func TestAuthorizedWithoutAuthorization(t *testing.T) {
+	s := &Server{}
+	handler := s.authorized("proxy", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("sessions"))
+	}))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("got status %d without authorization, want %d", recorder.Code, http.StatusOK)
+	}
+}
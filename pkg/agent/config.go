@@ -8,12 +8,30 @@ import (
 
 var (
 	DefaultConfig = Config{
-		DockerEndpoint:        "unix:///var/run/docker.sock",
+		DockerEndpoint:        defaultDockerEndpoint,
 		DockerTimeout:         30 * time.Second,
 		StreamIdleTimeout:     10 * time.Minute,
 		StreamCreationTimeout: 15 * time.Second,
+		GCInterval:            10 * time.Minute,
+
+		CtrPath:             "ctr",
+		ContainerdEndpoint:  defaultContainerdEndpoint,
+		ContainerdNamespace: "k8s.io",
+
+		CrictlPath:   "crictl",
+		CrioEndpoint: "/var/run/crio/crio.sock",
 
 		ListenAddress: "0.0.0.0:10027",
+		LogsDir:       defaultLogsDir,
+		LogsTTL:       time.Hour,
+		ResolvConfDir: defaultResolvConfDir,
+		LxcfsPath:     "/var/lib/lxcfs",
+
+		// cgroup-parent moves the debug container out of the cgroup of the pod and past the
+		// max_cpu and max_memory caps, so it must be allowed explicitly
+		AllowedRuntimeArgs: []string{"user", "workdir", "shm-size", "cap-drop"},
+
+		AuthorizationSubresource: "exec",
 	}
 )
 
@@ -22,8 +40,65 @@ type Config struct {
 	DockerTimeout         time.Duration `yaml:"docker_timeout,omitempty"`
 	StreamIdleTimeout     time.Duration `yaml:"stream_idle_timeout,omitempty"`
 	StreamCreationTimeout time.Duration `yaml:"stream_creation_timeout,omitempty"`
+	// SessionIdleTimeout and MaxSessionDuration reap the debug sessions without any input
+	// or output for this long, or running for this long, zero means no limit
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout,omitempty"`
+	MaxSessionDuration time.Duration `yaml:"max_session_duration,omitempty"`
+	// GCInterval is how often the orphaned debug containers, e.g. of sessions whose
+	// connection broke, are removed, zero disables it
+	GCInterval time.Duration `yaml:"gc_interval,omitempty"`
+
+	// CtrPath is the ctr cli of containerd, which runs the debug containers of containerd targets
+	CtrPath            string `yaml:"ctr_path,omitempty"`
+	ContainerdEndpoint string `yaml:"containerd_endpoint,omitempty"`
+	// ContainerdNamespace is the containerd namespace of the kubelet, which holds the target containers
+	ContainerdNamespace string `yaml:"containerd_namespace,omitempty"`
+
+	// CrictlPath is the crictl cli, which runs the debug containers of cri-o targets
+	CrictlPath   string `yaml:"crictl_path,omitempty"`
+	CrioEndpoint string `yaml:"crio_endpoint,omitempty"`
+
+	// RegistryConfig is a docker config.json, e.g. the one of the node mounted in the agent,
+	// whose credentials are used to pull the debug images when the client sends none
+	RegistryConfig string `yaml:"registry_config,omitempty"`
 
 	ListenAddress string `yaml:"listen_address,omitempty"`
+	// LogsDir keeps the logs of debug containers until the client fetches them
+	LogsDir string `yaml:"logs_dir,omitempty"`
+	// LogsTTL is how long the logs which the client never fetched are kept, they are
+	// removed by the sweeper of GCInterval
+	LogsTTL time.Duration `yaml:"logs_ttl,omitempty"`
+	// ResolvConfDir keeps the resolv.conf of debug containers with custom dns servers,
+	// it must be a host path mounted at the same path in the agent
+	ResolvConfDir string `yaml:"resolv_conf_dir,omitempty"`
+	// LxcfsPath is the mount point of lxcfs on the node, mounted at the same path in the agent,
+	// whose /proc files are mounted in the debug containers with Lxcfs or on request of the client
+	LxcfsPath string `yaml:"lxcfs_path,omitempty"`
+	Lxcfs     bool   `yaml:"lxcfs,omitempty"`
+
+	// DefaultCPU and DefaultMemory limit the debug containers when the client asks for
+	// no limit, MaxCPU and MaxMemory cap the limits clients ask for, e.g. 500m and 256Mi,
+	// empty means unlimited
+	DefaultCPU    string `yaml:"default_cpu,omitempty"`
+	DefaultMemory string `yaml:"default_memory,omitempty"`
+	MaxCPU        string `yaml:"max_cpu,omitempty"`
+	MaxMemory     string `yaml:"max_memory,omitempty"`
+
+	// AuditFile and AuditWebhook receive a json record of every debug request, of the
+	// refused ones and of every session when it starts and ends, empty disables them
+	AuditFile    string `yaml:"audit_file,omitempty"`
+	AuditWebhook string `yaml:"audit_webhook,omitempty"`
+	// AuditKeyFile holds the hmac key chaining the records of the audit file, it is required
+	// with AuditFile and must not be writable by whoever may write the audit file
+	AuditKeyFile string `yaml:"audit_key_file,omitempty"`
+
+	// AllowedRuntimeArgs are the keys of --runtime-arg which users may pass
+	AllowedRuntimeArgs []string `yaml:"allowed_runtime_args,omitempty"`
+
+	// Authorization only allows the debug requests of users who may create AuthorizationSubresource
+	// of the target pod, e.g. exec or a dedicated debug subresource, checked by a SubjectAccessReview
+	Authorization            bool   `yaml:"authorization,omitempty"`
+	AuthorizationSubresource string `yaml:"authorization_subresource,omitempty"`
 }
 
 func Load(s string) (*Config, error) {
@@ -37,12 +112,17 @@ func Load(s string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := cfg.validateLimits(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
 func LoadFile(filename string) (*Config, error) {
 	if len(filename) < 1 {
-		return &DefaultConfig, nil
+		// a copy, as the flags of the agent override the loaded config
+		c := DefaultConfig
+		return &c, nil
 	}
 	c, err := ioutil.ReadFile(filename)
 	if err != nil {
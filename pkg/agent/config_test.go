@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"testing"
+)
+
+func TestLoadFileWithoutFileCopiesDefaults(t *testing.T) {
+	config, err := LoadFile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listenAddress := DefaultConfig.ListenAddress
+	config.ListenAddress, config.Authorization = "127.0.0.1:10028", true
+
+	if DefaultConfig.ListenAddress != listenAddress || DefaultConfig.Authorization {
+		t.Errorf("overriding the loaded config changed the defaults to %s and authorization %v", DefaultConfig.ListenAddress, DefaultConfig.Authorization)
+	}
+	loaded, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ListenAddress != listenAddress {
+		t.Errorf("got listen address %s after overriding an earlier config, want %s", loaded.ListenAddress, listenAddress)
+	}
+}
@@ -0,0 +1,10 @@
+// +build !windows
+
+package agent
+
+const (
+	defaultDockerEndpoint     = "unix:///var/run/docker.sock"
+	defaultContainerdEndpoint = "/run/containerd/containerd.sock"
+	defaultLogsDir            = "/tmp/kubectl-debug/logs"
+	defaultResolvConfDir      = "/var/lib/kubectl-debug/resolv"
+)
@@ -0,0 +1,8 @@
+package agent
+
+const (
+	defaultDockerEndpoint     = "npipe:////./pipe/docker_engine"
+	defaultContainerdEndpoint = `\\.\pipe\containerd-containerd`
+	defaultLogsDir            = `C:\ProgramData\kubectl-debug\logs`
+	defaultResolvConfDir      = `C:\ProgramData\kubectl-debug\resolv`
+)
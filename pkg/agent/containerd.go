@@ -0,0 +1,274 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog"
+	"os/exec"
+	"strings"
+)
+
+const (
+	runtimeContainerd = "containerd"
+
+	// containerdDebugNamespace keeps the debug containers and their images apart
+	// from those of the kubelet, which owns the target containers
+	containerdDebugNamespace = "kubectl-debug"
+)
+
+// containerdRuntime runs the debug container on containerd with its ctr cli,
+// the target container is found in the namespace of the kubelet and joined
+// through the namespaces of its init process
+type containerdRuntime struct {
+	attacher *DebugAttacher
+
+	// cliProcess is the `ctr run` process of the debug container, which lives as long as the container
+	cliProcess
+}
+
+// ctr returns the ctr command talking to the containerd of the node in the given namespace
+func (c *containerdRuntime) ctr(ctx context.Context, namespace string, args ...string) *exec.Cmd {
+	m := c.attacher.runtime
+	args = append([]string{"--address", m.containerdEndpoint, "--namespace", namespace}, args...)
+	return exec.CommandContext(ctx, m.ctrPath, args...)
+}
+
+// output runs the ctr command and returns its stdout, with its stderr in the error
+func (c *containerdRuntime) output(ctx context.Context, namespace string, args ...string) (string, error) {
+	cmd := c.ctr(ctx, namespace, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ctr %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+func (c *containerdRuntime) PullImage(image string, tty bool, stdout io.Writer) error {
+	ref, err := normalizeImage(image)
+	if err != nil {
+		return err
+	}
+	args := []string{"images", "pull"}
+	auth := c.attacher.config.RegistryAuth
+	if auth != nil {
+		// the password is typed into the prompt of ctr, see promptPassword
+		args = append(args, "--user", auth.Username)
+	}
+	// image pull can be time consuming, just pass the request context
+	cmd := c.ctr(c.attacher.context, containerdDebugNamespace, append(args, ref)...)
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if auth != nil {
+		closeConsole, err := promptPassword(cmd, auth.Password)
+		if err != nil {
+			return fmt.Errorf("error pulling image %s: %v", ref, err)
+		}
+		defer closeConsole()
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error pulling image %s: %v: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// promptPassword answers the password prompt of ctr, which reads the password from its
+// console when --user has none, so that the password stays out of the argv of ctr, which
+// any process of the node can read. The console is a pty given as the stdin of cmd, the
+// returned func closes it and must be called once cmd exited
+func promptPassword(cmd *exec.Cmd, password string) (func(), error) {
+	master, slave, err := openPty()
+	if err != nil {
+		return nil, fmt.Errorf("cannot allocate the console of the password prompt: %v", err)
+	}
+	// the line discipline keeps the password until ctr reads it, the echo is discarded
+	if _, err := master.Write([]byte(password + "\n")); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, fmt.Errorf("cannot write the password prompt: %v", err)
+	}
+	go io.Copy(ioutil.Discard, master)
+	cmd.Stdin = slave
+	return func() {
+		slave.Close()
+		master.Close()
+	}, nil
+}
+
+// targetPid returns the host pid of the init process of the target container
+func (c *containerdRuntime) targetPid(targetId string) (string, error) {
+	ctx, cancel := c.attacher.getContextWithTimeout()
+	defer cancel()
+	out, err := c.output(ctx, c.attacher.runtime.containerdNamespace, "tasks", "ls")
+	if err != nil {
+		return "", err
+	}
+	// TASK PID STATUS
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[0] == targetId {
+			if fields[2] != "RUNNING" {
+				return "", fmt.Errorf("target container %s is %s", targetId, strings.ToLower(fields[2]))
+			}
+			return fields[1], nil
+		}
+	}
+	return "", fmt.Errorf("target container %s not found in containerd namespace %s", targetId, c.attacher.runtime.containerdNamespace)
+}
+
+// volumeBinds returns the bind mounts of the requested volumes, found in the spec of the target container
+func (c *containerdRuntime) volumeBinds(targetId string) ([]volumeBind, error) {
+	ctx, cancel := c.attacher.getContextWithTimeout()
+	defer cancel()
+	out, err := c.output(ctx, c.attacher.runtime.containerdNamespace, "containers", "info", "--spec", targetId)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Mounts []ociMount `json:"mounts"`
+	}
+	if err := json.Unmarshal([]byte(out), &spec); err != nil {
+		return nil, fmt.Errorf("error parsing spec of target container %s: %v", targetId, err)
+	}
+	return volumeBinds(c.attacher.config.Volumes, ociBinds(spec.Mounts))
+}
+
+// RunDebugContainer starts the debug container, which joins the network, ipc and pid
+// namespaces of the given container, or the network and pid namespaces of the host
+// if no container is given
+func (c *containerdRuntime) RunDebugContainer(targetId string, image string, command []string, tty bool) (string, error) {
+	config := c.attacher.config
+	if len(config.RuntimeArgs) > 0 {
+		return "", fmt.Errorf("runtime args are not supported on containerd")
+	}
+	if len(config.LogsSession) > 0 {
+		return "", fmt.Errorf("saving the logs of the debug container is not supported on containerd")
+	}
+	ref, err := normalizeImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"run"}
+	resolvConf := c.attacher.resolvConf
+	if len(targetId) > 0 {
+		pid, err := c.targetPid(targetId)
+		if err != nil {
+			return "", err
+		}
+		for _, ns := range []string{"network:net", "ipc:ipc", "pid:pid"} {
+			parts := strings.SplitN(ns, ":", 2)
+			args = append(args, "--with-ns", fmt.Sprintf("%s:/proc/%s/ns/%s", parts[0], pid, parts[1]))
+		}
+		if len(resolvConf) < 1 {
+			// ctr does not manage the resolv.conf, inherit the one of the target container
+			resolvConf = fmt.Sprintf("/proc/%s/root%s", pid, resolvConfPath)
+		}
+		if len(config.Volumes) > 0 {
+			binds, err := c.volumeBinds(targetId)
+			if err != nil {
+				return "", err
+			}
+			for _, bind := range binds {
+				args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=%s", bind.source, bind.destination, bind.bindOptions()))
+			}
+		}
+	} else {
+		// standalone debug container, share the network and pid namespaces of the node
+		args = append(args, "--net-host", "--with-ns", "pid:/proc/1/ns/pid")
+	}
+	if len(resolvConf) > 0 {
+		args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=rbind:ro", resolvConf, resolvConfPath))
+	}
+	// the debug container keeps a cgroup of its own on containerd, so lxcfs reports its limits
+	for _, mount := range c.attacher.lxcfsMounts {
+		args = append(args, "--mount", fmt.Sprintf("type=bind,src=%s,dst=%s,options=rbind:ro", mount.source, mount.destination))
+	}
+	for _, env := range config.Env {
+		args = append(args, "--env", env)
+	}
+	if config.Limits.MilliCPU > 0 {
+		args = append(args, "--cpus", fmt.Sprintf("%.3f", float64(config.Limits.MilliCPU)/1000))
+	}
+	if config.Limits.Memory > 0 {
+		args = append(args, "--memory-limit", fmt.Sprintf("%d", config.Limits.Memory))
+	}
+	if tty {
+		args = append(args, "--tty")
+	}
+	for key, value := range c.attacher.debugLabels(targetId, "") {
+		args = append(args, "--label", key+"="+value)
+	}
+	id := "kubectl-debug-" + rand.String(16)
+	args = append(args, ref, id)
+	args = append(args, command...)
+	args = append(args, config.Args...)
+
+	// the ctr process must outlive the request context, the debug container
+	// is killed explicitly instead, otherwise its task would be left running
+	if err := c.start(c.ctr(context.Background(), containerdDebugNamespace, args...), tty); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// AttachToContainer pipes the streams to the ctr process of the debug container until it exits
+func (c *containerdRuntime) AttachToContainer(id string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	return c.attach(id, stdin, stdout, stderr, tty, resize)
+}
+
+// ExitCode returns the exit code of the debug container, which is the one of `ctr run`
+func (c *containerdRuntime) ExitCode(id string) (int, error) {
+	if c.cmd.ProcessState == nil {
+		return 0, fmt.Errorf("container %s has not exited", id)
+	}
+	return c.cmd.ProcessState.ExitCode(), nil
+}
+
+// KillContainer kills the debug container, which ends the attached session
+func (c *containerdRuntime) KillContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.attacher.runtime.timeout)
+	defer cancel()
+	if _, err := c.output(ctx, containerdDebugNamespace, "tasks", "kill", "--signal", "SIGKILL", id); err != nil {
+		klog.Errorf("error killing container %s: %v", id, err)
+	}
+}
+
+func (c *containerdRuntime) CleanContainer(id string) {
+	if !c.exited() {
+		// the session ended before the debug container exited
+		c.KillContainer(id)
+		c.cmd.Wait()
+	}
+	if c.attacher.config.Retain {
+		klog.Infof("Debug session end, debug container %s retained", id)
+		return
+	}
+	// cleanup procedure should use background context
+	ctx, cancel := context.WithTimeout(context.Background(), c.attacher.runtime.timeout)
+	defer cancel()
+	if _, err := c.output(ctx, containerdDebugNamespace, "containers", "rm", id); err != nil {
+		klog.Errorf("error remove container: %s: %v", id, err)
+	} else {
+		klog.Infof("Debug session end, debug container %s removed", id)
+	}
+}
+
+// normalizeImage returns the fully qualified reference of the image, e.g.
+// docker.io/library/busybox:latest for busybox, which is required by ctr
+func normalizeImage(image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %q: %v", image, err)
+	}
+	return reference.TagNameOnly(named).String(), nil
+}
@@ -0,0 +1,62 @@
+// +build linux
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeCtr records its args and the password typed into its console, which must be a tty
+const fakeCtr = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+test -t 0 || { echo "stdin is not a console" >&2; exit 1; }
+read -r password
+echo "$password" > "$(dirname "$0")/password"
+`
+
+func TestContainerdPullKeepsThePasswordOutOfArgv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ctr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctr := filepath.Join(dir, "ctr")
+	if err := ioutil.WriteFile(ctr, []byte(fakeCtr), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := &containerdRuntime{attacher: &DebugAttacher{
+		runtime: &RuntimeManager{ctrPath: ctr, containerdEndpoint: "/run/containerd/containerd.sock"},
+		config:  &DebugConfig{RegistryAuth: &types.AuthConfig{Username: "robot", Password: "s3cr3t pass"}},
+		context: context.Background(),
+	}}
+
+	var out bytes.Buffer
+	if err := c.PullImage("registry.example.com/tools/netshoot:v1", false, &out); err != nil {
+		t.Fatalf("error pulling: %v", err)
+	}
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(args), "s3cr3t") {
+		t.Errorf("the password is on the argv of ctr: %s", args)
+	}
+	if !strings.Contains(string(args), "--user robot registry.example.com/tools/netshoot:v1") {
+		t.Errorf("got ctr args %q, want the user and the image", args)
+	}
+	password, err := ioutil.ReadFile(filepath.Join(dir, "password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(password)); got != "s3cr3t pass" {
+		t.Errorf("ctr read the password %q from its console, want %q", got, "s3cr3t pass")
+	}
+}
@@ -0,0 +1,392 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	runtimeCrio = "cri-o"
+
+	// namespace modes of the CRI api
+	criNamespaceNode   = 2
+	criNamespaceTarget = 3
+)
+
+// crioRuntime runs the debug container on CRI-O with the crictl cli, in the pod
+// sandbox of the target container, whose pid namespace it targets. A standalone
+// debug container runs in a sandbox of its own on the network and pid namespaces of the node
+type crioRuntime struct {
+	attacher *DebugAttacher
+	// sandboxId is the sandbox created for a standalone debug container, removed with it
+	sandboxId string
+
+	// cliProcess is the `crictl attach` process of the debug container
+	cliProcess
+}
+
+// criNamespaceOptions, criContainerConfig and criSandboxConfig are the subsets of
+// the CRI configs which crictl reads from the files passed to `crictl create` and `crictl runp`
+type criNamespaceOptions struct {
+	Network  int    `json:"network,omitempty"`
+	Pid      int    `json:"pid,omitempty"`
+	Ipc      int    `json:"ipc,omitempty"`
+	TargetId string `json:"target_id,omitempty"`
+}
+
+type criMetadata struct {
+	Name      string `json:"name"`
+	Uid       string `json:"uid,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	Attempt   uint32 `json:"attempt,omitempty"`
+}
+
+type criKeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type criMount struct {
+	ContainerPath string `json:"container_path"`
+	HostPath      string `json:"host_path"`
+	Readonly      bool   `json:"readonly"`
+}
+
+type criResources struct {
+	CpuPeriod          int64 `json:"cpu_period,omitempty"`
+	CpuQuota           int64 `json:"cpu_quota,omitempty"`
+	MemoryLimitInBytes int64 `json:"memory_limit_in_bytes,omitempty"`
+}
+
+type criLinuxConfig struct {
+	Resources       *criResources `json:"resources,omitempty"`
+	SecurityContext struct {
+		NamespaceOptions criNamespaceOptions `json:"namespace_options"`
+	} `json:"security_context"`
+}
+
+type criContainerConfig struct {
+	Metadata criMetadata `json:"metadata"`
+	Image    struct {
+		Image string `json:"image"`
+	} `json:"image"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Command   []string          `json:"command,omitempty"`
+	Args      []string          `json:"args,omitempty"`
+	Envs      []criKeyValue     `json:"envs,omitempty"`
+	Mounts    []criMount        `json:"mounts,omitempty"`
+	LogPath   string            `json:"log_path,omitempty"`
+	Stdin     bool              `json:"stdin"`
+	StdinOnce bool              `json:"stdin_once"`
+	Tty       bool              `json:"tty"`
+	Linux     criLinuxConfig    `json:"linux"`
+}
+
+type criSandboxConfig struct {
+	Metadata criMetadata       `json:"metadata"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Linux    criLinuxConfig    `json:"linux"`
+}
+
+// criInspect is the output of `crictl inspect` and `crictl inspectp`, info is filled by CRI-O
+type criInspect struct {
+	Status struct {
+		State    string      `json:"state"`
+		ExitCode int         `json:"exitCode"`
+		Metadata criMetadata `json:"metadata"`
+	} `json:"status"`
+	Info struct {
+		SandboxId   string `json:"sandboxID"`
+		RuntimeSpec struct {
+			Mounts []ociMount `json:"mounts"`
+		} `json:"runtimeSpec"`
+	} `json:"info"`
+}
+
+// crictl returns the crictl command talking to the CRI-O of the node
+func (c *crioRuntime) crictl(ctx context.Context, args ...string) *exec.Cmd {
+	m := c.attacher.runtime
+	endpoint := "unix://" + m.crioEndpoint
+	args = append([]string{"--runtime-endpoint", endpoint, "--image-endpoint", endpoint}, args...)
+	return exec.CommandContext(ctx, m.crictlPath, args...)
+}
+
+// output runs the crictl command and returns its stdout, with its stderr in the error
+func (c *crioRuntime) output(ctx context.Context, args ...string) (string, error) {
+	cmd := c.crictl(ctx, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("crictl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// inspect returns the status of the container, or of the sandbox with inspectp
+func (c *crioRuntime) inspect(ctx context.Context, command string, id string) (*criInspect, error) {
+	out, err := c.output(ctx, command, "-o", "json", id)
+	if err != nil {
+		return nil, err
+	}
+	status := &criInspect{}
+	if err := json.Unmarshal([]byte(out), status); err != nil {
+		return nil, fmt.Errorf("error parsing crictl %s %s: %v", command, id, err)
+	}
+	return status, nil
+}
+
+// writeConfig writes the config to a temporary file for crictl, which must be removed by the caller
+func writeConfig(config interface{}) (string, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", "kubectl-debug-cri-")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+func (c *crioRuntime) PullImage(image string, tty bool, stdout io.Writer) error {
+	args := []string{"pull"}
+	if auth := c.attacher.config.RegistryAuth; auth != nil {
+		args = append(args, "--creds", auth.Username+":"+auth.Password)
+	}
+	// image pull can be time consuming, just pass the request context
+	cmd := c.crictl(c.attacher.context, append(args, image)...)
+	cmd.Stdout = stdout
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error pulling image %s: %v: %s", image, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// runSandbox starts a sandbox for a standalone debug container on the network and pid namespaces of the node
+func (c *crioRuntime) runSandbox(ctx context.Context, name string) (*criSandboxConfig, error) {
+	sandbox := &criSandboxConfig{
+		Metadata: criMetadata{Name: name, Uid: name, Namespace: "kubectl-debug"},
+		Labels:   map[string]string{debugLabel: "true"},
+	}
+	sandbox.Linux.SecurityContext.NamespaceOptions = criNamespaceOptions{Network: criNamespaceNode, Pid: criNamespaceNode}
+	sandboxFile, err := writeConfig(sandbox)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(sandboxFile)
+	if c.sandboxId, err = c.output(ctx, "runp", sandboxFile); err != nil {
+		return nil, err
+	}
+	return sandbox, nil
+}
+
+// RunDebugContainer starts the debug container in the sandbox of the given container,
+// which shares its network and ipc namespaces, and joins the pid namespace of the
+// container, or in a sandbox on the network and pid namespaces of the host if no container is given
+func (c *crioRuntime) RunDebugContainer(targetId string, image string, command []string, tty bool) (string, error) {
+	config := c.attacher.config
+	if len(config.RuntimeArgs) > 0 {
+		return "", fmt.Errorf("runtime args are not supported on cri-o")
+	}
+	if len(config.LogsSession) > 0 {
+		return "", fmt.Errorf("saving the logs of the debug container is not supported on cri-o")
+	}
+	ctx, cancel := c.attacher.getContextWithTimeout()
+	defer cancel()
+
+	name := "kubectl-debug-" + rand.String(16)
+	container := &criContainerConfig{
+		Metadata:  criMetadata{Name: name},
+		Command:   command,
+		Args:      config.Args,
+		LogPath:   name + ".log",
+		Stdin:     true,
+		StdinOnce: true,
+		Tty:       tty,
+	}
+	container.Image.Image = image
+	if limits := config.Limits; limits.MilliCPU > 0 || limits.Memory > 0 {
+		container.Linux.Resources = &criResources{MemoryLimitInBytes: limits.Memory}
+		if limits.MilliCPU > 0 {
+			container.Linux.Resources.CpuPeriod = cpuPeriod
+			container.Linux.Resources.CpuQuota = limits.CPUQuota()
+		}
+	}
+	for _, env := range config.Env {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) < 2 {
+			parts = append(parts, "")
+		}
+		container.Envs = append(container.Envs, criKeyValue{Key: parts[0], Value: parts[1]})
+	}
+	if len(c.attacher.resolvConf) > 0 {
+		// the resolv.conf of the sandbox is used otherwise
+		container.Mounts = append(container.Mounts, criMount{ContainerPath: resolvConfPath, HostPath: c.attacher.resolvConf, Readonly: true})
+	}
+	// the cgroup of the debug container is under the one of the sandbox, so lxcfs reports the limits of the pod
+	for _, mount := range c.attacher.lxcfsMounts {
+		container.Mounts = append(container.Mounts, criMount{ContainerPath: mount.destination, HostPath: mount.source, Readonly: true})
+	}
+
+	var sandbox *criSandboxConfig
+	var sandboxId string
+	if len(targetId) > 0 {
+		target, err := c.inspect(ctx, "inspect", targetId)
+		if err != nil {
+			return "", err
+		}
+		if target.Status.State != "CONTAINER_RUNNING" {
+			return "", fmt.Errorf("target container %s is %s", targetId, strings.ToLower(strings.TrimPrefix(target.Status.State, "CONTAINER_")))
+		}
+		sandboxId = target.Info.SandboxId
+		if len(sandboxId) < 1 {
+			return "", fmt.Errorf("sandbox of target container %s not found in the output of crictl inspect", targetId)
+		}
+		pod, err := c.inspect(ctx, "inspectp", sandboxId)
+		if err != nil {
+			return "", err
+		}
+		sandbox = &criSandboxConfig{Metadata: pod.Status.Metadata}
+		container.Labels = c.attacher.debugLabels(targetId, "")
+		binds, err := volumeBinds(config.Volumes, ociBinds(target.Info.RuntimeSpec.Mounts))
+		if err != nil {
+			return "", err
+		}
+		for _, bind := range binds {
+			container.Mounts = append(container.Mounts, criMount{ContainerPath: bind.destination, HostPath: bind.source, Readonly: bind.readOnly})
+		}
+		// network and ipc are shared by the sandbox, the pid namespace is the one of the target
+		container.Linux.SecurityContext.NamespaceOptions = criNamespaceOptions{Pid: criNamespaceTarget, TargetId: targetId}
+	} else {
+		var err error
+		if sandbox, err = c.runSandbox(ctx, name); err != nil {
+			return "", err
+		}
+		sandboxId = c.sandboxId
+		// the sandbox is removed along with an orphaned debug container
+		container.Labels = c.attacher.debugLabels(targetId, sandboxId)
+		container.Linux.SecurityContext.NamespaceOptions = criNamespaceOptions{Network: criNamespaceNode, Pid: criNamespaceNode}
+	}
+
+	containerFile, err := writeConfig(container)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(containerFile)
+	sandboxFile, err := writeConfig(sandbox)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(sandboxFile)
+	id, err := c.output(ctx, "create", sandboxId, containerFile, sandboxFile)
+	if err != nil {
+		c.removeSandbox()
+		return "", err
+	}
+	if _, err := c.output(ctx, "start", id); err != nil {
+		c.removeContainer(id)
+		return "", err
+	}
+
+	args := []string{"attach", "--stdin"}
+	if tty {
+		args = append(args, "--tty")
+	}
+	// the crictl process must outlive the request context, the debug container
+	// is stopped explicitly instead
+	if err := c.start(c.crictl(context.Background(), append(args, id)...), tty); err != nil {
+		c.KillContainer(id)
+		c.removeContainer(id)
+		return "", err
+	}
+	return id, nil
+}
+
+// AttachToContainer pipes the streams to the crictl process attached to the debug container until it exits
+func (c *crioRuntime) AttachToContainer(id string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	return c.attach(id, stdin, stdout, stderr, tty, resize)
+}
+
+// ExitCode returns the exit code of the debug container as reported by CRI-O
+func (c *crioRuntime) ExitCode(id string) (int, error) {
+	ctx, cancel := c.attacher.getContextWithTimeout()
+	defer cancel()
+	status, err := c.inspect(ctx, "inspect", id)
+	if err != nil {
+		return 0, err
+	}
+	if status.Status.State != "CONTAINER_EXITED" {
+		return 0, fmt.Errorf("container %s has not exited", id)
+	}
+	return status.Status.ExitCode, nil
+}
+
+// KillContainer stops the debug container without grace period, which ends the attached session
+func (c *crioRuntime) KillContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.attacher.runtime.timeout)
+	defer cancel()
+	if _, err := c.output(ctx, "stop", "--timeout", "0", id); err != nil {
+		klog.Errorf("error killing container %s: %v", id, err)
+	}
+}
+
+func (c *crioRuntime) CleanContainer(id string) {
+	if !c.exited() {
+		// the session ended before the debug container exited
+		c.KillContainer(id)
+		c.cmd.Wait()
+	}
+	if c.attacher.config.Retain {
+		klog.Infof("Debug session end, debug container %s retained", id)
+		return
+	}
+	if err := c.removeContainer(id); err != nil {
+		klog.Errorf("error remove container: %s: %v", id, err)
+	} else {
+		klog.Infof("Debug session end, debug container %s removed", id)
+	}
+}
+
+// removeContainer removes the debug container along with the sandbox of a standalone debug container
+func (c *crioRuntime) removeContainer(id string) error {
+	// cleanup procedure should use background context
+	ctx, cancel := context.WithTimeout(context.Background(), c.attacher.runtime.timeout)
+	defer cancel()
+	_, err := c.output(ctx, "rm", "--force", id)
+	c.removeSandbox()
+	return err
+}
+
+// removeSandbox stops and removes the sandbox of a standalone debug container, if any
+func (c *crioRuntime) removeSandbox() {
+	if len(c.sandboxId) < 1 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.attacher.runtime.timeout)
+	defer cancel()
+	if _, err := c.output(ctx, "stopp", c.sandboxId); err != nil {
+		klog.Errorf("error stopping sandbox %s: %v", c.sandboxId, err)
+		return
+	}
+	if _, err := c.output(ctx, "rmp", c.sandboxId); err != nil {
+		klog.Errorf("error removing sandbox %s: %v", c.sandboxId, err)
+	}
+}
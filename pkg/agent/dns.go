@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// resolvConfPath is where the custom resolv.conf is mounted in the debug container
+const resolvConfPath = "/etc/resolv.conf"
+
+var dnsSearchPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*\.?$`)
+
+// validateDNS checks the nameservers and search domains of a debug request
+func validateDNS(servers, searches []string) error {
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid dns server %q, must be an ip address", server)
+		}
+	}
+	for _, search := range searches {
+		if !dnsSearchPattern.MatchString(search) {
+			return fmt.Errorf("invalid dns search domain %q", search)
+		}
+	}
+	if len(searches) > 0 && len(servers) < 1 {
+		return fmt.Errorf("dns search domains require at least one dns server")
+	}
+	return nil
+}
+
+// writeResolvConf writes the resolv.conf of the debug container to the resolv.conf dir,
+// which must be a host path mounted at the same path in the agent, so that docker
+// can bind mount it. Nothing is written and the path is empty if no dns server is set.
+func (m *DebugAttacher) writeResolvConf() (string, error) {
+	if len(m.config.DNSServers) < 1 {
+		return "", nil
+	}
+	if err := os.MkdirAll(m.runtime.resolvConfDir, 0755); err != nil {
+		return "", err
+	}
+	file, err := ioutil.TempFile(m.runtime.resolvConfDir, "resolv-*.conf")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	var content strings.Builder
+	for _, server := range m.config.DNSServers {
+		content.WriteString("nameserver " + server + "\n")
+	}
+	if len(m.config.DNSSearches) > 0 {
+		content.WriteString("search " + strings.Join(m.config.DNSSearches, " ") + "\n")
+	}
+	if _, err := file.WriteString(content.String()); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	// the debug container may run as any user
+	if err := file.Chmod(0644); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,339 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	dockerclient "github.com/docker/docker/client"
+	"io/ioutil"
+	"k8s.io/klog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// debugLabel marks the containers created by the agent, which the sweeper may remove
+	debugLabel = "kubectl-debug"
+	// targetLabel is the id of the target container, empty for standalone debug containers
+	targetLabel = "kubectl-debug/target"
+	// retainLabel marks the debug containers retained after their session
+	retainLabel = "kubectl-debug/retain"
+	// sandboxLabel is the sandbox created for a standalone debug container on cri-o
+	sandboxLabel = "kubectl-debug/sandbox"
+	// agentLabel is the port of the agent serving the session, several agents may
+	// run on a node, e.g. the DaemonSet and a temporary one of --agentless
+	agentLabel = "kubectl-debug/agent-port"
+
+	// orphanMinAge spares the debug containers which are just starting, whose
+	// session is registered only once they run
+	orphanMinAge = time.Minute
+)
+
+// debugLabels returns the labels of a debug container
+func (m *DebugAttacher) debugLabels(targetId string, sandboxId string) map[string]string {
+	labels := map[string]string{debugLabel: "true", targetLabel: targetId, agentLabel: m.runtime.agentPort}
+	if m.config.Retain {
+		labels[retainLabel] = "true"
+	}
+	if len(sandboxId) > 0 {
+		labels[sandboxLabel] = sandboxId
+	}
+	return labels
+}
+
+// debugContainer is a debug container found by the sweeper
+type debugContainer struct {
+	id      string
+	labels  map[string]string
+	created time.Time
+}
+
+// orphanSweeper lists and removes the debug containers of one runtime
+type orphanSweeper interface {
+	name() string
+	list(ctx context.Context) ([]debugContainer, error)
+	// exists tells whether the target container still exists
+	exists(ctx context.Context, id string) (bool, error)
+	remove(ctx context.Context, container debugContainer) error
+}
+
+// RunSweeper removes the orphaned debug containers at every interval until stop is closed:
+// those without an active session, unless retained, and the retained ones whose target
+// container is gone. Only the runtimes whose socket is found are swept. The logs which
+// were never fetched are expired along
+func (m *RuntimeManager) RunSweeper(interval time.Duration, stop <-chan struct{}) {
+	var sweepers []orphanSweeper
+	if socketExists(strings.TrimPrefix(m.dockerEndpoint, "unix://")) {
+		sweepers = append(sweepers, &dockerSweeper{client: m.client})
+	}
+	if socketExists(m.containerdEndpoint) {
+		sweepers = append(sweepers, &containerdSweeper{runtime: &containerdRuntime{attacher: &DebugAttacher{runtime: m}}})
+	}
+	if socketExists(m.crioEndpoint) {
+		sweepers = append(sweepers, &crioSweeper{runtime: &crioRuntime{attacher: &DebugAttacher{runtime: m}}})
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for _, sweeper := range sweepers {
+			m.sweep(sweeper)
+		}
+		m.expireLogs()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *RuntimeManager) sweep(sweeper orphanSweeper) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	containers, err := sweeper.list(ctx)
+	if err != nil {
+		klog.Errorf("error listing debug containers on %s: %v", sweeper.name(), err)
+		runtimeErrors.WithLabelValues(sweeper.name(), "list").Inc()
+		return
+	}
+	// the active sessions by agent port, nil if the agent is not running
+	sessions := map[string]map[string]bool{m.agentPort: activeSessions(m.sessions.List())}
+	// unknown are the ports of the agents whose sessions cannot be listed
+	unknown := map[string]bool{}
+	for _, container := range containers {
+		if time.Since(container.created) < orphanMinAge {
+			continue
+		}
+		port := container.labels[agentLabel]
+		if len(port) < 1 {
+			port = m.agentPort
+		}
+		if _, ok := sessions[port]; !ok {
+			active, err := m.agentSessions(port)
+			if err != nil {
+				klog.Errorf("error listing the sessions of the agent on port %s, skipping its debug containers: %v", port, err)
+				unknown[port] = true
+			}
+			sessions[port] = active
+		}
+		if unknown[port] || sessions[port][container.id] {
+			continue
+		}
+		if container.labels[retainLabel] == "true" {
+			target := container.labels[targetLabel]
+			if len(target) < 1 {
+				continue
+			}
+			if exists, err := sweeper.exists(ctx, target); err != nil || exists {
+				if err != nil {
+					klog.Errorf("error checking target container %s on %s: %v", target, sweeper.name(), err)
+				}
+				continue
+			}
+		}
+		if err := sweeper.remove(ctx, container); err != nil {
+			klog.Errorf("error removing orphaned debug container %s on %s: %v", container.id, sweeper.name(), err)
+			runtimeErrors.WithLabelValues(sweeper.name(), "remove").Inc()
+			continue
+		}
+		klog.Infof("removed orphaned debug container %s on %s", container.id, sweeper.name())
+	}
+}
+
+func activeSessions(sessions []Session) map[string]bool {
+	active := map[string]bool{}
+	for _, session := range sessions {
+		active[session.ContainerID] = true
+	}
+	return active
+}
+
+// agentSessions returns the active sessions of another agent on the node, listening on
+// the host network like this one, or nil if it is not running anymore, which is only
+// assumed if it refuses the connection. Any other error, e.g. a timeout of a busy agent
+// or a refused authorization, is returned, and its debug containers are left alone
+func (m *RuntimeManager) agentSessions(port string) (map[string]bool, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%s/api/v1/sessions", port), nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.authorization {
+		token, err := ioutil.ReadFile(serviceAccountTokenFile)
+		if err != nil {
+			klog.Errorf("error reading the service account token to query the agent on port %s: %v", port, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			klog.V(2).Infof("agent on port %s is not running, its debug containers are orphans: %v", port, err)
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent responded with status %s", resp.Status)
+	}
+	var sessions []Session
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("cannot decode the sessions: %v", err)
+	}
+	return activeSessions(sessions), nil
+}
+
+func socketExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+type dockerSweeper struct {
+	client *dockerclient.Client
+}
+
+func (s *dockerSweeper) name() string {
+	return runtimeDocker
+}
+
+func (s *dockerSweeper) list(ctx context.Context) ([]debugContainer, error) {
+	list, err := s.client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", debugLabel+"=true")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var containers []debugContainer
+	for _, c := range list {
+		containers = append(containers, debugContainer{id: c.ID, labels: c.Labels, created: time.Unix(c.Created, 0)})
+	}
+	return containers, nil
+}
+
+func (s *dockerSweeper) exists(ctx context.Context, id string) (bool, error) {
+	_, err := s.client.ContainerInspect(ctx, id)
+	if dockerclient.IsErrNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *dockerSweeper) remove(ctx context.Context, container debugContainer) error {
+	return s.client.ContainerRemove(ctx, container.id, types.ContainerRemoveOptions{Force: true})
+}
+
+// containerdSweeper sweeps the containerd namespace of the debug containers, which
+// holds nothing else
+type containerdSweeper struct {
+	runtime *containerdRuntime
+}
+
+func (s *containerdSweeper) name() string {
+	return runtimeContainerd
+}
+
+func (s *containerdSweeper) list(ctx context.Context) ([]debugContainer, error) {
+	out, err := s.runtime.output(ctx, containerdDebugNamespace, "containers", "ls", "--quiet")
+	if err != nil {
+		return nil, err
+	}
+	var containers []debugContainer
+	for _, id := range strings.Fields(out) {
+		info, err := s.runtime.output(ctx, containerdDebugNamespace, "containers", "info", id)
+		if err != nil {
+			// removed meanwhile
+			continue
+		}
+		var container struct {
+			Labels    map[string]string
+			CreatedAt time.Time
+		}
+		if err := json.Unmarshal([]byte(info), &container); err != nil {
+			return nil, fmt.Errorf("error parsing container info of %s: %v", id, err)
+		}
+		containers = append(containers, debugContainer{id: id, labels: container.Labels, created: container.CreatedAt})
+	}
+	return containers, nil
+}
+
+func (s *containerdSweeper) exists(ctx context.Context, id string) (bool, error) {
+	_, err := s.runtime.output(ctx, s.runtime.attacher.runtime.containerdNamespace, "containers", "info", id)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *containerdSweeper) remove(ctx context.Context, container debugContainer) error {
+	// the task of an orphan may still run, it is gone already otherwise
+	s.runtime.output(ctx, containerdDebugNamespace, "tasks", "rm", "--force", container.id)
+	_, err := s.runtime.output(ctx, containerdDebugNamespace, "containers", "rm", container.id)
+	return err
+}
+
+type crioSweeper struct {
+	runtime *crioRuntime
+}
+
+func (s *crioSweeper) name() string {
+	return runtimeCrio
+}
+
+func (s *crioSweeper) list(ctx context.Context) ([]debugContainer, error) {
+	out, err := s.runtime.output(ctx, "ps", "--all", "--label", debugLabel+"=true", "-o", "json")
+	if err != nil {
+		return nil, err
+	}
+	var list struct {
+		Containers []struct {
+			Id        string            `json:"id"`
+			Labels    map[string]string `json:"labels"`
+			CreatedAt string            `json:"createdAt"`
+		} `json:"containers"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, fmt.Errorf("error parsing crictl ps: %v", err)
+	}
+	var containers []debugContainer
+	for _, c := range list.Containers {
+		// nanoseconds since the epoch
+		created, err := strconv.ParseInt(c.CreatedAt, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing creation time of %s: %v", c.Id, err)
+		}
+		containers = append(containers, debugContainer{id: c.Id, labels: c.Labels, created: time.Unix(0, created)})
+	}
+	return containers, nil
+}
+
+func (s *crioSweeper) exists(ctx context.Context, id string) (bool, error) {
+	_, err := s.runtime.output(ctx, "inspect", id)
+	if err != nil && strings.Contains(err.Error(), "not found") {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *crioSweeper) remove(ctx context.Context, container debugContainer) error {
+	s.runtime.sandboxId = container.labels[sandboxLabel]
+	return s.runtime.removeContainer(container.id)
+}
+
+// agentPort returns the port of the listen address
+func agentPort(listenAddress string) string {
+	_, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return listenAddress
+	}
+	return port
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fakeSweeper holds debug containers and records the removed ones
+type fakeSweeper struct {
+	containers []debugContainer
+	removed    []string
+}
+
+func (s *fakeSweeper) name() string { return "fake" }
+
+func (s *fakeSweeper) list(ctx context.Context) ([]debugContainer, error) {
+	return s.containers, nil
+}
+
+func (s *fakeSweeper) exists(ctx context.Context, id string) (bool, error) {
+	return true, nil
+}
+
+func (s *fakeSweeper) remove(ctx context.Context, container debugContainer) error {
+	s.removed = append(s.removed, container.id)
+	return nil
+}
+
+func serverPort(t *testing.T, server *httptest.Server) string {
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Port()
+}
+
+// refusedPort returns a port nothing listens on
+func refusedPort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+	return port
+}
+
+// TestSweepOnlyTreatsRefusedAgentsAsGone sweeps the debug containers of a running agent,
+// a stopped one, and agents which cannot list their sessions
+func TestSweepOnlyTreatsRefusedAgentsAsGone(t *testing.T) {
+	running := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`[{"containerID":"active"}]`))
+	}))
+	defer running.Close()
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "the agent requires a bearer token", http.StatusUnauthorized)
+	}))
+	defer unauthorized.Close()
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`not json`))
+	}))
+	defer broken.Close()
+
+	created := time.Now().Add(-time.Hour)
+	container := func(id, port string) debugContainer {
+		return debugContainer{id: id, created: created, labels: map[string]string{debugLabel: "true", agentLabel: port}}
+	}
+	stopped := refusedPort(t)
+	sweeper := &fakeSweeper{containers: []debugContainer{
+		container("active", serverPort(t, running)),
+		container("orphan", serverPort(t, running)),
+		container("stopped", stopped),
+		container("unauthorized", serverPort(t, unauthorized)),
+		container("broken", serverPort(t, broken)),
+	}}
+	m := &RuntimeManager{timeout: 10 * time.Second, sessions: NewSessionManager(), agentPort: "10027"}
+
+	m.sweep(sweeper)
+	sort.Strings(sweeper.removed)
+	want := []string{"orphan", "stopped"}
+	if len(sweeper.removed) != len(want) || sweeper.removed[0] != want[0] || sweeper.removed[1] != want[1] {
+		t.Errorf("removed %q, want %q", sweeper.removed, want)
+	}
+}
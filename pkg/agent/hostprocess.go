@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+const (
+	runtimeHostProcess = "host-process"
+
+	// hostProcessWindowsMessage explains why a target container cannot be joined on windows
+	hostProcessWindowsMessage = "windows containers cannot share their namespaces with a debug container, " +
+		"only the node can be debugged on windows, with --no-join or node/NAME"
+)
+
+// hostProcessRuntime runs the debug command as a process of the agent instead of in a
+// debug container, on windows nodes, where the agent runs as a HostProcess container
+// with the network and the file system of the node. There is no image, the tools of
+// the node are used, and no pty, the streams are piped
+type hostProcessRuntime struct {
+	attacher *DebugAttacher
+
+	cliProcess
+}
+
+func (c *hostProcessRuntime) PullImage(image string, tty bool, stdout io.Writer) error {
+	return nil
+}
+
+func (c *hostProcessRuntime) RunDebugContainer(targetId string, image string, command []string, tty bool) (string, error) {
+	config := c.attacher.config
+	switch {
+	case len(targetId) > 0:
+		return "", fmt.Errorf("cannot join target container %s: %s", targetId, hostProcessWindowsMessage)
+	case len(config.RuntimeArgs) > 0:
+		return "", fmt.Errorf("runtime args are not supported for host processes")
+	case len(config.LogsSession) > 0:
+		return "", fmt.Errorf("saving the logs of the debug container is not supported for host processes")
+	case len(config.DNSServers) > 0 || len(config.DNSSearches) > 0:
+		return "", fmt.Errorf("dns servers and searches are not supported for host processes, they use the dns of the node")
+	case config.Limits.MilliCPU > 0 || config.Limits.Memory > 0:
+		return "", fmt.Errorf("resource limits are not supported for host processes")
+	case len(command) < 1:
+		return "", fmt.Errorf("the command of a host process must be specified")
+	}
+	args := append(append([]string{}, command[1:]...), config.Args...)
+	// the process must outlive the request context, it is killed explicitly instead
+	cmd := exec.CommandContext(context.Background(), command[0], args...)
+	cmd.Env = append(os.Environ(), config.Env...)
+	if err := c.start(cmd, false); err != nil {
+		return "", err
+	}
+	id := "kubectl-debug-" + rand.String(16)
+	klog.Infof("started host process %d for debug session %s", cmd.Process.Pid, id)
+	return id, nil
+}
+
+// AttachToContainer pipes the streams to the process until it exits, with a tty the client
+// only opens stdout, which the stderr of the process goes to as well
+func (c *hostProcessRuntime) AttachToContainer(id string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	if resize != nil {
+		// there is no pty to resize
+		go func() {
+			for range resize {
+			}
+		}()
+	}
+	if stderr == nil && stdout != nil {
+		shared := &lockedWriter{WriteCloser: stdout}
+		stdout, stderr = shared, shared
+	}
+	return c.attach(id, stdin, stdout, stderr, false, nil)
+}
+
+func (c *hostProcessRuntime) ExitCode(id string) (int, error) {
+	if c.cmd.ProcessState == nil {
+		return 0, fmt.Errorf("host process of %s has not exited", id)
+	}
+	return c.cmd.ProcessState.ExitCode(), nil
+}
+
+func (c *hostProcessRuntime) KillContainer(id string) {
+	if err := c.cmd.Process.Kill(); err != nil {
+		klog.Errorf("error killing host process of %s: %v", id, err)
+	}
+}
+
+func (c *hostProcessRuntime) CleanContainer(id string) {
+	if !c.exited() {
+		// the session ended before the process exited
+		c.KillContainer(id)
+		c.cmd.Wait()
+	}
+	klog.Infof("Debug session end, host process of %s exited", id)
+}
+
+// lockedWriter serializes the writes of stdout and stderr to the same stream
+type lockedWriter struct {
+	sync.Mutex
+	io.WriteCloser
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+	return w.WriteCloser.Write(p)
+}
@@ -0,0 +1,88 @@
+package agent
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// cpuPeriod is the cfs period the cpu limit is enforced over, in microseconds
+const cpuPeriod = 100000
+
+// ResourceLimits are the cgroup limits of the debug container, zero means unlimited
+type ResourceLimits struct {
+	// MilliCPU is the cpu limit in thousandths of a cpu
+	MilliCPU int64
+	// Memory is the memory limit in bytes
+	Memory int64
+}
+
+// CPUQuota returns the cfs quota over cpuPeriod matching the cpu limit
+func (l ResourceLimits) CPUQuota() int64 {
+	return l.MilliCPU * cpuPeriod / 1000
+}
+
+// parseLimit parses a quantity, e.g. 500m or 1Gi, into its milli value for cpu
+// or its value for memory, an empty quantity is zero
+func parseLimit(name string, value string, milli bool) (int64, error) {
+	if len(value) < 1 {
+		return 0, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	if quantity.Sign() < 0 {
+		return 0, fmt.Errorf("invalid %s %q, must not be negative", name, value)
+	}
+	if milli {
+		return quantity.MilliValue(), nil
+	}
+	return quantity.Value(), nil
+}
+
+// resourceLimits returns the limits of the debug container, the requested ones or
+// the defaults of the agent config, refused if they exceed the maximums of the config
+func resourceLimits(cpu, memory string, config *Config) (ResourceLimits, error) {
+	if len(cpu) < 1 {
+		cpu = config.DefaultCPU
+	}
+	if len(memory) < 1 {
+		memory = config.DefaultMemory
+	}
+	var limits ResourceLimits
+	var err error
+	if limits.MilliCPU, err = parseLimit("cpu", cpu, true); err != nil {
+		return limits, err
+	}
+	if limits.Memory, err = parseLimit("memory", memory, false); err != nil {
+		return limits, err
+	}
+	maxCPU, err := parseLimit("max_cpu", config.MaxCPU, true)
+	if err != nil {
+		return limits, err
+	}
+	maxMemory, err := parseLimit("max_memory", config.MaxMemory, false)
+	if err != nil {
+		return limits, err
+	}
+	if maxCPU > 0 && (limits.MilliCPU < 1 || limits.MilliCPU > maxCPU) {
+		return limits, fmt.Errorf("cpu limit %s exceeds the maximum %s allowed by the agent", limitString(cpu), config.MaxCPU)
+	}
+	if maxMemory > 0 && (limits.Memory < 1 || limits.Memory > maxMemory) {
+		return limits, fmt.Errorf("memory limit %s exceeds the maximum %s allowed by the agent", limitString(memory), config.MaxMemory)
+	}
+	return limits, nil
+}
+
+func limitString(value string) string {
+	if len(value) < 1 {
+		return "unlimited"
+	}
+	return value
+}
+
+// validateLimits checks the quantities of the agent config, so that a typo fails on startup
+func (c *Config) validateLimits() error {
+	_, err := resourceLimits("", "", c)
+	return err
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"io"
+	"io/ioutil"
+	"k8s.io/klog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var logsSessionPattern = regexp.MustCompile(`^[a-zA-Z0-9-]{1,64}$`)
+
+// validLogsSession guards the logs session id against path traversal
+func validLogsSession(session string) bool {
+	return logsSessionPattern.MatchString(session)
+}
+
+func logsFile(dir, session string) string {
+	return filepath.Join(dir, session+".log")
+}
+
+// SaveLogs writes the complete logs of the debug container to the logs dir,
+// where it is kept until the client fetches it
+func (m *DebugAttacher) SaveLogs(id string, session string) error {
+	// cleanup procedure should use background context
+	ctx, cancel := context.WithTimeout(context.Background(), m.runtime.timeout)
+	defer cancel()
+	inspect, err := m.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return err
+	}
+	reader, err := m.client.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(m.runtime.logsDir, 0700); err != nil {
+		return err
+	}
+	// write to a temp file first, so that the client never reads partial logs
+	tmp := logsFile(m.runtime.logsDir, session) + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = io.Copy(file, reader)
+	} else {
+		_, err = stdcopy.StdCopy(file, file, reader)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, logsFile(m.runtime.logsDir, session))
+}
+
+// ServeLogs streams the saved logs of a finished debug session and removes them,
+// 404 is returned if the logs are not (yet) saved
+func (s *Server) ServeLogs(w http.ResponseWriter, req *http.Request) {
+	session := req.FormValue("session")
+	if !validLogsSession(session) {
+		http.Error(w, "invalid logs session", 400)
+		return
+	}
+	path := logsFile(s.runtimeApi.logsDir, session)
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "logs not found", 404)
+			return
+		}
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	defer os.Remove(path)
+	defer file.Close()
+	w.Header().Set("Content-Type", "text/plain")
+	if _, err := io.Copy(w, file); err != nil {
+		klog.Errorf("error writing logs of session %s: %v", session, err)
+	}
+}
+
+// expireLogs removes the saved logs, and the temp files of failed saves, older than
+// the logs ttl, e.g. of clients which broke before fetching them
+func (m *RuntimeManager) expireLogs() {
+	if m.logsTTL <= 0 {
+		return
+	}
+	entries, err := ioutil.ReadDir(m.logsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			klog.Errorf("error listing logs dir %s: %v", m.logsDir, err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || time.Since(entry.ModTime()) < m.logsTTL {
+			continue
+		}
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".log") && !strings.HasSuffix(name, ".log.tmp") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.logsDir, name)); err != nil && !os.IsNotExist(err) {
+			klog.Errorf("error removing expired logs %s: %v", name, err)
+			continue
+		}
+		klog.V(2).Infof("removed expired logs %s", name)
+	}
+}
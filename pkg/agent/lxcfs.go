@@ -0,0 +1,35 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// lxcfsProcFiles are the files of /proc which lxcfs computes from the cgroup of the
+// process reading them, instead of reporting the numbers of the node
+var lxcfsProcFiles = []string{"cpuinfo", "diskstats", "loadavg", "meminfo", "stat", "swaps", "uptime"}
+
+// lxcfsMount bind mounts a file of lxcfs over the one of /proc in the debug container
+type lxcfsMount struct {
+	source      string
+	destination string
+}
+
+// lxcfsMounts returns the mounts of the lxcfs files found under the lxcfs mount point,
+// which must be mounted at the same path in the agent as on the node
+func lxcfsMounts(lxcfsPath string) ([]lxcfsMount, error) {
+	var mounts []lxcfsMount
+	for _, file := range lxcfsProcFiles {
+		source := filepath.Join(lxcfsPath, "proc", file)
+		if _, err := os.Stat(source); err != nil {
+			// older versions of lxcfs do not provide every file, e.g. loadavg
+			continue
+		}
+		mounts = append(mounts, lxcfsMount{source: source, destination: filepath.Join("/proc", file)})
+	}
+	if len(mounts) < 1 {
+		return nil, fmt.Errorf("lxcfs is not mounted at %s in the agent, install lxcfs on the node and mount its directory in the agent", lxcfsPath)
+	}
+	return mounts, nil
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const metricsNamespace = "kubectl_debug"
+
+// the stages at which a debug session fails
+const (
+	stagePull    = "pull"
+	stageCreate  = "create"
+	stageAttach  = "attach"
+	stageTimeout = "timeout"
+	// stageUnauthorized is a request refused by the authorization of the agent
+	stageUnauthorized = "unauthorized"
+)
+
+var (
+	// metricsRegistry holds the metrics of the agent only, not those of the go runtime,
+	// which the node exporter or the kubelet already report for the agent pod
+	metricsRegistry = prometheus.NewRegistry()
+
+	sessionsStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sessions_started_total",
+		Help:      "Debug sessions started, by runtime",
+	}, []string{"runtime"})
+	sessionsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sessions_failed_total",
+		Help:      "Debug sessions failed, by runtime and stage: unauthorized, pull, create, attach or timeout",
+	}, []string{"runtime", "stage"})
+	sessionsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sessions_active",
+		Help:      "Debug sessions whose debug container is running, by runtime",
+	}, []string{"runtime"})
+	imagePullDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "image_pull_duration_seconds",
+		Help:      "Duration of the successful pulls of debug images, by runtime",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"runtime"})
+	containerCreateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "container_create_duration_seconds",
+		Help:      "Duration of the successful creations of debug containers, by runtime",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"runtime"})
+	runtimeErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "runtime_errors_total",
+		Help:      "Errors of the container runtimes, by runtime and operation: pull, create, attach, list or remove",
+	}, []string{"runtime", "operation"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(sessionsStarted, sessionsFailed, sessionsActive, imagePullDuration,
+		containerCreateDuration, runtimeErrors)
+}
+
+// metricsHandler serves the metrics of the agent in the prometheus format
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// runtimeFailed counts an error of the runtime which failed the session at the stage
+func runtimeFailed(runtime, stage string) {
+	runtimeErrors.WithLabelValues(runtime, stage).Inc()
+	sessionsFailed.WithLabelValues(runtime, stage).Inc()
+}
+
+func observeSince(histogram *prometheus.HistogramVec, runtime string, start time.Time) {
+	histogram.WithLabelValues(runtime).Observe(time.Since(start).Seconds())
+}
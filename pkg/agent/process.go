@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"io"
+	"io/ioutil"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// cliProcess is the process of a runtime cli, e.g. `ctr run` or `crictl attach`,
+// which is attached to the debug container and lives as long as the container
+type cliProcess struct {
+	cmd *exec.Cmd
+	// pty is the master of the debug container tty, nil without tty
+	pty            *os.File
+	stdin          io.WriteCloser
+	stdout, stderr io.ReadCloser
+}
+
+// start runs the command on a new pty, or on pipes without tty
+func (p *cliProcess) start(cmd *exec.Cmd, tty bool) error {
+	var err error
+	p.cmd = cmd
+	if tty {
+		master, slave, err := openPty()
+		if err != nil {
+			return err
+		}
+		defer slave.Close()
+		p.pty = master
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+		cmd.SysProcAttr = ttyProcAttr()
+	} else {
+		if p.stdin, err = cmd.StdinPipe(); err != nil {
+			return err
+		}
+		if p.stdout, err = cmd.StdoutPipe(); err != nil {
+			return err
+		}
+		if p.stderr, err = cmd.StderrPipe(); err != nil {
+			return err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		if p.pty != nil {
+			p.pty.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// attach pipes the streams to the process until it exits
+func (p *cliProcess) attach(id string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	var outputs sync.WaitGroup
+	copyOutput := func(dst io.Writer, src io.Reader) {
+		defer outputs.Done()
+		if dst == nil {
+			dst = ioutil.Discard
+		}
+		// reading the pty fails once the container exits, which ends the copy as well
+		io.Copy(dst, src)
+	}
+
+	if tty {
+		defer p.pty.Close()
+		HandleResizing(resize, func(size remotecommand.TerminalSize) {
+			if err := resizePty(p.pty, size); err != nil {
+				klog.Errorf("error resizing tty of container %s: %v", id, err)
+			}
+		})
+		if stdin != nil {
+			go io.Copy(p.pty, stdin)
+		}
+		outputs.Add(1)
+		go copyOutput(stdout, p.pty)
+	} else {
+		go func() {
+			if stdin != nil {
+				io.Copy(p.stdin, stdin)
+			}
+			// the client reached EOF on stdin, propagate it to the container
+			p.stdin.Close()
+		}()
+		outputs.Add(2)
+		go copyOutput(stdout, p.stdout)
+		go copyOutput(stderr, p.stderr)
+	}
+	// the pipes are closed by Wait, so the outputs must be drained first
+	outputs.Wait()
+	if err := p.cmd.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return err
+		}
+		// a non-zero exit of the debug container is not an error of the session
+	}
+	return nil
+}
+
+// exited tells whether the process has been waited for
+func (p *cliProcess) exited() bool {
+	return p.cmd == nil || p.cmd.ProcessState != nil
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package agent
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"k8s.io/client-go/tools/remotecommand"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPty allocates a pseudo terminal, the slave is handed to a child process
+// as its controlling terminal while the master is streamed to the client
+func openPty() (master *os.File, slave *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			master.Close()
+		}
+	}()
+	var unlock int32
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, master.Fd(), unix.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+		return nil, nil, fmt.Errorf("error unlocking pty: %v", errno)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting pty number: %v", err)
+	}
+	slave, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return master, slave, nil
+}
+
+// resizePty sets the size of the terminal, the process owning it receives a SIGWINCH
+func resizePty(pty *os.File, size remotecommand.TerminalSize) error {
+	return unix.IoctlSetWinsize(int(pty.Fd()), unix.TIOCSWINSZ, &unix.Winsize{
+		Row: size.Height,
+		Col: size.Width,
+	})
+}
+
+// ttyProcAttr makes the slave of the pty the controlling terminal of a new session
+func ttyProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true, Setctty: true}
+}
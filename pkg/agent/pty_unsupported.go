@@ -0,0 +1,22 @@
+// +build !linux
+
+package agent
+
+import (
+	"fmt"
+	"k8s.io/client-go/tools/remotecommand"
+	"os"
+	"syscall"
+)
+
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("pty is only supported on linux")
+}
+
+func resizePty(pty *os.File, size remotecommand.TerminalSize) error {
+	return fmt.Errorf("pty is only supported on linux")
+}
+
+func ttyProcAttr() *syscall.SysProcAttr {
+	return nil
+}
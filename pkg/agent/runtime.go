@@ -13,49 +13,191 @@ import (
 	"io/ioutil"
 	kubetype "k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/klog"
 	"k8s.io/kubernetes/pkg/kubelet/dockershim/libdocker"
-	kubeletremote "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
-	"log"
+	utilexec "k8s.io/utils/exec"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const hostMode = "host"
+
 // RuntimeManager is responsible for docker operation
 type RuntimeManager struct {
-	client  *dockerclient.Client
-	timeout time.Duration
+	client         *dockerclient.Client
+	dockerEndpoint string
+	timeout        time.Duration
+	logsDir        string
+	logsTTL        time.Duration
+	sessions       *SessionManager
+
+	sessionIdleTimeout time.Duration
+	maxSessionDuration time.Duration
+	// agentPort is the port this agent listens on, which labels its debug containers
+	agentPort string
+	// authorization makes the sweeper send the token of the service account to the
+	// other agents on the node, whose sessions api is authorized as well
+	authorization bool
+
+	resolvConfDir string
+	lxcfsPath     string
+
+	// ctrPath, containerdEndpoint and containerdNamespace are used to debug containerd containers
+	ctrPath             string
+	containerdEndpoint  string
+	containerdNamespace string
+
+	// crictlPath and crioEndpoint are used to debug cri-o containers
+	crictlPath   string
+	crioEndpoint string
+
+	// auditor records the debug sessions, nil if auditing is disabled
+	auditor *auditor
 }
 
-func NewRuntimeManager(host string, timeout time.Duration) (*RuntimeManager, error) {
-	client, err := dockerclient.NewClient(host, "", nil, nil)
+func NewRuntimeManager(config *Config) (*RuntimeManager, error) {
+	client, err := dockerclient.NewClient(config.DockerEndpoint, "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	auditor, err := newAuditor(config)
 	if err != nil {
 		return nil, err
 	}
 	return &RuntimeManager{
-		client:  client,
-		timeout: timeout,
+		client:         client,
+		dockerEndpoint: config.DockerEndpoint,
+		timeout:        config.DockerTimeout,
+		logsDir:        config.LogsDir,
+		logsTTL:        config.LogsTTL,
+		sessions:       NewSessionManager(),
+
+		sessionIdleTimeout: config.SessionIdleTimeout,
+		maxSessionDuration: config.MaxSessionDuration,
+		agentPort:          agentPort(config.ListenAddress),
+		authorization:      config.Authorization,
+
+		resolvConfDir: config.ResolvConfDir,
+		lxcfsPath:     config.LxcfsPath,
+
+		ctrPath:             config.CtrPath,
+		containerdEndpoint:  config.ContainerdEndpoint,
+		containerdNamespace: config.ContainerdNamespace,
+
+		crictlPath:   config.CrictlPath,
+		crioEndpoint: config.CrioEndpoint,
+
+		auditor: auditor,
 	}, nil
 }
 
-// GetAttacher returns an implementation of Attacher
-func (m *RuntimeManager) GetAttacher(image string, command []string, context context.Context, cancel context.CancelFunc) kubeletremote.Attacher {
-	return &DebugAttacher{
+// DebugConfig holds the parameters of a debug request
+type DebugConfig struct {
+	Image   string
+	Command []string
+	// Args are passed to Command, which is the entrypoint of the debug container
+	Args []string
+	// Arch is the architecture of the target node, if set, a warning is
+	// printed when the image does not advertise this platform
+	Arch string
+	// ForceInitialResize resends the terminal size right after the tty is attached
+	ForceInitialResize bool
+	// RuntimeArgs are applied to the debug container on creation
+	RuntimeArgs []RuntimeArg
+	// Env is the environment of the debug container, in the form of KEY=VALUE
+	Env []string
+	// LogsSession is the id under which the debug container logs are saved
+	// before the container is removed, logs are not saved if empty
+	LogsSession string
+	// QuietPull hides the progress of pulling the image, errors are still reported
+	QuietPull bool
+	// CommandTimeout kills the debug container once it has run for this duration, zero means no timeout
+	CommandTimeout time.Duration
+	// Retain keeps the debug container once the session ends instead of removing it
+	Retain bool
+	// AttachTimeout kills the debug container if it has not written anything this long
+	// after it was created, e.g. a shell which never comes up, zero means no timeout
+	AttachTimeout time.Duration
+	// ReportExitCode fails the session with the exit code of the debug container if it is not zero
+	ReportExitCode bool
+	// DNSServers and DNSSearches replace the resolv.conf of the debug container,
+	// which is inherited from the target container or the node otherwise
+	DNSServers  []string
+	DNSSearches []string
+	// RegistryAuth authenticates the pull of the image, it is pulled anonymously if nil
+	RegistryAuth *types.AuthConfig
+	// Limits are the cgroup limits of the debug container
+	Limits ResourceLimits
+	// Volumes of the target pod are mounted in the debug container at their paths in the target container
+	Volumes []VolumeMount
+	// Lxcfs mounts the /proc files of lxcfs in the debug container, which is placed in
+	// the cgroup of the pod of the target container where the runtime allows it
+	Lxcfs bool
+}
+
+// containerRuntime creates the debug container on the container runtime of the
+// target container, attaches to it, and removes it once the session ends
+type containerRuntime interface {
+	PullImage(image string, tty bool, stdout io.Writer) error
+	RunDebugContainer(targetId string, image string, command []string, tty bool) (string, error)
+	AttachToContainer(id string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error
+	KillContainer(id string)
+	CleanContainer(id string)
+	// ExitCode returns the exit code of the debug container once it exited
+	ExitCode(id string) (int, error)
+}
+
+// GetAttacher returns an implementation of Attacher and Executor, which debugs
+// the target container on the given runtime, docker, containerd or cri-o, or runs
+// a host process on windows nodes
+func (m *RuntimeManager) GetAttacher(runtime string, config *DebugConfig, session *Session, context context.Context, cancel context.CancelFunc) *DebugAttacher {
+	attacher := &DebugAttacher{
 		runtime:       m,
-		image:         image,
-		command:       command,
+		runtimeName:   runtime,
+		config:        config,
+		image:         config.Image,
+		command:       config.Command,
+		session:       session,
 		context:       context,
 		client:        m.client,
 		cancel:        cancel,
 		stopListenEOF: make(chan struct{}),
 	}
+	attacher.containerRuntime = attacher
+	switch runtime {
+	case runtimeContainerd:
+		attacher.containerRuntime = &containerdRuntime{attacher: attacher}
+	case runtimeCrio:
+		attacher.containerRuntime = &crioRuntime{attacher: attacher}
+	case runtimeHostProcess:
+		attacher.containerRuntime = &hostProcessRuntime{attacher: attacher}
+	}
+	return attacher
 }
 
 // DebugAttacher implements Attacher
 // we use this struct in order to inject debug info (image, command) in the debug procedure
 type DebugAttacher struct {
 	runtime *RuntimeManager
+	config  *DebugConfig
 	image   string
 	command []string
 	client  *dockerclient.Client
+	// runtimeName is the runtime of the session, which labels its metrics
+	runtimeName string
+	// containerRuntime is the attacher itself for docker
+	containerRuntime containerRuntime
+	// session holds the metadata of this debug session, it is registered
+	// to the RuntimeManager once the debug container started
+	session *Session
+	// resolvConf is the host path of the custom resolv.conf, empty if not set
+	resolvConf string
+	// lxcfsMounts are the lxcfs files mounted over /proc, empty without lxcfs
+	lxcfsMounts []lxcfsMount
+	// audit is the audit record of the session, nil if auditing is disabled
+	audit *AuditRecord
 
 	// control the preparing of debug container
 	stopListenEOF chan struct{}
@@ -67,10 +209,23 @@ func (a *DebugAttacher) AttachContainer(name string, uid kubetype.UID, container
 	return a.DebugContainer(container, a.image, a.command, in, out, err, tty, resize)
 }
 
-// DebugContainer executes the main debug flow
+// DebugContainer executes the main debug flow, and records its end in the audit log
 func (m *DebugAttacher) DebugContainer(container, image string, command []string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	err := m.debugContainer(container, image, command, stdin, stdout, stderr, tty, resize)
+	if m.audit != nil {
+		end := time.Now()
+		m.audit.Event, m.audit.EndTime = auditEnded, &end
+		if err != nil {
+			m.audit.Error = err.Error()
+		}
+		m.runtime.auditor.write(m.audit)
+	}
+	return err
+}
 
-	log.Printf("Accept new debug reqeust:\n\t target container: %s \n\t image: %s \n\t command: %v \n", container, image, command)
+func (m *DebugAttacher) debugContainer(container, image string, command []string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+
+	klog.Infof("Accept new debug reqeust:\n\t target container: %s \n\t image: %s \n\t command: %v", container, image, command)
 
 	// the following steps may takes much time,
 	// so we listen to EOF from stdin
@@ -98,38 +253,247 @@ func (m *DebugAttacher) DebugContainer(container, image string, command []string
 	//	}
 	//} ()
 
+	// without tty, stdout is a raw byte stream of the debug container,
+	// so the progress goes to stderr to keep stdout binary-safe
+	progress := stdout
+	if !tty && stderr != nil {
+		progress = stderr
+	}
+
 	// step 1: pull image
-	stdout.Write([]byte(fmt.Sprintf("pulling image %s... \n\r", image)))
-	err := m.PullImage(image, stdout)
+	// the image manifest is inspected by the docker daemon only
+	if _, docker := m.containerRuntime.(*DebugAttacher); docker && len(m.config.Arch) > 0 {
+		m.checkImagePlatform(image, progress)
+	}
+	// a host process runs the tools of the node, there is no image
+	if _, host := m.containerRuntime.(*hostProcessRuntime); host {
+		progress.Write([]byte("windows node, the command runs as a host process with the tools of the node\n\r"))
+	} else {
+		progress.Write([]byte(fmt.Sprintf("pulling image %s... \n\r", image)))
+		var pullProgress io.Writer = progress
+		if m.config.QuietPull {
+			pullProgress = ioutil.Discard
+		}
+		start := time.Now()
+		if err := m.containerRuntime.PullImage(image, tty, pullProgress); err != nil {
+			runtimeFailed(m.runtimeName, stagePull)
+			return err
+		}
+		observeSince(imagePullDuration, m.runtimeName, start)
+	}
+
+	resolvConf, err := m.writeResolvConf()
 	if err != nil {
-		return err
+		return fmt.Errorf("error writing resolv.conf: %v", err)
+	}
+	if len(resolvConf) > 0 {
+		m.resolvConf = resolvConf
+		defer os.Remove(resolvConf)
+	}
+	if m.config.Lxcfs && len(container) > 0 {
+		if m.lxcfsMounts, err = lxcfsMounts(m.runtime.lxcfsPath); err != nil {
+			return err
+		}
 	}
 
 	// step 2: run debug container (join the namespaces of target container)
-	stdout.Write([]byte("starting debug container...\n\r"))
-	id, err := m.RunDebugContainer(container, image, command)
+	progress.Write([]byte("starting debug container...\n\r"))
+	start := time.Now()
+	id, err := m.containerRuntime.RunDebugContainer(container, image, command, tty)
 	if err != nil {
+		runtimeFailed(m.runtimeName, stageCreate)
 		return err
 	}
-	defer m.CleanContainer(id)
+	observeSince(containerCreateDuration, m.runtimeName, start)
+	sessionsStarted.WithLabelValues(m.runtimeName).Inc()
+	if m.audit != nil {
+		m.audit.Event, m.audit.ContainerID, m.audit.StartTime = auditStarted, id, &start
+		m.runtime.auditor.write(m.audit)
+	}
+	sessionsActive.WithLabelValues(m.runtimeName).Inc()
+	defer sessionsActive.WithLabelValues(m.runtimeName).Dec()
+	defer m.containerRuntime.CleanContainer(id)
+	if m.config.Retain {
+		progress.Write([]byte(fmt.Sprintf("debug container %s is retained after the session\n\r", id)))
+	}
+	if m.session != nil {
+		m.session.ContainerID = id
+		m.session.StartTime = time.Now()
+		m.runtime.sessions.Add(m.session)
+		defer m.runtime.sessions.Remove(id)
+	}
+
+	var timedOut int32
+	if m.config.CommandTimeout > 0 {
+		timer := time.AfterFunc(m.config.CommandTimeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			m.containerRuntime.KillContainer(id)
+		})
+		defer timer.Stop()
+	}
 
 	// step 3: attach tty
-	stdout.Write([]byte("container created, open tty...\n\r"))
+	progress.Write([]byte("container created, open tty...\n\r"))
 
 	// from now on, should pipe stdin to the container and no long read stdin
 	// close(m.stopListenEOF)
 
-	if err := m.AttachToContainer(id, stdin, stdout, stderr, tty, resize); err != nil {
+	var attachTimedOut int32
+	if m.config.AttachTimeout > 0 {
+		// only the output of the debug container counts, not the progress above
+		watcher := newOutputWatcher()
+		stdout = watcher.Wrap(stdout)
+		if stderr != nil {
+			stderr = watcher.Wrap(stderr)
+		}
+		timer := time.AfterFunc(m.config.AttachTimeout, func() {
+			if !watcher.Seen() {
+				atomic.StoreInt32(&attachTimedOut, 1)
+				m.containerRuntime.KillContainer(id)
+			}
+		})
+		defer timer.Stop()
+	}
+
+	var sessionIdle, sessionExpired int32
+	if m.runtime.maxSessionDuration > 0 {
+		timer := time.AfterFunc(m.runtime.maxSessionDuration, func() {
+			atomic.StoreInt32(&sessionExpired, 1)
+			m.containerRuntime.KillContainer(id)
+		})
+		defer timer.Stop()
+	}
+	if idleTimeout := m.runtime.sessionIdleTimeout; idleTimeout > 0 {
+		// resizes are not activity, the plugin resends the size as a keepalive
+		activity := newActivityWatcher()
+		if stdin != nil {
+			stdin = activity.WrapReader(stdin)
+		}
+		stdout = activity.WrapWriter(stdout)
+		if stderr != nil {
+			stderr = activity.WrapWriter(stderr)
+		}
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(idleCheckInterval(idleTimeout))
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if activity.Idle() >= idleTimeout {
+						klog.Infof("debug container %s idle for %s, killing it", id, idleTimeout)
+						atomic.StoreInt32(&sessionIdle, 1)
+						m.containerRuntime.KillContainer(id)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	if err := m.containerRuntime.AttachToContainer(id, stdin, stdout, stderr, tty, resize); err != nil {
+		runtimeFailed(m.runtimeName, stageAttach)
 		return err
 	}
+	if atomic.LoadInt32(&sessionIdle) == 1 || atomic.LoadInt32(&sessionExpired) == 1 ||
+		atomic.LoadInt32(&attachTimedOut) == 1 || atomic.LoadInt32(&timedOut) == 1 {
+		sessionsFailed.WithLabelValues(m.runtimeName, stageTimeout).Inc()
+	}
+	if atomic.LoadInt32(&sessionIdle) == 1 {
+		return fmt.Errorf("%s %s", sessionIdleMessage, m.runtime.sessionIdleTimeout)
+	}
+	if atomic.LoadInt32(&sessionExpired) == 1 {
+		return fmt.Errorf("%s %s", maxSessionMessage, m.runtime.maxSessionDuration)
+	}
+	if atomic.LoadInt32(&attachTimedOut) == 1 {
+		return fmt.Errorf("%s %s, the command of the debug container never came up", attachTimeoutMessage, m.config.AttachTimeout)
+	}
+	if atomic.LoadInt32(&timedOut) == 1 {
+		return fmt.Errorf("%s %s", commandTimeoutMessage, m.config.CommandTimeout)
+	}
+	if m.audit != nil && !m.config.ReportExitCode && m.containerExited(id) {
+		// the exit code is only audited here, a session whose client went away
+		// leaves the container running until it is cleaned up
+		if code, err := m.containerRuntime.ExitCode(id); err == nil {
+			m.audit.ExitCode = &code
+		}
+	}
+	if m.config.ReportExitCode {
+		code, err := m.containerRuntime.ExitCode(id)
+		if err != nil {
+			return fmt.Errorf("error getting exit code of container %s: %v", id, err)
+		}
+		if m.audit != nil {
+			m.audit.ExitCode = &code
+		}
+		if code != 0 {
+			return utilexec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+		}
+	}
 	return nil
 }
 
+// idleCheckInterval returns how often the idle timeout is checked, a tenth of the timeout within bounds
+func idleCheckInterval(timeout time.Duration) time.Duration {
+	interval := timeout / 10
+	if interval < time.Second {
+		return time.Second
+	}
+	if interval > time.Minute {
+		return time.Minute
+	}
+	return interval
+}
+
+// ExecInContainer implements Executor, the command is ignored as it is already
+// part of the debug config, which lets ServeExec report the exit code to the client
+func (m *DebugAttacher) ExecInContainer(name string, uid kubetype.UID, container string, cmd []string, in io.Reader, out, err io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error {
+	return m.DebugContainer(container, m.image, m.command, in, out, err, tty, resize)
+}
+
+// ExitCode waits for the debug container to exit and returns its exit code
+func (m *DebugAttacher) ExitCode(id string) (int, error) {
+	ctx, cancel := m.getContextWithTimeout()
+	defer cancel()
+	statusCh, errCh := m.client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return 0, err
+	case status := <-statusCh:
+		return int(status.StatusCode), nil
+	}
+}
+
+// containerExited tells whether the debug container exited, as ExitCode waits for it on
+// docker, the other runtimes fail right away instead
+func (m *DebugAttacher) containerExited(id string) bool {
+	if _, docker := m.containerRuntime.(*DebugAttacher); !docker {
+		return true
+	}
+	ctx, cancel := m.getContextWithTimeout()
+	defer cancel()
+	inspect, err := m.client.ContainerInspect(ctx, id)
+	return err == nil && inspect.State != nil && !inspect.State.Running
+}
+
+// KillContainer kills the debug container, which ends the attached session
+func (m *DebugAttacher) KillContainer(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.runtime.timeout)
+	defer cancel()
+	if err := m.client.ContainerKill(ctx, id, "KILL"); err != nil {
+		klog.Errorf("error killing container %s: %v", id, err)
+	}
+}
+
 // Run a new container, this container will join the network,
-// mount, and pid namespace of the given container
-func (m *DebugAttacher) RunDebugContainer(targetId string, image string, command []string) (string, error) {
+// mount, and pid namespace of the given container, or the network
+// and pid namespace of the host if no container is given
+func (m *DebugAttacher) RunDebugContainer(targetId string, image string, command []string, tty bool) (string, error) {
 
-	createdBody, err := m.CreateContainer(targetId, image, command)
+	createdBody, err := m.CreateContainer(targetId, image, command, tty)
 	if err != nil {
 		return "", err
 	}
@@ -149,14 +513,19 @@ func (m *DebugAttacher) StartContainer(id string) error {
 	return nil
 }
 
-func (m *DebugAttacher) CreateContainer(targetId string, image string, command []string) (*container.ContainerCreateCreatedBody, error) {
+func (m *DebugAttacher) CreateContainer(targetId string, image string, command []string, tty bool) (*container.ContainerCreateCreatedBody, error) {
 
 	config := &container.Config{
+		Labels:     m.debugLabels(targetId, ""),
 		Entrypoint: strslice.StrSlice(command),
+		Cmd:        strslice.StrSlice(m.config.Args),
 		Image:      image,
-		Tty:        true,
+		Env:        m.config.Env,
+		Tty:        tty,
 		OpenStdin:  true,
-		StdinOnce:  true,
+		// stdin is closed once the attached client closes it, so that piped
+		// scripts, e.g. `cat script.sh | kubectl debug POD -- sh`, terminate
+		StdinOnce: true,
 	}
 	hostConfig := &container.HostConfig{
 		NetworkMode: container.NetworkMode(m.containerMode(targetId)),
@@ -164,6 +533,47 @@ func (m *DebugAttacher) CreateContainer(targetId string, image string, command [
 		IpcMode:     container.IpcMode(m.containerMode(targetId)),
 		PidMode:     container.PidMode(m.containerMode(targetId)),
 	}
+	if len(targetId) < 1 {
+		// standalone debug container, share the network and pid namespaces of the node
+		hostConfig = &container.HostConfig{
+			NetworkMode: container.NetworkMode(hostMode),
+			PidMode:     container.PidMode(hostMode),
+		}
+	}
+	if len(m.resolvConf) > 0 {
+		// docker does not manage the resolv.conf if it is mounted explicitly
+		hostConfig.Binds = append(hostConfig.Binds, m.resolvConf+":"+resolvConfPath+":ro")
+	}
+	if len(m.config.Volumes) > 0 {
+		binds, err := m.volumeBinds(targetId)
+		if err != nil {
+			return nil, err
+		}
+		for _, bind := range binds {
+			mode := "rw"
+			if bind.readOnly {
+				mode = "ro"
+			}
+			hostConfig.Binds = append(hostConfig.Binds, bind.source+":"+bind.destination+":"+mode)
+		}
+	}
+	if len(m.lxcfsMounts) > 0 {
+		for _, mount := range m.lxcfsMounts {
+			hostConfig.Binds = append(hostConfig.Binds, mount.source+":"+mount.destination+":ro")
+		}
+		// lxcfs computes the files from the cgroup of the reader, which is then under the
+		// pod cgroup, so the limits are those of the pod, unless set by a runtime arg
+		parent, err := m.cgroupParent(targetId)
+		if err != nil {
+			return nil, err
+		}
+		hostConfig.CgroupParent = parent
+	}
+	if err := applyRuntimeArgs(m.config.RuntimeArgs, config, hostConfig); err != nil {
+		return nil, err
+	}
+	hostConfig.NanoCPUs = m.config.Limits.MilliCPU * 1000000
+	hostConfig.Memory = m.config.Limits.Memory
 	ctx, cancel := m.getContextWithTimeout()
 	defer cancel()
 	body, err := m.client.ContainerCreate(ctx, config, hostConfig, nil, "")
@@ -173,39 +583,106 @@ func (m *DebugAttacher) CreateContainer(targetId string, image string, command [
 	return &body, nil
 }
 
-func (m *DebugAttacher) PullImage(image string, stdout io.WriteCloser) error {
+// volumeBinds returns the bind mounts of the requested volumes, found in the mounts of the target container
+func (m *DebugAttacher) volumeBinds(targetId string) ([]volumeBind, error) {
+	ctx, cancel := m.getContextWithTimeout()
+	defer cancel()
+	target, err := m.client.ContainerInspect(ctx, targetId)
+	if err != nil {
+		return nil, err
+	}
+	var mounts []volumeBind
+	for _, mount := range target.Mounts {
+		mounts = append(mounts, volumeBind{source: mount.Source, destination: mount.Destination, readOnly: !mount.RW})
+	}
+	return volumeBinds(m.config.Volumes, mounts)
+}
+
+// cgroupParent returns the cgroup parent of the target container, which is the cgroup of its pod
+func (m *DebugAttacher) cgroupParent(targetId string) (string, error) {
+	ctx, cancel := m.getContextWithTimeout()
+	defer cancel()
+	target, err := m.client.ContainerInspect(ctx, targetId)
+	if err != nil {
+		return "", err
+	}
+	return target.HostConfig.CgroupParent, nil
+}
+
+func (m *DebugAttacher) PullImage(image string, tty bool, stdout io.Writer) error {
+	options := types.ImagePullOptions{}
+	if m.config.RegistryAuth != nil {
+		auth, err := term.EncodeRegistryAuth(m.config.RegistryAuth)
+		if err != nil {
+			return err
+		}
+		options.RegistryAuth = auth
+	}
 	// image pull can be time consuming, just pass the request context
-	out, err := m.client.ImagePull(m.context, image, types.ImagePullOptions{})
+	out, err := m.client.ImagePull(m.context, image, options)
 	if err != nil {
 		return err
 	}
 	defer out.Close()
 	// write pull progress to user
-	term.DisplayJSONMessagesStream(out, stdout, 1, true, nil)
+	term.DisplayJSONMessagesStream(out, stdout, 1, tty, nil)
 	return nil
 }
 
+// checkImagePlatform warns the user if the image manifest does not advertise the node
+// architecture, this check is best-effort and never fails the debug procedure
+func (m *DebugAttacher) checkImagePlatform(image string, stdout io.Writer) {
+	ctx, cancel := m.getContextWithTimeout()
+	defer cancel()
+	inspect, err := m.client.DistributionInspect(ctx, image, "")
+	if err != nil {
+		klog.V(2).Infof("skip platform check of image %s: %v", image, err)
+		return
+	}
+	if len(inspect.Platforms) < 1 {
+		return
+	}
+	var platforms []string
+	for _, platform := range inspect.Platforms {
+		if platform.Architecture == m.config.Arch {
+			return
+		}
+		platforms = append(platforms, fmt.Sprintf("%s/%s", platform.OS, platform.Architecture))
+	}
+	stdout.Write([]byte(fmt.Sprintf("warning: image %s is available for %v, which does not include the node architecture %s, the debug container may fail to start\n\r",
+		image, platforms, m.config.Arch)))
+}
+
 func (m *DebugAttacher) CleanContainer(id string) {
 	// cleanup procedure should use background context
 	ctx, cancel := context.WithTimeout(context.Background(), m.runtime.timeout)
 	defer cancel()
 	// wait the container gracefully exit
 	statusCh, errCh := m.client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
-	var rmErr error
+	force := false
 	select {
 	case err := <-errCh:
 		if err != nil {
-			log.Println("error waiting container exit, kill with --force")
+			klog.Warning("error waiting container exit, kill with --force")
 			// timeout or error occurs, try force remove anywawy
-			rmErr = m.RmContainer(id, true)
+			force = true
 		}
 	case <-statusCh:
-		rmErr = m.RmContainer(id, false)
 	}
+	if len(m.config.LogsSession) > 0 {
+		if err := m.SaveLogs(id, m.config.LogsSession); err != nil {
+			klog.Errorf("error saving logs of container %s: %v", id, err)
+		}
+	}
+	if m.config.Retain {
+		klog.Infof("Debug session end, debug container %s retained", id)
+		return
+	}
+	rmErr := m.RmContainer(id, force)
 	if rmErr != nil {
-		log.Printf("error remove container: %s \n", id)
+		klog.Errorf("error remove container: %s", id)
 	} else {
-		log.Printf("Debug session end, debug container %s removed", id)
+		klog.Infof("Debug session end, debug container %s removed", id)
 	}
 }
 
@@ -226,9 +703,12 @@ func (m *DebugAttacher) RmContainer(id string, force bool) error {
 // AttachToContainer do `docker attach`
 func (m *DebugAttacher) AttachToContainer(container string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
 
-
-
+	var sizeLock sync.Mutex
+	var lastSize *remotecommand.TerminalSize
 	HandleResizing(resize, func(size remotecommand.TerminalSize) {
+		sizeLock.Lock()
+		lastSize = &size
+		sizeLock.Unlock()
 		m.resizeContainerTTY(container, uint(size.Height), uint(size.Width))
 	})
 
@@ -252,6 +732,18 @@ func (m *DebugAttacher) AttachToContainer(container string, stdin io.Reader, std
 	}
 	defer resp.Close()
 
+	if tty && m.config.ForceInitialResize {
+		sizeLock.Lock()
+		size := lastSize
+		sizeLock.Unlock()
+		if size != nil {
+			// some terminals render a broken layout until the first resize, so
+			// toggle the size once the tty is attached to force a redraw
+			m.resizeContainerTTY(container, uint(size.Height)+1, uint(size.Width)+1)
+			m.resizeContainerTTY(container, uint(size.Height), uint(size.Width))
+		}
+	}
+
 	return m.holdHijackedConnection(sopts.RawTerminal, sopts.InputStream, sopts.OutputStream, sopts.ErrorStream, resp)
 }
 
@@ -270,6 +762,7 @@ func (m *DebugAttacher) holdHijackedConnection(tty bool, inputStream io.Reader,
 		if inputStream != nil {
 			io.Copy(resp.Conn, inputStream)
 		}
+		// the client reached EOF on stdin, propagate it to the container
 		resp.CloseWrite()
 		// TODO 一定要close ？
 		close(stdinDone)
@@ -293,6 +786,8 @@ func (m *DebugAttacher) redirectResponseToOutputStream(tty bool, outputStream, e
 	if errorStream == nil {
 		errorStream = ioutil.Discard
 	}
+	// both copies write every chunk as soon as it is read from the connection,
+	// so the output of long running commands shows up progressively
 	var err error
 	if tty {
 		_, err = io.Copy(outputStream, resp)
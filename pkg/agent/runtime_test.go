@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/utils/exec"
+)
+
+// stubRuntime runs a debug container whose command takes runFor unless it is killed
+type stubRuntime struct {
+	runFor   time.Duration
+	exitCode int
+
+	mu     sync.Mutex
+	killed []string
+	kill   chan struct{}
+}
+
+func newStubRuntime(runFor time.Duration, exitCode int) *stubRuntime {
+	return &stubRuntime{runFor: runFor, exitCode: exitCode, kill: make(chan struct{})}
+}
+
+func (r *stubRuntime) PullImage(image string, tty bool, stdout io.Writer) error { return nil }
+
+func (r *stubRuntime) RunDebugContainer(targetId string, image string, command []string, tty bool) (string, error) {
+	return "debug1", nil
+}
+
+func (r *stubRuntime) AttachToContainer(id string, stdin io.Reader, stdout, stderr io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize) error {
+	select {
+	case <-time.After(r.runFor):
+	case <-r.kill:
+	}
+	return nil
+}
+
+func (r *stubRuntime) KillContainer(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.killed) < 1 {
+		close(r.kill)
+	}
+	r.killed = append(r.killed, id)
+}
+
+func (r *stubRuntime) killedContainers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.killed...)
+}
+
+func (r *stubRuntime) CleanContainer(id string) {}
+
+func (r *stubRuntime) ExitCode(id string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.killed) > 0 {
+		return 137, nil
+	}
+	return r.exitCode, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// TestDebugContainerCommandTimeout runs the debug flow on a stub runtime, the command
+// timer must kill a command running past the timeout and leave a shorter one alone
+func TestDebugContainerCommandTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		runFor       time.Duration
+		exitCode     int
+		wantKilled   bool
+		wantExitCode int
+	}{
+		{name: "timed out", runFor: time.Minute, wantKilled: true},
+		{name: "exits in time", runFor: 10 * time.Millisecond, exitCode: 3, wantExitCode: 3},
+	}
+	for _, test := range tests {
+		stub := newStubRuntime(test.runFor, test.exitCode)
+		attacher := &DebugAttacher{
+			runtime:          &RuntimeManager{sessions: NewSessionManager()},
+			config:           &DebugConfig{CommandTimeout: 200 * time.Millisecond, ReportExitCode: true},
+			containerRuntime: stub,
+		}
+		var out bytes.Buffer
+		stdout := nopWriteCloser{&out}
+
+		start := time.Now()
+		err := attacher.debugContainer("target", "busybox", []string{"sleep", "60"}, nil, stdout, stdout, false, nil)
+		if time.Since(start) > 30*time.Second {
+			t.Fatalf("%s: the command was not ended by the command timeout", test.name)
+		}
+		killed := stub.killedContainers()
+		if (len(killed) > 0) != test.wantKilled {
+			t.Errorf("%s: got killed containers %q, want killed %v", test.name, killed, test.wantKilled)
+			continue
+		}
+		if test.wantKilled {
+			if killed[0] != "debug1" {
+				t.Errorf("%s: got container %s killed, want debug1", test.name, killed[0])
+			}
+			// the plugin recognizes the message and exits with 124
+			if err == nil || !strings.HasPrefix(err.Error(), commandTimeoutMessage) {
+				t.Errorf("%s: got error %v, want the command timeout reported", test.name, err)
+			}
+			continue
+		}
+		exitErr, ok := err.(utilexec.CodeExitError)
+		if !ok || exitErr.Code != test.wantExitCode {
+			t.Errorf("%s: got error %v, want exit code %d reported", test.name, err, test.wantExitCode)
+		}
+	}
+}
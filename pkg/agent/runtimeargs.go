@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	units "github.com/docker/go-units"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// runtimeArgFunc applies the value of a runtime arg to the debug container config
+type runtimeArgFunc func(config *container.Config, hostConfig *container.HostConfig, value string) error
+
+// supportedRuntimeArgs are the runtime args which the agent knows how to apply,
+// only those listed in Config.AllowedRuntimeArgs are accepted from users
+var supportedRuntimeArgs = map[string]runtimeArgFunc{
+	"cgroup-parent": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		hostConfig.CgroupParent = value
+		return nil
+	},
+	"user": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		config.User = value
+		return nil
+	},
+	"workdir": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		config.WorkingDir = value
+		return nil
+	},
+	"shm-size": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		size, err := units.RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.ShmSize = size
+		return nil
+	},
+	"cap-add": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		hostConfig.CapAdd = append(hostConfig.CapAdd, value)
+		return nil
+	},
+	"cap-drop": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		hostConfig.CapDrop = append(hostConfig.CapDrop, value)
+		return nil
+	},
+	"security-opt": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, value)
+		return nil
+	},
+	"privileged": func(config *container.Config, hostConfig *container.HostConfig, value string) error {
+		privileged, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		hostConfig.Privileged = privileged
+		return nil
+	},
+}
+
+// RuntimeArg is a KEY=VALUE runtime arg requested by the user
+type RuntimeArg struct {
+	Key   string
+	Value string
+}
+
+// parseRuntimeArgs parses the KEY=VALUE runtime args, rejecting keys not in the allow-list
+func parseRuntimeArgs(args []string, allowed []string) ([]RuntimeArg, error) {
+	var result []RuntimeArg
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || len(parts[0]) < 1 {
+			return nil, fmt.Errorf("invalid runtime arg %q, must be KEY=VALUE", arg)
+		}
+		if _, ok := supportedRuntimeArgs[parts[0]]; !ok || !contains(allowed, parts[0]) {
+			return nil, fmt.Errorf("runtime arg %q is not allowed by the agent, allowed: %v", parts[0], allowedRuntimeArgs(allowed))
+		}
+		result = append(result, RuntimeArg{Key: parts[0], Value: parts[1]})
+	}
+	return result, nil
+}
+
+// applyRuntimeArgs applies the runtime args to the debug container config
+func applyRuntimeArgs(args []RuntimeArg, config *container.Config, hostConfig *container.HostConfig) error {
+	for _, arg := range args {
+		if err := supportedRuntimeArgs[arg.Key](config, hostConfig, arg.Value); err != nil {
+			return fmt.Errorf("invalid value of runtime arg %s: %v", arg.Key, err)
+		}
+	}
+	return nil
+}
+
+// allowedRuntimeArgs returns the keys which are both allowed and supported
+func allowedRuntimeArgs(allowed []string) []string {
+	result := []string{}
+	for _, key := range allowed {
+		if _, ok := supportedRuntimeArgs[key]; ok {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,32 +2,64 @@ package agent
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"github.com/aylei/kubectl-debug/pkg/util"
+	"github.com/aylei/kubectl-debug/pkg/version"
+	"github.com/docker/docker/api/types"
+	"io/ioutil"
 	remoteapi "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/klog"
 	kubeletremote "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
-	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	goruntime "runtime"
 	"strings"
 	"time"
 )
 
 const (
-	dockerContainerPrefix = "docker://"
+	runtimeDocker = "docker"
+
+	containerIdSeparator = "://"
+
+	// commandTimeoutMessage starts the error of a session whose command was killed
+	// by the command timeout, the plugin relies on it to report the timeout
+	commandTimeoutMessage = "command timed out after"
+	// attachTimeoutMessage starts the error of a session whose debug container
+	// was killed since it wrote nothing within the attach timeout
+	attachTimeoutMessage = "no output from the debug container within"
+	// sessionIdleMessage and maxSessionMessage start the errors of sessions reaped by the agent
+	sessionIdleMessage = "debug session closed by the agent after being idle for"
+	maxSessionMessage  = "debug session closed by the agent after reaching the maximum duration of"
 )
 
+// features are reported by the version api, so that the plugin only uses the
+// optional capabilities of the agent when they are available, command-body means
+// the command is read from the form body of the debug request as well
+var features = []string{"command-base64", "command-body", "entrypoint-args", "no-tty"}
+
 type Server struct {
 	config     *Config
 	runtimeApi *RuntimeManager
+	// authorizer is nil unless authorization is enabled
+	authorizer *authorizer
 }
 
 func NewServer(config *Config) (*Server, error) {
-	runtime, err := NewRuntimeManager(config.DockerEndpoint, config.DockerTimeout)
+	runtime, err := NewRuntimeManager(config)
 	if err != nil {
 		return nil, err
 	}
-	return &Server{config: config, runtimeApi: runtime}, nil
+	server := &Server{config: config, runtimeApi: runtime}
+	if config.Authorization {
+		if server.authorizer, err = newAuthorizer(config.AuthorizationSubresource); err != nil {
+			return nil, err
+		}
+	}
+	return server, nil
 }
 
 func (s *Server) Run() error {
@@ -36,20 +68,33 @@ func (s *Server) Run() error {
 	signal.Notify(stop, os.Interrupt)
 
 	mux := http.NewServeMux()
+	// the debug requests are authorized against their target pod, the other apis against
+	// the node, only the health check is left open for the probes of the kubelet
 	mux.HandleFunc("/api/v1/debug", s.ServeDebug)
+	mux.Handle("/api/v1/sessions", s.authorized("proxy", http.HandlerFunc(s.ListSessions)))
+	mux.Handle("/api/v1/runtime-args", s.authorized("proxy", http.HandlerFunc(s.ListRuntimeArgs)))
+	mux.Handle("/api/v1/logs", s.authorized("proxy", http.HandlerFunc(s.ServeLogs)))
+	mux.Handle("/api/v1/version", s.authorized("proxy", http.HandlerFunc(s.ServeVersion)))
 	mux.HandleFunc("/healthz", s.Healthz)
+	mux.Handle("/metrics", s.authorized("metrics", metricsHandler()))
 	server := &http.Server{Addr: s.config.ListenAddress, Handler: mux}
 
+	sweeperStop := make(chan struct{})
+	defer close(sweeperStop)
+	if s.config.GCInterval > 0 {
+		go s.runtimeApi.RunSweeper(s.config.GCInterval, sweeperStop)
+	}
+
 	go func() {
-		log.Printf("Listening on %s \n", s.config.ListenAddress)
+		klog.Infof("Listening on %s", s.config.ListenAddress)
 
 		if err := server.ListenAndServe(); err != nil {
-			log.Fatal(err)
+			klog.Fatal(err)
 		}
 	}()
 	<-stop
 
-	log.Println("shutting done server...")
+	klog.Info("shutting done server...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -58,6 +103,22 @@ func (s *Server) Run() error {
 	return nil
 }
 
+// authorized requires the access to the subresource of the nodes for the requests
+// of the handler if authorization is enabled
+func (s *Server) authorized(subresource string, handler http.Handler) http.Handler {
+	if s.authorizer == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, err := s.authorizer.authorizeNode(req, subresource); err != nil {
+			klog.Warningf("refused %s request: %v", req.URL.Path, err)
+			writeAuthorizationError(w, err)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
 // ServeDebug serves the debug request.
 // first, it will upgrade the connection to SPDY.
 // then, server will try to create the debug container, and sent creating progress to user via SPDY.
@@ -66,54 +127,324 @@ func (s *Server) Run() error {
 // if any error occurs above, an error status were written to the user's stderr.
 func (s *Server) ServeDebug(w http.ResponseWriter, req *http.Request) {
 
-	log.Println("receive debug request")
+	klog.V(2).Info("receive debug request")
+	// a standalone debug container joins the host namespaces instead of a target container
+	noJoin := req.FormValue("nojoin") == "true"
 	containerId := req.FormValue("container")
-	if len(containerId) < 1 {
-		http.Error(w, "target container id must be provided", 400)
+	// the runtime is detected from the container id prefix, e.g. containerd://ID,
+	// the standalone debug container runs on the forced runtime or docker
+	runtime, bareContainerId := req.FormValue("runtime"), ""
+	if !noJoin {
+		if len(containerId) < 1 {
+			http.Error(w, "target container id must be provided", 400)
+			return
+		}
+		runtime, bareContainerId = parseContainerId(containerId, runtime)
+	}
+	if len(runtime) < 1 {
+		runtime = runtimeDocker
+	}
+	if runtime != runtimeDocker && runtime != runtimeContainerd && runtime != runtimeCrio {
+		http.Error(w, fmt.Sprintf("unsupported container runtime %q, only docker, containerd and cri-o are supported", runtime), 400)
 		return
 	}
-	if !strings.HasPrefix(containerId, dockerContainerPrefix) {
-		http.Error(w, "only docker container is suppored right now", 400)
+	// on windows, the agent runs as a HostProcess container and the command as its process
+	if goruntime.GOOS == "windows" {
+		if !noJoin {
+			http.Error(w, fmt.Sprintf("cannot debug container %s: %s", containerId, hostProcessWindowsMessage), 400)
+			return
+		}
+		runtime = runtimeHostProcess
+	}
+
+	user := req.FormValue("user")
+	if s.authorizer != nil {
+		// a standalone debug container is authorized against the node instead of the pod
+		namespace, pod := req.FormValue("namespace"), req.FormValue("pod")
+		if noJoin {
+			namespace, pod = "", ""
+		}
+		var err error
+		if user, err = s.authorizer.authorize(req, namespace, pod, containerId); err != nil {
+			klog.Warningf("refused debug request: %v", err)
+			sessionsFailed.WithLabelValues(runtime, stageUnauthorized).Inc()
+			s.runtimeApi.auditor.write(&AuditRecord{
+				Event: auditRefused,
+				// the user is not authenticated, this is the one the client claims
+				User:              req.FormValue("user"),
+				ClientAddress:     req.RemoteAddr,
+				Namespace:         req.FormValue("namespace"),
+				Pod:               req.FormValue("pod"),
+				Container:         req.FormValue("containerName"),
+				TargetContainerID: containerId,
+				Runtime:           runtime,
+				Image:             req.FormValue("image"),
+				Error:             err.Error(),
+			})
+			writeAuthorizationError(w, err)
+			return
+		}
 	}
-	dockerContainerId := containerId[len(dockerContainerPrefix):]
 
 	image := req.FormValue("image")
 	if len(image) < 1 {
 		http.Error(w, "image must be provided", 400)
 		return
 	}
-	command := req.FormValue("command")
-	var commandSlice []string
-	err := json.Unmarshal([]byte(command), &commandSlice)
+	commandSlice, err := parseCommand(req.FormValue("command"), req.FormValue("commandencoding"))
 	if err != nil || len(commandSlice) < 1 {
 		http.Error(w, "cannot parse command", 400)
 		return
 	}
+	var args []string
+	if len(req.FormValue("args")) > 0 {
+		if args, err = parseCommand(req.FormValue("args"), req.FormValue("commandencoding")); err != nil {
+			http.Error(w, "cannot parse args", 400)
+			return
+		}
+	}
 
+	runtimeArgs, err := parseRuntimeArgs(req.Form["runtimeArg"], s.config.AllowedRuntimeArgs)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	env := req.Form["env"]
+	for _, e := range env {
+		if !strings.Contains(e, "=") {
+			http.Error(w, fmt.Sprintf("invalid env %q, must be KEY=VALUE", e), 400)
+			return
+		}
+	}
+
+	logsSession := req.FormValue("logsSession")
+	if len(logsSession) > 0 && !validLogsSession(logsSession) {
+		http.Error(w, "invalid logs session", 400)
+		return
+	}
+
+	// tty is enabled unless the client asks for a binary-safe stream,
+	// in which case stdout and stderr are streamed separately
+	tty := req.FormValue("tty") != "false"
 	streamOpts := &kubeletremote.Options{
 		Stdin:  true,
 		Stdout: true,
-		Stderr: false,
-		TTY:    true,
+		Stderr: !tty,
+		TTY:    tty,
+	}
+
+	var commandTimeout time.Duration
+	if len(req.FormValue("commandtimeout")) > 0 {
+		commandTimeout, err = time.ParseDuration(req.FormValue("commandtimeout"))
+		if err != nil || commandTimeout < 0 {
+			http.Error(w, "invalid command timeout", 400)
+			return
+		}
+	}
+
+	dnsServers, dnsSearches := req.Form["dnsServer"], req.Form["dnsSearch"]
+	if err := validateDNS(dnsServers, dnsSearches); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	var attachTimeout time.Duration
+	if len(req.FormValue("attachtimeout")) > 0 {
+		attachTimeout, err = time.ParseDuration(req.FormValue("attachtimeout"))
+		if err != nil || attachTimeout < 0 {
+			http.Error(w, "invalid attach timeout", 400)
+			return
+		}
+	}
+
+	volumes, err := parseVolumes(req.Form["volume"])
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if noJoin && len(volumes) > 0 {
+		http.Error(w, "volumes require a target container", 400)
+		return
+	}
+
+	limits, err := resourceLimits(req.FormValue("cpu"), req.FormValue("memory"), s.config)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	registryAuth, err := s.registryAuth(req, image)
+	if err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+
+	debugConfig := &DebugConfig{
+		Image:   image,
+		Command: commandSlice,
+		Args:    args,
+		Arch:    req.FormValue("arch"),
+
+		ForceInitialResize: req.FormValue("forceresize") == "true",
+		RuntimeArgs:        runtimeArgs,
+		LogsSession:        logsSession,
+		Env:                env,
+		QuietPull:          req.FormValue("quietpull") == "true",
+		CommandTimeout:     commandTimeout,
+		AttachTimeout:      attachTimeout,
+		Retain:             req.FormValue("retain") == "true",
+		ReportExitCode:     req.FormValue("exitcode") == "true",
+		DNSServers:         dnsServers,
+		DNSSearches:        dnsSearches,
+		RegistryAuth:       registryAuth,
+		Limits:             limits,
+		Volumes:            volumes,
+		Lxcfs:              s.config.Lxcfs || req.FormValue("lxcfs") == "true",
+	}
+	session := &Session{
+		TargetContainerID: containerId,
+		User:              user,
+		Namespace:         req.FormValue("namespace"),
+		Pod:               req.FormValue("pod"),
+		Container:         req.FormValue("containerName"),
+		Image:             image,
+		Command:           append(commandSlice, args...),
 	}
 
 	context, cancel := context.WithCancel(req.Context())
 	defer cancel()
 
+	attacher := s.runtimeApi.GetAttacher(runtime, debugConfig, session, context, cancel)
+	if s.runtimeApi.auditor != nil {
+		attacher.audit = &AuditRecord{
+			User:              user,
+			UserVerified:      s.authorizer != nil,
+			ClientAddress:     req.RemoteAddr,
+			Namespace:         session.Namespace,
+			Pod:               session.Pod,
+			Container:         session.Container,
+			TargetContainerID: containerId,
+			Runtime:           runtime,
+			Image:             image,
+			Command:           session.Command,
+		}
+	}
+	if debugConfig.ReportExitCode {
+		// only ServeExec reports a non-zero exit code to the client, older plugins
+		// do not ask for it and would take it as a failure of the session
+		kubeletremote.ServeExec(
+			w,
+			req,
+			attacher,
+			"",
+			"",
+			bareContainerId,
+			append(commandSlice, args...),
+			streamOpts,
+			s.config.StreamIdleTimeout,
+			s.config.StreamCreationTimeout,
+			remoteapi.SupportedStreamingProtocols)
+		return
+	}
 	// replace Attacher implementation to hook the ServeAttach procedure
 	kubeletremote.ServeAttach(
 		w,
 		req,
-		s.runtimeApi.GetAttacher(image, commandSlice, context, cancel),
+		attacher,
 		"",
 		"",
-		dockerContainerId,
+		bareContainerId,
 		streamOpts,
 		s.config.StreamIdleTimeout,
 		s.config.StreamCreationTimeout,
 		remoteapi.SupportedStreamingProtocols)
 }
 
+// registryAuth returns the credentials for pulling the image, sent by the client or,
+// if it sends none, found in the docker config of the node when configured
+func (s *Server) registryAuth(req *http.Request, image string) (*types.AuthConfig, error) {
+	if header := req.Header.Get(term.RegistryAuthHeader); len(header) > 0 {
+		return term.DecodeRegistryAuth(header)
+	}
+	if len(s.config.RegistryConfig) < 1 {
+		return nil, nil
+	}
+	config, err := ioutil.ReadFile(s.config.RegistryConfig)
+	if err == nil {
+		var auth *types.AuthConfig
+		if auth, err = term.RegistryAuth(config, image); err == nil {
+			return auth, nil
+		}
+	}
+	// the config of the node is best-effort, public images are still pulled
+	klog.Warningf("cannot use registry config %s, pulling anonymously: %v", s.config.RegistryConfig, err)
+	return nil, nil
+}
+
+// parseContainerId splits the container id reported in the pod status, e.g. docker://<id>,
+// into the runtime and the bare id. A runtime forced by the request takes precedence over the prefix.
+func parseContainerId(containerId, forcedRuntime string) (string, string) {
+	runtime := ""
+	if i := strings.Index(containerId, containerIdSeparator); i >= 0 {
+		runtime = containerId[:i]
+		containerId = containerId[i+len(containerIdSeparator):]
+	}
+	if len(forcedRuntime) > 0 {
+		runtime = forcedRuntime
+	}
+	return runtime, containerId
+}
+
+// ListSessions writes the active debug sessions of this agent as a json array
+func (s *Server) ListSessions(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.runtimeApi.sessions.List()); err != nil {
+		klog.Errorf("error writing sessions: %v", err)
+	}
+}
+
+// ListRuntimeArgs advertises the runtime args which are allowed by this agent
+func (s *Server) ListRuntimeArgs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(allowedRuntimeArgs(s.config.AllowedRuntimeArgs)); err != nil {
+		klog.Errorf("error writing runtime args: %v", err)
+	}
+}
+
+// ServeVersion reports the version of this agent, which lets the plugin check the compatibility
+func (s *Server) ServeVersion(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	info := struct {
+		Version  string   `json:"version"`
+		Features []string `json:"features"`
+	}{Version: version.Version, Features: features}
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		klog.Errorf("error writing version: %v", err)
+	}
+}
+
 func (s *Server) Healthz(w http.ResponseWriter, req *http.Request) {
 	w.Write([]byte("I'm OK!"))
 }
+
+// parseCommand decodes the json list of the command, base64 encoded by
+// newer plugins to keep complex commands out of the query string
+func parseCommand(command string, encoding string) ([]string, error) {
+	switch encoding {
+	case "":
+	case "base64":
+		decoded, err := base64.RawURLEncoding.DecodeString(command)
+		if err != nil {
+			return nil, err
+		}
+		command = string(decoded)
+	default:
+		return nil, fmt.Errorf("unsupported command encoding %q", encoding)
+	}
+	var commandSlice []string
+	if err := json.Unmarshal([]byte(command), &commandSlice); err != nil {
+		return nil, err
+	}
+	return commandSlice, nil
+}
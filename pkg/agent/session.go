@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Session describes an active debug session served by this agent
+type Session struct {
+	// ContainerID is the id of the debug container
+	ContainerID string `json:"containerID"`
+	// TargetContainerID is the id of the container being debugged
+	TargetContainerID string    `json:"targetContainerID"`
+	User              string    `json:"user,omitempty"`
+	Namespace         string    `json:"namespace,omitempty"`
+	Pod               string    `json:"pod,omitempty"`
+	Container         string    `json:"container,omitempty"`
+	Image             string    `json:"image"`
+	Command           []string  `json:"command"`
+	StartTime         time.Time `json:"startTime"`
+}
+
+// SessionManager keeps track of the debug sessions which are currently active
+type SessionManager struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+func NewSessionManager() *SessionManager {
+	return &SessionManager{sessions: make(map[string]*Session)}
+}
+
+// Add registers the session, keyed by its debug container id
+func (m *SessionManager) Add(session *Session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[session.ContainerID] = session
+}
+
+// Remove unregisters the session of the given debug container
+func (m *SessionManager) Remove(containerID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, containerID)
+}
+
+// List returns a snapshot of the active sessions, oldest first
+func (m *SessionManager) List() []Session {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make([]Session, 0, len(m.sessions))
+	for _, s := range m.sessions {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	return result
+}
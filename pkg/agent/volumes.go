@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// VolumeMount is a volume of the target pod mounted in the debug container at Path,
+// which is its mount path in the target container
+type VolumeMount struct {
+	Name string
+	Path string
+}
+
+// volumeBind is a bind mount of the target container, or of the debug container
+type volumeBind struct {
+	source      string
+	destination string
+	readOnly    bool
+}
+
+// parseVolumes parses the NAME:PATH volumes of the request
+func parseVolumes(values []string) ([]VolumeMount, error) {
+	var volumes []VolumeMount
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || len(parts[0]) < 1 || !path.IsAbs(parts[1]) {
+			return nil, fmt.Errorf("invalid volume %q, must be NAME:PATH with an absolute path", value)
+		}
+		volumes = append(volumes, VolumeMount{Name: parts[0], Path: path.Clean(parts[1])})
+	}
+	return volumes, nil
+}
+
+// volumeBinds returns the bind mounts of the volumes in the debug container, with the
+// sources and the access mode of the mounts of the target container at the same paths
+func volumeBinds(volumes []VolumeMount, targetMounts []volumeBind) ([]volumeBind, error) {
+	var binds []volumeBind
+	for _, volume := range volumes {
+		found := false
+		for _, mount := range targetMounts {
+			if path.Clean(mount.destination) == volume.Path {
+				binds = append(binds, volumeBind{source: mount.source, destination: volume.Path, readOnly: mount.readOnly})
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("volume %s is not mounted at %s in the target container", volume.Name, volume.Path)
+		}
+	}
+	return binds, nil
+}
+
+// ociMount is a mount of an oci runtime spec, as reported by ctr and crictl
+type ociMount struct {
+	Destination string   `json:"destination"`
+	Source      string   `json:"source"`
+	Options     []string `json:"options"`
+}
+
+// ociBinds converts the mounts of an oci runtime spec
+func ociBinds(mounts []ociMount) []volumeBind {
+	var binds []volumeBind
+	for _, mount := range mounts {
+		binds = append(binds, volumeBind{source: mount.Source, destination: mount.Destination, readOnly: contains(mount.Options, "ro")})
+	}
+	return binds
+}
+
+// bindOptions returns the options of a bind mount for ctr
+func (b volumeBind) bindOptions() string {
+	if b.readOnly {
+		return "rbind:ro"
+	}
+	return "rbind:rw"
+}
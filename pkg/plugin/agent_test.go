@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	remoteapi "k8s.io/apimachinery/pkg/util/remotecommand"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	kubeletremote "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
+)
+
+// execFunc runs the debug command in a fake agent
+type execFunc func(in io.Reader, out, errOut io.WriteCloser) error
+
+func (f execFunc) ExecInContainer(name string, uid types.UID, container string, cmd []string, in io.Reader, out, errOut io.WriteCloser, tty bool, resize <-chan remotecommand.TerminalSize, timeout time.Duration) error {
+	return f(in, out, errOut)
+}
+
+// newFakeAgent serves the debug stream like the agent, without tty, running exec as the command
+func newFakeAgent(exec execFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		opts := &kubeletremote.Options{Stdin: true, Stdout: true, Stderr: true}
+		kubeletremote.ServeExec(w, req, exec, "", "", "", []string{"debug"}, opts,
+			time.Minute, 10*time.Second, remoteapi.SupportedStreamingProtocols)
+	}))
+}
+
+// newStreamOptions returns the options of a session without tty streaming to the fake agent
+func newStreamOptions(t *testing.T, agent *httptest.Server, in io.Reader, out, errOut io.Writer) (*DebugOptions, *url.URL) {
+	uri, err := url.Parse(agent.URL + "/api/v1/debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &DebugOptions{Config: &restclient.Config{Host: agent.URL}, Stdin: true, StdinOnce: true}
+	o.In, o.Out, o.ErrOut = in, out, errOut
+	return o, uri
+}
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	restclient "k8s.io/client-go/rest"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// agentRequestTimeout bounds the plain http requests to the agent, e.g. listing its sessions
+const agentRequestTimeout = 10 * time.Second
+
+// dialAgent returns the base url of the agent the way the debug session reaches it:
+// rendered by agentURL, then tunneled through --ssh-bastion or forwarded by --port-forward
+// to agentPod in agentNamespace, or to the pod of the DaemonSet on the node if agentPod
+// is empty. The returned func closes the tunnel or the forward
+func (o *DebugOptions) dialAgent(params agentURLParams, agentNamespace string, agentPod string) (*url.URL, func(), error) {
+	agentURL, err := o.agentURL(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	if o.UseSSHBastion {
+		tunnel, err := newSSHTunnel(o.SSHBastion, agentHostPort(agentURL), o.KeepaliveInterval)
+		if err != nil {
+			return nil, nil, err
+		}
+		agentURL.Host = tunnel.LocalAddr()
+		return agentURL, func() { tunnel.Close() }, nil
+	}
+	if o.PortForward {
+		if len(agentPod) < 1 {
+			if agentPod, err = o.agentPodOnNode(params.NodeName); err != nil {
+				return nil, nil, err
+			}
+		}
+		forward, err := o.newAgentPortForward(agentNamespace, agentPod, o.AgentPort)
+		if err != nil {
+			return nil, nil, err
+		}
+		agentURL.Host = forward.LocalAddr()
+		return agentURL, forward.Close, nil
+	}
+	return agentURL, func() {}, nil
+}
+
+// agentHTTPClient returns the client of the plain requests to the agent, which verifies
+// https agents with the tls config of the debug stream and sends the credentials of the
+// kubeconfig like it, for the agents with authorization
+func (o *DebugOptions) agentHTTPClient(timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := restclient.TLSConfigFor(o.Config)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := restclient.HTTPWrappersForConfig(o.Config, utilnet.SetTransportDefaults(&http.Transport{TLSClientConfig: tlsConfig}))
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// TestAgentHTTPClientSendsCredentials checks that the plain requests authenticate
+// like the debug stream, for agents with authorization
+func TestAgentHTTPClientSendsCredentials(t *testing.T) {
+	var header string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header.Get("Authorization")
+		w.Write([]byte(`{"version":"0.2.0","features":["no-tty"]}`))
+	}))
+	defer agent.Close()
+	agentURL, err := url.Parse(agent.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &DebugOptions{Config: &restclient.Config{Host: "https://api.example.com", BearerToken: "token"}}
+
+	client, err := o.agentHTTPClient(agentRequestTimeout)
+	if err != nil {
+		t.Fatalf("error creating the agent client: %v", err)
+	}
+	info, err := getAgentInfo(client, agentURL)
+	if err != nil {
+		t.Fatalf("error getting the agent version: %v", err)
+	}
+	if info.Version != "0.2.0" {
+		t.Errorf("got version %q, want 0.2.0", info.Version)
+	}
+	if header != "Bearer token" {
+		t.Errorf("got Authorization header %q, want the bearer token of the kubeconfig", header)
+	}
+}
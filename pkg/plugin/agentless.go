@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+const (
+	defaultAgentImage = "aylei/debug-agent:latest"
+	// agentPodReadyTimeout bounds the wait for the temporary agent pod, which includes pulling its image
+	agentPodReadyTimeout = 2 * time.Minute
+	agentPodLabel        = "kubectl-debug/agentless"
+	// temporaryPodDeadline is the activeDeadlineSeconds of the temporary pods, which stops
+	// them if the plugin dies before deleting them
+	temporaryPodDeadline = 24 * time.Hour
+
+	dockerSocket     = "/var/run/docker.sock"
+	containerdSocket = "/run/containerd/containerd.sock"
+	// ctrPath is where the agent finds the ctr cli of containerd, mounted from the node
+	ctrPath    = "/usr/local/bin/ctr"
+	crioSocket = "/var/run/crio/crio.sock"
+	// crictlPath is where the agent finds the crictl cli of cri-o, mounted from the node
+	crictlPath    = "/usr/local/bin/crictl"
+	resolvConfDir = "/var/lib/kubectl-debug/resolv"
+	// lxcfsDir is the mount point of lxcfs on the node
+	lxcfsDir = "/var/lib/lxcfs"
+)
+
+// startAgentPod creates a temporary agent pod on the node and returns its name once it
+// is ready, the returned func deletes the pod and must be called when the session ends
+func (o *DebugOptions) startAgentPod(nodeName string, runtime string) (string, func(), error) {
+	agentPod := o.agentPod(nodeName, runtime)
+	fmt.Fprintf(o.messageOut(), "Starting a temporary agent on node %s\n", nodeName)
+	created, err := o.PodClient.Pods(o.Namespace).Create(agentPod)
+	if err != nil {
+		return "", nil, explainForbidden(err, "create", "pods", "", o.Namespace)
+	}
+	cleanup := o.onInterrupt(func() {
+		zero := int64(0)
+		err := o.PodClient.Pods(o.Namespace).Delete(created.Name, &v1.DeleteOptions{GracePeriodSeconds: &zero})
+		if err != nil {
+			fmt.Fprintf(o.messageOut(), "warning: error deleting agent pod %s: %v\n", created.Name, err)
+		}
+	})
+
+	err = wait.PollImmediate(readyPollInterval, agentPodReadyTimeout, func() (bool, error) {
+		current, err := o.PodClient.Pods(o.Namespace).Get(created.Name, v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if current.Status.Phase == corev1.PodSucceeded || current.Status.Phase == corev1.PodFailed {
+			return false, fmt.Errorf("agent pod %s exited; current phase is %s", created.Name, current.Status.Phase)
+		}
+		return containerReady(current, "debug-agent"), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		err = fmt.Errorf("agent pod %s is still not ready after waiting %s, check it with `kubectl describe pod %s -n %s`",
+			created.Name, agentPodReadyTimeout, created.Name, o.Namespace)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return created.Name, cleanup, nil
+}
+
+// agentPod returns the spec of a temporary agent on the node, like the debug-agent
+// DaemonSet but with the socket of the given runtime only. The agent only listens on
+// the loopback of the node with --port-forward, and authorizes the requests otherwise
+func (o *DebugOptions) agentPod(nodeName string, runtime string) *corev1.Pod {
+	hostPathSocket := corev1.HostPathSocket
+	hostPathFile := corev1.HostPathFile
+	hostPathDirectory := corev1.HostPathDirectoryOrCreate
+	volumes := []corev1.Volume{
+		{Name: "resolv", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: resolvConfDir, Type: &hostPathDirectory}}},
+	}
+	switch runtime {
+	case "containerd":
+		volumes = append(volumes,
+			corev1.Volume{Name: "runtime", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: containerdSocket, Type: &hostPathSocket}}},
+			corev1.Volume{Name: "ctr", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: ctrPath, Type: &hostPathFile}}})
+	case "cri-o":
+		volumes = append(volumes,
+			corev1.Volume{Name: "runtime", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: crioSocket, Type: &hostPathSocket}}},
+			corev1.Volume{Name: "crictl", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: crictlPath, Type: &hostPathFile}}})
+	default:
+		volumes = append(volumes,
+			corev1.Volume{Name: "runtime", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: dockerSocket, Type: &hostPathSocket}}})
+	}
+	if o.Lxcfs {
+		volumes = append(volumes,
+			corev1.Volume{Name: "lxcfs", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: lxcfsDir, Type: &hostPathDirectory}}})
+	}
+	var mounts []corev1.VolumeMount
+	for _, volume := range volumes {
+		// every host path is mounted at the same path in the agent
+		mounts = append(mounts, corev1.VolumeMount{Name: volume.Name, MountPath: volume.HostPath.Path})
+	}
+	if o.Lxcfs {
+		// lxcfs is a fuse mount under its directory, which must show up in the agent
+		hostToContainer := corev1.MountPropagationHostToContainer
+		mounts[len(mounts)-1].MountPropagation = &hostToContainer
+	}
+
+	args := []string{"-listen.address", fmt.Sprintf("0.0.0.0:%d", o.AgentPort), "-authorization"}
+	probeHost := ""
+	if o.PortForward {
+		// the pod is on the host network, so the port-forward and the probe reach the loopback of the node
+		args = []string{"-listen.address", fmt.Sprintf("127.0.0.1:%d", o.AgentPort)}
+		probeHost = "127.0.0.1"
+	}
+	deadline := int64(temporaryPodDeadline.Seconds())
+
+	return &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			GenerateName: "debug-agent-",
+			Labels:       map[string]string{agentPodLabel: "true"},
+		},
+		Spec: corev1.PodSpec{
+			// bypass the scheduler, the agent must run on the node of the target pod
+			NodeName:      nodeName,
+			HostNetwork:   true,
+			HostPID:       true,
+			RestartPolicy: corev1.RestartPolicyNever,
+			// the authorization reviews the requests with the service account of the agent
+			ServiceAccountName:    o.AgentServiceAccount,
+			ActiveDeadlineSeconds: &deadline,
+			Tolerations:           []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+			Containers: []corev1.Container{{
+				Name:  "debug-agent",
+				Image: o.AgentImage,
+				Args:  args,
+				ReadinessProbe: &corev1.Probe{
+					Handler: corev1.Handler{HTTPGet: &corev1.HTTPGetAction{
+						Host: probeHost,
+						Path: "/healthz",
+						Port: intstr.FromInt(o.AgentPort),
+					}},
+					PeriodSeconds: 1,
+				},
+				VolumeMounts: mounts,
+			}},
+			Volumes: volumes,
+		},
+	}
+}
+
+// agentRuntime returns the runtime whose socket the temporary agent needs,
+// docker unless forced by --runtime or detected from the container id
+func (o *DebugOptions) agentRuntime(containerId string) string {
+	if len(o.Runtime) > 0 {
+		return o.Runtime
+	}
+	if runtime, _, err := splitContainerID(containerId); err == nil && len(runtime) > 0 {
+		return runtime
+	}
+	return "docker"
+}
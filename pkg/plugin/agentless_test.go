@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAgentPodListensOnLoopbackWithPortForward(t *testing.T) {
+	tests := []struct {
+		portForward   bool
+		wantArgs      []string
+		wantProbeHost string
+	}{
+		{portForward: true, wantArgs: []string{"-listen.address", "127.0.0.1:10027"}, wantProbeHost: "127.0.0.1"},
+		{portForward: false, wantArgs: []string{"-listen.address", "0.0.0.0:10027", "-authorization"}},
+	}
+	for _, test := range tests {
+		o := &DebugOptions{AgentPort: 10027, AgentImage: defaultAgentImage, AgentServiceAccount: "debug-agent", PortForward: test.portForward}
+		pod := o.agentPod("node1", "docker")
+
+		container := pod.Spec.Containers[0]
+		if !reflect.DeepEqual(container.Args, test.wantArgs) {
+			t.Errorf("portForward=%v: got args %q, want %q", test.portForward, container.Args, test.wantArgs)
+		}
+		if host := container.ReadinessProbe.HTTPGet.Host; host != test.wantProbeHost {
+			t.Errorf("portForward=%v: got probe host %q, want %q", test.portForward, host, test.wantProbeHost)
+		}
+		if pod.Spec.ServiceAccountName != "debug-agent" {
+			t.Errorf("portForward=%v: got service account %q, want debug-agent", test.portForward, pod.Spec.ServiceAccountName)
+		}
+		if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != int64(temporaryPodDeadline.Seconds()) {
+			t.Errorf("portForward=%v: got activeDeadlineSeconds %v, want %v", test.portForward, pod.Spec.ActiveDeadlineSeconds, temporaryPodDeadline.Seconds())
+		}
+	}
+}
+
+func TestValidateAgentlessServiceAccount(t *testing.T) {
+	tests := []struct {
+		portForward    bool
+		serviceAccount string
+		wantErr        bool
+	}{
+		{wantErr: true},
+		{serviceAccount: "debug-agent"},
+		{portForward: true},
+	}
+	for _, test := range tests {
+		o := &DebugOptions{PodName: "mypod", Command: []string{"bash"}, Image: defaultImage, WatchTimeout: defaultWatchTimeout, CommandEncoding: commandEncodingAuto,
+			Agentless: true, PortForward: test.portForward, AgentServiceAccount: test.serviceAccount}
+		err := o.Validate()
+		if test.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "--agent-service-account") {
+				t.Errorf("portForward=%v serviceAccount=%q: got error %v, want --agent-service-account required", test.portForward, test.serviceAccount, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("portForward=%v serviceAccount=%q: unexpected error %v", test.portForward, test.serviceAccount, err)
+		}
+	}
+}
+
+func TestInterruptCleanupsRunOnce(t *testing.T) {
+	o := &DebugOptions{}
+	var calls []string
+	first := o.onInterrupt(func() { calls = append(calls, "first") })
+	o.onInterrupt(func() { calls = append(calls, "second") })
+
+	// the session ended normally for the first, then the plugin is interrupted
+	first()
+	o.runInterruptCleanups()
+	o.runInterruptCleanups()
+	first()
+
+	if want := []string{"first", "second"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got cleanups %q, want %q", calls, want)
+	}
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	agentPortAnnotation   = "debug.kubectl.io/agent-port"
+	agentSchemeAnnotation = "debug.kubectl.io/agent-scheme"
+	agentPathAnnotation   = "debug.kubectl.io/agent-path"
+)
+
+// agentAnnotations are the annotations of the pod which may be honoured by agent_annotations
+var agentAnnotations = []string{agentPortAnnotation, agentSchemeAnnotation, agentPathAnnotation}
+
+// agentURLParams are the fields available in --agent-url-template
+type agentURLParams struct {
+	HostIP    string
+	NodeName  string
+	Port      int
+	Namespace string
+	Pod       string
+}
+
+// agentURL returns the base url of the agent api, rendered from --agent-url-template
+// if set, http://HOST_IP:PORT otherwise
+func (o *DebugOptions) agentURL(params agentURLParams) (*url.URL, error) {
+	if len(o.AgentURLTemplate) < 1 {
+		scheme := o.agentScheme
+		if len(scheme) < 1 {
+			scheme = "http"
+		}
+		return &url.URL{Scheme: scheme, Host: net.JoinHostPort(params.HostIP, strconv.Itoa(params.Port)), Path: o.agentPath}, nil
+	}
+	tmpl, err := template.New("agent-url").Option("missingkey=error").Parse(o.AgentURLTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --agent-url-template: %v", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, params); err != nil {
+		return nil, fmt.Errorf("cannot render --agent-url-template: %v", err)
+	}
+	uri, err := url.Parse(rendered.String())
+	if err != nil {
+		return nil, fmt.Errorf("--agent-url-template rendered an invalid url %q: %v", rendered.String(), err)
+	}
+	if (uri.Scheme != "http" && uri.Scheme != "https") || len(uri.Host) < 1 {
+		return nil, fmt.Errorf("--agent-url-template rendered %q, which is not an absolute http(s) url", rendered.String())
+	}
+	return uri, nil
+}
+
+// applyAgentAnnotations takes the port, scheme and path of the agent from the annotations
+// of the pod, which are inherited from the workload. Only the annotations listed in
+// agent_annotations of the debug config are honoured. The port annotation is ignored if
+// the port is set by --port or a config-first config file, the annotations are
+// ignored entirely with --agent-url-template.
+func (o *DebugOptions) applyAgentAnnotations(pod *corev1.Pod) error {
+	annotations := map[string]string{}
+	for _, annotation := range agentAnnotations {
+		value, ok := pod.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		if !o.agentAnnotationAllowed(annotation) {
+			fmt.Fprintf(o.messageOut(), "ignoring annotation %s of pod %s, it is not listed in agent_annotations of the debug config\n",
+				annotation, pod.Name)
+			continue
+		}
+		annotations[annotation] = value
+	}
+	if value, ok := annotations[agentPortAnnotation]; ok && !o.agentPortExplicit {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid annotation %s=%q of pod %s, must be a port number", agentPortAnnotation, value, pod.Name)
+		}
+		o.AgentPort = port
+	}
+	if value, ok := annotations[agentSchemeAnnotation]; ok {
+		if value != "http" && value != "https" {
+			return fmt.Errorf("invalid annotation %s=%q of pod %s, must be http or https", agentSchemeAnnotation, value, pod.Name)
+		}
+		o.agentScheme = value
+	}
+	if value, ok := annotations[agentPathAnnotation]; ok {
+		if !strings.HasPrefix(value, "/") {
+			return fmt.Errorf("invalid annotation %s=%q of pod %s, must be an absolute path", agentPathAnnotation, value, pod.Name)
+		}
+		o.agentPath = value
+	}
+	return nil
+}
+
+func (o *DebugOptions) agentAnnotationAllowed(annotation string) bool {
+	for _, allowed := range o.AgentAnnotations {
+		if allowed == annotation {
+			return true
+		}
+	}
+	return false
+}
+
+func isAgentAnnotation(annotation string) bool {
+	for _, supported := range agentAnnotations {
+		if annotation == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// agentAPI returns the url of an api of the agent
+func agentAPI(base *url.URL, path string, query url.Values) *url.URL {
+	uri := *base
+	uri.Path = strings.TrimSuffix(base.Path, "/") + path
+	uri.RawQuery = query.Encode()
+	return &uri
+}
+
+// agentHostPort returns the host:port of the agent url, which is dialed
+func agentHostPort(base *url.URL) string {
+	if len(base.Port()) > 0 {
+		return base.Host
+	}
+	if base.Scheme == "https" {
+		return net.JoinHostPort(base.Hostname(), "443")
+	}
+	return net.JoinHostPort(base.Hostname(), "80")
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestApplyAgentAnnotations(t *testing.T) {
+	pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "web", Annotations: map[string]string{
+		agentPortAnnotation:   "10443",
+		agentSchemeAnnotation: "https",
+		agentPathAnnotation:   "/debug-agent",
+	}}}
+	tests := []struct {
+		name    string
+		allowed []string
+		want    string
+		warned  bool
+	}{
+		{name: "none allowed", want: "http://10.0.0.1:10027", warned: true},
+		{name: "port allowed", allowed: []string{agentPortAnnotation}, want: "http://10.0.0.1:10443", warned: true},
+		{name: "all allowed", allowed: agentAnnotations, want: "https://10.0.0.1:10443/debug-agent"},
+	}
+	for _, test := range tests {
+		var messages bytes.Buffer
+		o := &DebugOptions{AgentPort: 10027, AgentAnnotations: test.allowed}
+		o.ErrOut = &messages
+		if err := o.applyAgentAnnotations(pod); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		agentURL, err := o.agentURL(agentURLParams{HostIP: "10.0.0.1", Port: o.AgentPort})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if agentURL.String() != test.want {
+			t.Errorf("%s: got agent url %s, want %s", test.name, agentURL, test.want)
+		}
+		if warned := strings.Contains(messages.String(), "not listed in agent_annotations"); warned != test.warned {
+			t.Errorf("%s: got warning %q, want a warning: %v", test.name, messages.String(), test.warned)
+		}
+	}
+}
+
+func TestConfigValidateAgentAnnotations(t *testing.T) {
+	if err := (&Config{AgentAnnotations: []string{agentPortAnnotation}}).validate(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (&Config{AgentAnnotations: []string{"debug.kubectl.io/agent-host"}}).validate(); err == nil {
+		t.Errorf("expected an error for an unsupported annotation")
+	}
+}
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	ansiText = iota
+	// ansiEscape follows an ESC
+	ansiEscape
+	// ansiCSI is inside a control sequence, e.g. ESC [ 1 ; 2 H
+	ansiCSI
+	// ansiOSC is inside an operating system command, e.g. ESC ] 0 ; title BEL
+	ansiOSC
+	// ansiOSCEscape follows an ESC inside an operating system command
+	ansiOSCEscape
+)
+
+// ansiParser follows the ANSI escape sequences of a stream byte by byte, so
+// that sequences split across writes are recognized
+type ansiParser struct {
+	state int
+}
+
+// text returns true if b is not part of an escape sequence
+func (p *ansiParser) text(b byte) bool {
+	switch p.state {
+	case ansiEscape:
+		switch b {
+		case '[':
+			p.state = ansiCSI
+		case ']':
+			p.state = ansiOSC
+		default:
+			p.state = ansiText
+		}
+	case ansiCSI:
+		if b >= 0x40 && b <= 0x7e {
+			p.state = ansiText
+		}
+	case ansiOSC:
+		if b == 0x07 {
+			p.state = ansiText
+		} else if b == 0x1b {
+			p.state = ansiOSCEscape
+		}
+	case ansiOSCEscape:
+		p.state = ansiText
+	default:
+		if b == 0x1b {
+			p.state = ansiEscape
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// ansiStripper removes the ANSI escape sequences from what is written to it,
+// other control characters are kept
+type ansiStripper struct {
+	out    io.Writer
+	parser ansiParser
+	buf    []byte
+	lock   sync.Mutex
+}
+
+func newANSIStripper(out io.Writer) *ansiStripper {
+	return &ansiStripper{out: out}
+}
+
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.buf = s.buf[:0]
+	for _, b := range p {
+		if s.parser.text(b) {
+			s.buf = append(s.buf, b)
+		}
+	}
+	if _, err := s.out.Write(s.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
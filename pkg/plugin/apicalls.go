@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// apiCallLogger is a http.RoundTripper printing every kubernetes api request,
+// only the method, url and response status are printed, with the sensitive values
+// redacted, so that no credential leaks
+type apiCallLogger struct {
+	out    io.Writer
+	rt     http.RoundTripper
+	redact func(string) string
+}
+
+func newAPICallLogger(out io.Writer, redact func(string) string) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &apiCallLogger{out: out, rt: rt, redact: redact}
+	}
+}
+
+func (l *apiCallLogger) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := l.rt.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintln(l.out, l.redact(fmt.Sprintf("API call: %s %s, error: %v", req.Method, req.URL.RequestURI(), err)))
+		return resp, err
+	}
+	fmt.Fprintln(l.out, l.redact(fmt.Sprintf("API call: %s %s, status: %s", req.Method, req.URL.RequestURI(), resp.Status)))
+	return resp, nil
+}
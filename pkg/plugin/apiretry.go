@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"net"
+	"net/http"
+	"time"
+)
+
+const defaultAPIRetries = 3
+
+// apiRetryBackoff spaces the retries of --api-retries, doubling from half a second
+var apiRetryBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+}
+
+// getPod gets the target pod, retrying up to --api-retries times on transient
+// errors of the api server such as the blips of a leader election
+func (o *DebugOptions) getPod() (*corev1.Pod, error) {
+	var pod *corev1.Pod
+	var lastErr error
+	backoff := apiRetryBackoff
+	backoff.Steps = o.APIRetries + 1
+	attempt := 0
+	err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		attempt++
+		pod, lastErr = o.PodClient.Pods(o.Namespace).Get(o.PodName, v1.GetOptions{})
+		if lastErr == nil {
+			return true, nil
+		}
+		if !retryableAPIError(lastErr) {
+			return false, lastErr
+		}
+		if attempt <= o.APIRetries {
+			fmt.Fprintf(o.messageOut(), "error getting pod %s, retrying: %v\n", o.PodName, o.redact(lastErr.Error()))
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, lastErr
+	}
+	return pod, explainForbidden(err, "get", "pod", o.PodName, o.Namespace)
+}
+
+// retryableAPIError returns true for the errors which may go away on their own,
+// i.e. server errors, throttling and network timeouts, but not for terminal ones
+// such as NotFound or Forbidden
+func retryableAPIError(err error) bool {
+	if status, ok := err.(errors.APIStatus); ok {
+		code := status.Status().Code
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
+	}
+	return utilnet.IsConnectionReset(err) || utilnet.IsProbableEOF(err)
+}
@@ -0,0 +1,103 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var podsResource = schema.GroupResource{Resource: "pods"}
+
+// timeoutError is a net.Error timing out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryableAPIError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "internal error", err: errors.NewInternalError(fmt.Errorf("etcd leader changed")), want: true},
+		{name: "service unavailable", err: errors.NewServiceUnavailable("leader election"), want: true},
+		{name: "too many requests", err: errors.NewTooManyRequests("throttled", 1), want: true},
+		{name: "server timeout", err: errors.NewServerTimeout(podsResource, "get", 1), want: true},
+		{name: "net timeout", err: &net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, want: true},
+		{name: "connection reset", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, want: true},
+		{name: "eof", err: io.EOF, want: true},
+		{name: "not found", err: errors.NewNotFound(podsResource, "mypod"), want: false},
+		{name: "forbidden", err: errors.NewForbidden(podsResource, "mypod", fmt.Errorf("denied")), want: false},
+		{name: "unauthorized", err: errors.NewUnauthorized("expired token"), want: false},
+		{name: "bad request", err: errors.NewBadRequest("invalid"), want: false},
+		{name: "plain error", err: fmt.Errorf("no such host"), want: false},
+	}
+	for _, test := range tests {
+		if got := retryableAPIError(test.err); got != test.want {
+			t.Errorf("%s: retryableAPIError(%v) = %v, want %v", test.name, test.err, got, test.want)
+		}
+	}
+}
+
+// TestGetPodRetries gets the pod from an api server failing with the given errors
+// before it answers
+func TestGetPodRetries(t *testing.T) {
+	defer func(backoff time.Duration) { apiRetryBackoff.Duration = backoff }(apiRetryBackoff.Duration)
+	apiRetryBackoff.Duration = time.Millisecond
+
+	unavailable := errors.NewServiceUnavailable("leader election")
+	tests := []struct {
+		name      string
+		errs      []error
+		wantGets  int
+		wantFound bool
+	}{
+		{name: "no error", wantGets: 1, wantFound: true},
+		{name: "transient", errs: []error{unavailable, unavailable}, wantGets: 3, wantFound: true},
+		{name: "retries exhausted", errs: []error{unavailable, unavailable, unavailable, unavailable, unavailable}, wantGets: 4},
+		{name: "not found", errs: []error{errors.NewNotFound(podsResource, "mypod")}, wantGets: 1},
+		{name: "forbidden", errs: []error{errors.NewForbidden(podsResource, "mypod", fmt.Errorf("denied"))}, wantGets: 1},
+	}
+	for _, test := range tests {
+		clientset := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "mypod", Namespace: "default"}})
+		gets := 0
+		clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			gets++
+			if gets <= len(test.errs) {
+				return true, nil, test.errs[gets-1]
+			}
+			return false, nil, nil
+		})
+		out := &bytes.Buffer{}
+		o := &DebugOptions{Namespace: "default", PodName: "mypod", APIRetries: defaultAPIRetries, PodClient: clientset.CoreV1()}
+		o.Out, o.ErrOut = out, out
+
+		pod, err := o.getPod()
+		if gets != test.wantGets {
+			t.Errorf("%s: got %d gets, want %d", test.name, gets, test.wantGets)
+		}
+		if test.wantFound {
+			if err != nil || pod == nil || pod.Name != "mypod" {
+				t.Errorf("%s: got pod %v and error %v, want mypod", test.name, pod, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package plugin
+
+import (
+	"github.com/spf13/pflag"
+)
+
+// parseArgsAfterPod parses the flags between the pod and the command. Interspersed flags
+// are disabled so that cobra stops parsing at the pod, then the flags following the pod
+// are parsed up to the first argument which is not a flag, everything from there on is
+// the command, with or without --. This keeps the flags of a command given without --
+// to the command, e.g. `kubectl debug POD bash -c "ls"` does not set --container.
+func parseArgsAfterPod(flags *pflag.FlagSet, args []string, argsLenAtDash int) ([]string, error) {
+	// -- before the pod, everything after it is positional
+	if argsLenAtDash >= 0 || len(args) < 2 {
+		return args, nil
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return nil, err
+	}
+	return append([]string{args[0]}, flags.Args()...), nil
+}
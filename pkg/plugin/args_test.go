@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestParseArgsAfterPod(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		argsLenAtDash int
+		want          []string
+		wantContainer string
+		wantErr       bool
+	}{
+		{
+			name:          "flags and -- before the command",
+			args:          []string{"web", "-c", "app", "--", "ls", "-l"},
+			argsLenAtDash: -1,
+			want:          []string{"web", "ls", "-l"},
+			wantContainer: "app",
+		},
+		{
+			name:          "command without --",
+			args:          []string{"web", "bash", "-c", "ls"},
+			argsLenAtDash: -1,
+			want:          []string{"web", "bash", "-c", "ls"},
+		},
+		{
+			name:          "flags before a command without --",
+			args:          []string{"web", "-c", "app", "bash", "-c", "ls"},
+			argsLenAtDash: -1,
+			want:          []string{"web", "bash", "-c", "ls"},
+			wantContainer: "app",
+		},
+		{
+			name:          "command containing --",
+			args:          []string{"web", "-c", "app", "--", "sh", "-c", "grep -- -v file", "--", "x"},
+			argsLenAtDash: -1,
+			want:          []string{"web", "sh", "-c", "grep -- -v file", "--", "x"},
+			wantContainer: "app",
+		},
+		{
+			name:          "command without -- containing --",
+			args:          []string{"web", "git", "log", "--", "README.md"},
+			argsLenAtDash: -1,
+			want:          []string{"web", "git", "log", "--", "README.md"},
+		},
+		{
+			name:          "-- before the pod",
+			args:          []string{"web", "-c", "app"},
+			argsLenAtDash: 0,
+			want:          []string{"web", "-c", "app"},
+		},
+		{
+			name:          "pod only",
+			args:          []string{"web"},
+			argsLenAtDash: -1,
+			want:          []string{"web"},
+		},
+		{
+			name:          "unknown flag after the pod",
+			args:          []string{"web", "--bogus", "ls"},
+			argsLenAtDash: -1,
+			wantErr:       true,
+		},
+	}
+	for _, test := range tests {
+		flags := pflag.NewFlagSet("debug", pflag.ContinueOnError)
+		flags.SetInterspersed(false)
+		flags.SetOutput(ioutil.Discard)
+		container := flags.StringP("container", "c", "", "")
+		got, err := parseArgsAfterPod(flags, test.args, test.argsLenAtDash)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %q", test.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if *container != test.wantContainer {
+			t.Errorf("%s: got container %q, want %q", test.name, *container, test.wantContainer)
+		}
+	}
+}
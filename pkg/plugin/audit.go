@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/aylei/kubectl-debug/pkg/util"
+	"net/url"
+)
+
+// auditRecord is written to --audit-file and posted to --audit-webhook once a session ends
+type auditRecord struct {
+	User string `json:"user"`
+	// Reason is given by --reason
+	Reason string `json:"reason,omitempty"`
+	*sessionSummary
+	ExitCode int `json:"exitCode"`
+}
+
+func validateAuditWebhook(webhook string) error {
+	if u, err := url.Parse(webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid --audit-webhook %q, must be a http or https url", webhook)
+	}
+	return nil
+}
+
+// audit writes the audit record of the session in the background, failures are
+// reported but never fail the session
+func (o *DebugOptions) audit(summary *sessionSummary, exitCode int) {
+	if len(o.AuditFile) < 1 && len(o.AuditWebhook) < 1 {
+		return
+	}
+	record := auditRecord{
+		User:     o.currentUser(),
+		Reason:   o.Reason,
+		ExitCode: exitCode,
+	}
+	// the command is copied, as the summary is shared with --summary-template
+	auditSummary := *summary
+	auditSummary.Command = nil
+	if o.AuditRedactCommand {
+		auditSummary.Command = []string{redacted}
+	} else {
+		for _, arg := range summary.Command {
+			auditSummary.Command = append(auditSummary.Command, o.redact(arg))
+		}
+	}
+	record.sessionSummary = &auditSummary
+	bytes, err := json.Marshal(record)
+	if err != nil {
+		fmt.Fprintf(o.messageOut(), "warning: cannot encode audit record: %v\n", err)
+		return
+	}
+	if len(o.AuditFile) > 0 {
+		if err := term.AppendAuditFile(o.AuditFile, bytes); err != nil {
+			fmt.Fprintf(o.messageOut(), "warning: cannot write audit record to %s: %v\n", o.AuditFile, err)
+		}
+	}
+	if len(o.AuditWebhook) > 0 {
+		o.audits.Add(1)
+		go func() {
+			defer o.audits.Done()
+			if err := term.PostAuditWebhook(o.AuditWebhook, bytes, ""); err != nil {
+				fmt.Fprintf(o.messageOut(), "warning: cannot post audit record: %v\n", o.redact(err.Error()))
+			}
+		}()
+	}
+}
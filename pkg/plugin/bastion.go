@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"fmt"
+	"golang.org/x/crypto/ssh"
+	sshagent "golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"k8s.io/klog"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSSHPort         = "22"
+	defaultKnownHostsFile  = "/.ssh/known_hosts"
+	sshAuthSockEnvironment = "SSH_AUTH_SOCK"
+	sshTunnelListenAddress = "127.0.0.1:0"
+)
+
+// SSHBastionConfig describes how to reach the nodes through an ssh bastion host
+type SSHBastionConfig struct {
+	// Host is the address of the bastion, in the form of host[:port]
+	Host string `yaml:"host"`
+	User string `yaml:"user"`
+	// KeyFile is the private key used to authenticate, the ssh agent is used if not set
+	KeyFile string `yaml:"key_file,omitempty"`
+	// KnownHostsFile is used to verify the bastion host key, default to ~/.ssh/known_hosts
+	KnownHostsFile        string `yaml:"known_hosts_file,omitempty"`
+	InsecureIgnoreHostKey bool   `yaml:"insecure_ignore_host_key,omitempty"`
+}
+
+func (c *SSHBastionConfig) validate() error {
+	if len(c.Host) < 1 {
+		return fmt.Errorf("ssh_bastion.host must be specified")
+	}
+	if len(c.User) < 1 {
+		return fmt.Errorf("ssh_bastion.user must be specified")
+	}
+	return nil
+}
+
+// sshTunnel forwards the connections accepted on a local port to
+// the remote address through the ssh bastion, like `ssh -L`
+type sshTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+}
+
+// newSSHTunnel connects to the bastion with tcp keepalives sent at the given interval,
+// zero leaves the keepalive of go
+func newSSHTunnel(config *SSHBastionConfig, remote string, keepalive time.Duration) (*sshTunnel, error) {
+	clientConfig, err := config.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	address := config.Host
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, defaultSSHPort)
+	}
+	conn, err := keepaliveDialer(clientConfig.Timeout, keepalive).Dial("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to ssh bastion %s: %v", address, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot connect to ssh bastion %s: %v", address, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	listener, err := net.Listen("tcp", sshTunnelListenAddress)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	tunnel := &sshTunnel{client: client, listener: listener, remote: remote}
+	go tunnel.serve()
+	return tunnel, nil
+}
+
+// LocalAddr returns the local address which is forwarded to the remote
+func (t *sshTunnel) LocalAddr() string {
+	return t.listener.Addr().String()
+}
+
+func (t *sshTunnel) Close() error {
+	t.listener.Close()
+	return t.client.Close()
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go t.forward(local)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		klog.V(2).Infof("error dialing %s through ssh bastion: %v", t.remote, err)
+		return
+	}
+	defer remote.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (c *SSHBastionConfig) clientConfig() (*ssh.ClientConfig, error) {
+	auth, err := c.authMethod()
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !c.InsecureIgnoreHostKey {
+		knownHostsFile := c.KnownHostsFile
+		if len(knownHostsFile) < 1 {
+			usr, err := user.Current()
+			if err != nil {
+				return nil, err
+			}
+			knownHostsFile = usr.HomeDir + defaultKnownHostsFile
+		}
+		hostKeyCallback, err = knownhosts.New(expandHome(knownHostsFile))
+		if err != nil {
+			return nil, fmt.Errorf("cannot load known hosts file %s: %v", knownHostsFile, err)
+		}
+	}
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+func (c *SSHBastionConfig) authMethod() (ssh.AuthMethod, error) {
+	if len(c.KeyFile) > 0 {
+		key, err := ioutil.ReadFile(expandHome(c.KeyFile))
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse ssh key %s: %v", c.KeyFile, err)
+		}
+		return ssh.PublicKeys(signer), nil
+	}
+	socket := os.Getenv(sshAuthSockEnvironment)
+	if len(socket) < 1 {
+		return nil, fmt.Errorf("ssh_bastion.key_file is not set and no ssh agent is running")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to ssh agent: %v", err)
+	}
+	return ssh.PublicKeysCallback(sshagent.NewClient(conn).Signers), nil
+}
+
+// expandHome replaces the leading ~ of the path with the home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(usr.HomeDir, path[2:])
+}
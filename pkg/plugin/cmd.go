@@ -1,72 +1,353 @@
 package plugin
 
 import (
-	"encoding/json"
+	"context"
+	"flag"
 	"fmt"
 	"github.com/aylei/kubectl-debug/pkg/util"
 	dockerterm "github.com/docker/docker/pkg/term"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"io"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	coreclient "k8s.io/client-go/kubernetes/typed/core/v1"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
-	"log"
+	"k8s.io/klog"
+	"k8s.io/kubernetes/pkg/util/interrupt"
+	"net"
+	"net/http"
 	"net/url"
+	"os"
 	"os/user"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
 const (
 	example = `
-	# debug a container in the running pod, the first container will be picked by default
+	# debug a container in the running pod, the first ready container will be picked by default
 	kubectl debug POD_NAME
 
 	# specify namespace or container
 	kubectl debug --namespace foo POD_NAME -c CONTAINER_NAME
+	kubectl debug foo/POD_NAME -c CONTAINER_NAME
+
+	# debug the pod with an ip seen in logs or metrics, in any namespace
+	kubectl debug --pod-ip 10.244.1.17 -A
 
 	# override the default troubleshooting image
 	kubectl debug POD_NAME --image aylei/debug-jvm
 
+	# pin the exact debug image by its digest
+	kubectl debug POD_NAME --image nicolaka/netshoot@sha256:DIGEST
+
 	# override entrypoint of debug container
 	kubectl debug POD_NAME --image aylei/debug-jvm /bin/bash
 
+	# flags go before the command, the first argument after the pod which is not
+	# a flag starts the command, so -- is optional
+	kubectl debug POD_NAME -c app bash -c "ls /proc/1/root"
+
 	# override the debug config file
 	kubectl debug POD_NAME --debug-config ./debug-config.yml
-`
-	longDesc = `
-Run a container in a running pod, this container will join the namespaces of an existing container of the pod.
 
-You may set default configuration such as image and command in the config file, which locates in "~/.kube/debug-config" by default.
+	# use a bundle describing the whole debug setup
+	kubectl debug POD_NAME --bundle ./debug-bundle.yml
+
+	# run a standalone debug container on the node of the pod, without joining any container
+	kubectl debug POD_NAME --no-join
+
+	# run a standalone debug container on a node, without any target pod
+	kubectl debug node/NODE_NAME --no-join
+
+	# pass extra args to the container runtime, the allowed keys are configured in the agent
+	kubectl debug POD_NAME --runtime-arg workdir=/tmp --runtime-arg user=nobody
+
+	# debug the container with the given id, e.g. taken from the node logs
+	kubectl debug POD_NAME --container-id docker://3f5e7a1c9b2d
+
+	# debug the most recent running pod of a workload, a job or the active job of a cronjob
+	kubectl debug deploy/DEPLOYMENT_NAME
+	kubectl debug sts/STATEFULSET_NAME -c CONTAINER_NAME
+	kubectl debug job/JOB_NAME
+	kubectl debug cronjob/CRONJOB_NAME
+
+	# debug a copy of a crash looping pod, with the entrypoint of the container replaced by sleep
+	kubectl debug POD_NAME --fork --fork-hold
+
+	# choose the pod of a workload from its running pods
+	kubectl debug deploy/DEPLOYMENT_NAME --pick-pod
+
+	# print the target container id and the duration once the session ends
+	kubectl debug POD_NAME --summary-template '{{.TargetContainerID}} {{.Duration}}' -- ss -tnp
+
+	# report the progress of the session to a wrapping tool as json lines on stderr
+	kubectl debug POD_NAME --json-events 2>events.json
+
+	# keep debugging a crash looping workload across the recreation of its pod
+	kubectl debug POD_NAME --watch --watch-timeout 10m --ready-wait 1m
+
+	# give up if the shell of the debug container does not come up within 30 seconds
+	kubectl debug POD_NAME --attach-timeout 30s
+
+	# list the kubeconfig contexts to confirm the cluster before debugging
+	kubectl debug contexts
+
+	# follow the logs of the target container in another terminal while debugging
+	kubectl debug POD_NAME --with-logs-pane 2>/dev/pts/1
+
+	# use other nameservers in the debug container, e.g. to rule out the cluster dns
+	kubectl debug POD_NAME --dns-server 8.8.8.8 --dns-search example.com
+
+	# set environment variables of the debug container, TERM defaults to the local $TERM
+	kubectl debug POD_NAME --term xterm --env HTTP_PROXY=http://proxy:3128
+
+	# take environment variables of the debug container from a ConfigMap and a Secret
+	kubectl debug POD_NAME --env-from-configmap tools-config --env-from-secret tools-credentials
+
+	# list the active debug sessions on a node
+	kubectl debug sessions NODE_NAME -o json
+
+	# review the debug container against admission policies without creating it
+	kubectl debug POD_NAME --runtime-arg user=nobody --output-container-spec
+
+	# capture the output of a command in files, keeping the messages of kubectl-debug on the terminal
+	kubectl debug POD_NAME --out-file ./netstat.out --err-file ./netstat.err -- netstat -tnp
+
+	# keep a plain text log of the session for a ticket
+	kubectl debug POD_NAME --transcript ./session.txt
+
+	# print the effective settings of a debug session without running it
+	kubectl debug config-dump POD_NAME --image busybox -o json
 `
 	defaultImage          = "nicolaka/netshoot:latest"
 	defaultAgentPort      = 10027
 	defaultConfigLocation = "/.kube/debug-config"
+	defaultTerm           = "xterm-256color"
+	defaultTerminalWidth  = 80
+	defaultTerminalHeight = 24
+	imageEnvironment      = "KUBECTL_DEBUG_IMAGE"
+	// defaultContainerAnnotation names the container picked when --container is not set
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
 )
 
+// longDesc is built from the actual defaults, since most flags default to
+// empty and are only resolved in Complete
+var longDesc = fmt.Sprintf(`
+Run a container in a running pod, this container will join the namespaces of an existing container of the pod.
+
+You may set default configuration such as image and command in the config file, which locates in "~%s" by default.
+
+The settings are resolved in the following order, the first one set wins:
+  image:   --image, $%s, image in the config file, %s
+  command: COMMAND after the pod, command in the config file, bash
+  port:    --port, the %s annotation of the pod, agent_port in the config file, %d
+With "precedence: %s" in the config file, the config file comes first instead.
+Run "kubectl debug config-dump POD" to print the resolved settings.
+`, defaultConfigLocation, imageEnvironment, defaultImage, agentPortAnnotation, defaultAgentPort, PrecedenceConfigFirst)
+
+// containerIDPattern matches a full or truncated container id
+var containerIDPattern = regexp.MustCompile(`^[0-9a-f]{12,64}$`)
+
 // DebugOptions specify how to run debug container in a running pod
 type DebugOptions struct {
 
 	// Pod select options
 	Namespace string
 	PodName   string
+	// NodeName is set instead of PodName to debug a node given as node/NAME
+	NodeName string
 
 	// Debug options
 	RetainContainer bool
 	Image           string
 	ContainerName   string
+	ContainerID     string
 	Command         []string
 	AgentPort       int
-	ConfigLocation  string
+	ConfigLocations []string
+	BundleFile      string
+	IdleTimeout     time.Duration
+	UseSSHBastion   bool
+	SkipArchCheck   bool
+	Runtime         string
+	NoJoin          bool
+	ShowAPICalls    bool
+	ForceResize     bool
+	RuntimeArgs     []string
+	SaveLogs        string
+	Term            string
+	Env             []string
+	MaxOutputBytes  int64
+	OutputSpec      bool
+	ReadyWait       time.Duration
+	QuietPull       bool
+	NoDefaultWarn   bool
+	CommandTimeout  time.Duration
+	AttachTimeout   time.Duration
+	// CommandEncoding is how the command is sent to the agent, one of auto, json, base64
+	CommandEncoding string
+	Transcript      string
+	OutFile         string
+	ErrFile         string
+	SSHBastion      *SSHBastionConfig
+	PreCommand      []string
+	PostCommand     []string
+	MinAgentVersion string
+	MaxAgentVersion string
+	// DefaultContainerMatch picks the target container by name or image
+	DefaultContainerMatch *regexp.Regexp
+	// ForbiddenNodeLabels and AllowedNodeLabels restrict the nodes to debug on
+	ForbiddenNodeLabels []string
+	AllowedNodeLabels   []string
+	// AgentAnnotations are the agent annotations of the target pod which are honoured
+	AgentAnnotations []string
+	// AllowBundleHooks accepts a bundle running local commands or reaching other endpoints
+	AllowBundleHooks bool
+	// APIRetries bounds the retries of the initial pod lookup on transient errors
+	APIRetries int
+
+	// EnvFromConfigMaps and EnvFromSecrets name the ConfigMaps and Secrets
+	// in the namespace of the pod whose keys become env of the debug container
+	EnvFromConfigMaps []string
+	EnvFromSecrets    []string
+	// AgentURLTemplate renders the base url of the agent api
+	AgentURLTemplate string
+	// DNSServers and DNSSearches replace the resolv.conf of the debug container
+	DNSServers  []string
+	DNSSearches []string
+	// InheritSecurityContext applies the security context of the target container
+	// to the debug container, explicit RuntimeArgs take precedence
+	InheritSecurityContext bool
+	// Watch runs the session again in the replacement of the pod once it is gone
+	Watch        bool
+	WatchTimeout time.Duration
+	// NoRetain overrides retain_namespaces of the config file
+	NoRetain bool
+	// WithLogsPane follows the logs of the target container on stderr during the session
+	WithLogsPane bool
+	// SummaryTemplate is a go template printing the summary of the session when it ends
+	SummaryTemplate string
+	// AuditFile and AuditWebhook receive an audit record of the session when it ends
+	AuditFile          string
+	AuditWebhook       string
+	AuditRedactCommand bool
+	// Reason tells why the session is run, for the audit record
+	Reason string
+	// JSONEvents emits the lifecycle events as json lines on stderr
+	JSONEvents bool
+	// KeepaliveInterval keeps quiet sessions alive through intermediaries with idle timeouts
+	KeepaliveInterval time.Duration
+	// DumpRestConfig prints the resolved rest config without credentials
+	DumpRestConfig bool
+	// Entrypoint overrides the entrypoint of the debug container, Command are its args then
+	Entrypoint string
+	// Login runs the shell of the debug container as a login shell
+	Login bool
+	// PodIP finds the pod by its ip instead of its name, in all namespaces with AllNamespaces
+	PodIP         string
+	AllNamespaces bool
+	// TimeoutProfile sets the timeout flags for a scenario, e.g. interactive, batch or ci
+	TimeoutProfile string
+	// PreserveANSI keeps the escape sequences in --out-file, --err-file and --transcript
+	PreserveANSI bool
+	// LocalExec runs the command as a local process instead of in a debug container,
+	// for development and smoke tests only
+	LocalExec bool
+	// CheckUpdate queries UpdateURL for a newer release during the session
+	CheckUpdate bool
+	UpdateURL   string
+	// Agentless starts a temporary agent pod on the node for the session instead of
+	// relying on the debug-agent DaemonSet
+	Agentless           bool
+	AgentImage          string
+	AgentServiceAccount string
+	// Fork debugs a copy of the pod without labels and probes, whose target
+	// container runs `sleep infinity` instead of its entrypoint with ForkHold
+	Fork     bool
+	ForkHold bool
+	// TTY and Stdin mirror -t and -i of kubectl exec, a tty is only used if stdin is a terminal
+	TTY   bool
+	Stdin bool
+	// StdinOnce closes the stdin of the debug container at the first EOF of the local
+	// stdin in sessions without tty, instead of keeping it open until the command exits
+	StdinOnce bool
+	// PickPod prompts for the pod of a workload instead of taking its newest running pod
+	PickPod bool
+	// PortForward reaches the agent pod through the api server instead of the node ip,
+	// the pod of the DaemonSet is found by AgentSelector in AgentNamespace
+	PortForward    bool
+	AgentNamespace string
+	AgentSelector  string
+	// ImagePullSecrets and RegistryConfig hold the credentials for the registry of the
+	// debug image, which are forwarded to the agent
+	ImagePullSecrets []string
+	RegistryConfig   string
+	// CPU and Memory limit the debug container, e.g. 500m and 256Mi, the agent applies
+	// its defaults if they are empty and refuses limits above its maximums
+	CPU    string
+	Memory string
+	// Lxcfs mounts the /proc files of lxcfs in the debug container, so that top and free
+	// report the limits of the pod instead of the node
+	Lxcfs bool
+	// MountVolumes are the names of the volumes of the target container which are mounted
+	// in the debug container, at the same paths
+	MountVolumes []string
 
-	Flags     *genericclioptions.ConfigFlags
-	PodClient coreclient.PodsGetter
-	Args      []string
-	Config    *restclient.Config
+	Flags      *genericclioptions.ConfigFlags
+	KubeCli    kubernetes.Interface
+	PodClient  coreclient.PodsGetter
+	NodeClient coreclient.NodesGetter
+	Args       []string
+	Config     *restclient.Config
 
 	genericclioptions.IOStreams
+
+	redactor *redactor
+	events   *eventEmitter
+	// targetPod is the pod of the last session, whose replacement --watch looks for
+	targetPod *corev1.Pod
+	// summary of the running session, rendered by summaryTemplate once it ends
+	summary         *sessionSummary
+	summaryTemplate *template.Template
+	// audits are the audit records still being posted
+	audits sync.WaitGroup
+
+	// agentPortExplicit keeps the agent port annotation of the pod from overriding
+	// the port set by --port or a config-first config file
+	agentPortExplicit bool
+	// agentScheme and agentPath are taken from the annotations of the pod
+	agentScheme string
+	agentPath   string
+
+	// sessionOut and sessionErr replace Out and ErrOut for the output of the
+	// debug container, if --out-file or --err-file is set
+	sessionOut io.WriteCloser
+	sessionErr io.WriteCloser
+	// registryAuthHeader is sent to the agent to authenticate the pull of the debug image
+	registryAuthHeader string
+	// requestBody is the form sent in the body of the debug request, see commandEncodingBody
+	requestBody url.Values
+	// stdinPump reads In for the sessions with an idle timeout, see inputPump
+	stdinPump *inputPump
+	// apiProxy is the proxy-url of the kubeconfig cluster the api requests go through
+	apiProxy *url.URL
+	// commandDefaulted is set when no command is given, the default differs on windows nodes
+	commandDefaulted bool
+	// interrupts runs the cleanups registered with onInterrupt on a termination signal
+	interrupts        *interrupt.Handler
+	interruptMu       sync.Mutex
+	interruptCleanups []func()
 }
 
 /*func NewDebugOptions(streams genericclioptions.IOStreams) *DebugOptions {
@@ -107,192 +388,1099 @@ func NewDebugCmd(streams genericclioptions.IOStreams) *cobra.Command {
 		Short:   "Run a container in a running pod",
 		Long:    longDesc,
 		Example: example,
+		Args:    cobra.ArbitraryArgs,
 		Run: func(c *cobra.Command, args []string) {
-			fmt.Println("hello i'm here, in cmd/ newDebugCmd")
+			// every failure exits non-zero, so that scripts can tell it from a clean session
+			fail := func(err error) {
+				fmt.Fprintln(opts.ErrOut, opts.redact(err.Error()))
+				opts.emitError(err)
+				os.Exit(exitCode(err))
+			}
 			argsLenAtDash := c.ArgsLenAtDash()
 			if err := opts.Complete(c, args, argsLenAtDash); err != nil {
-				fmt.Println(err)
+				fail(err)
+				return
 			}
 			if err := opts.Validate(); err != nil {
-				fmt.Println(err)
+				fail(err)
+				return
 			}
-			if err := opts.Run(); err != nil {
-				fmt.Println(err)
+			if err := opts.RunWatch(); err != nil {
+				// the exit code of the command is all there is to report, like kubectl exec
+				if _, ok := commandExitCode(err); ok {
+					os.Exit(exitCode(err))
+				}
+				fail(err)
 			}
 		},
 	}
-	//cmd.Flags().BoolVarP(&opts.RetainContainer, "retain", "r", defaultRetain,
-	//	fmt.Sprintf("Retain container after debug session closed, default to %s", defaultRetain))
-	cmd.Flags().StringVar(&opts.Image, "image", "",
-		fmt.Sprintf("Container Image to run the debug container, default to %s", defaultImage))
-	cmd.Flags().StringVarP(&opts.ContainerName, "container", "c", "",
-		"Target container to debug, default to the first container in pod")
-	cmd.Flags().IntVarP(&opts.AgentPort, "port", "p", 0,
-		fmt.Sprintf("Agent port for debug cli to connect, default to %d", defaultAgentPort))
-	cmd.Flags().StringVar(&opts.ConfigLocation, "debug-config", "",
-		fmt.Sprintf("Debug config file, default to ~%s", defaultConfigLocation))
-	opts.Flags.AddFlags(cmd.Flags())
+	opts.addDebugFlags(cmd.Flags())
+	cmd.PersistentFlags().BoolVar(&opts.ShowAPICalls, "show-api-calls", false,
+		"Print every kubernetes api request made by the plugin, which helps to figure out the required permissions")
+	cmd.PersistentFlags().IntVarP(&opts.AgentPort, "port", "p", 0,
+		fmt.Sprintf("Agent port for debug cli to connect, default to agent_port in the config file or %d", defaultAgentPort))
+	cmd.PersistentFlags().StringVar(&opts.AgentURLTemplate, "agent-url-template", "",
+		"Go template of the base url of the agent, e.g. https://gateway/nodes/{{.NodeName}}, "+
+			"with the fields HostIP, NodeName, Port, Namespace and Pod, default to http://{{.HostIP}}:{{.Port}}")
+	cmd.PersistentFlags().StringSliceVar(&opts.ConfigLocations, "debug-config", nil,
+		fmt.Sprintf("Debug config file, default to ~%s, can be repeated or comma separated to layer files, later files override earlier ones", defaultConfigLocation))
+	cmd.PersistentFlags().StringVar(&opts.BundleFile, "bundle", "",
+		"Bundle file describing the whole debug setup with a pinned image, used in place of the debug config file")
+	cmd.PersistentFlags().BoolVar(&opts.AllowBundleHooks, "allow-bundle-hooks", false,
+		"Accept a bundle which runs local commands, e.g. pre_command, or reaches other endpoints than the cluster, e.g. ssh_bastion")
+	opts.Flags.AddFlags(cmd.PersistentFlags())
+	// -v sets the verbosity of the diagnostics, which go to stderr, nothing is logged by default
+	klogFlags := flag.NewFlagSet("klog", flag.ContinueOnError)
+	klog.InitFlags(klogFlags)
+	cmd.PersistentFlags().AddGoFlag(klogFlags.Lookup("v"))
+	// flags after the command belong to the command, see parseArgsAfterPod
+	cmd.Flags().SetInterspersed(false)
+
+	cmd.AddCommand(NewSessionsCmd(opts))
+	cmd.AddCommand(NewConfigDumpCmd(opts))
+	cmd.AddCommand(NewContextsCmd(opts))
+	cmd.AddCommand(NewProfilesCmd(opts))
+	cmd.AddCommand(NewRBACHelpCmd(opts))
+	cmd.AddCommand(NewProbePortsCmd(opts))
+	cmd.AddCommand(NewCompletionCmd(opts))
+	cmd.AddCommand(NewCompleteNamesCmd(opts))
+	markCompletionFlags(cmd)
 
 	return cmd
 }
 
+// addAgentFlags registers the flags controlling how the agent is reached, which are
+// shared by the debug command and the commands querying the agent
+func (o *DebugOptions) addAgentFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&o.UseSSHBastion, "ssh-bastion", false,
+		"Tunnel the agent connection through the ssh bastion configured in the debug config file")
+	flags.BoolVar(&o.Agentless, "agentless", false,
+		"Start a temporary agent pod on the node of the pod for the session, which is deleted when it ends, instead of using the debug-agent DaemonSet")
+	flags.StringVar(&o.AgentImage, "agent-image", defaultAgentImage,
+		"Image of the temporary agent pod of --agentless")
+	flags.StringVar(&o.AgentServiceAccount, "agent-service-account", "",
+		"Service account of the temporary agent pod of --agentless, which authorizes the requests unless --port-forward is set, see the README for its rbac")
+	flags.BoolVar(&o.PortForward, "port-forward", false,
+		"Reach the agent by port-forwarding to its pod through the api server, like kubectl port-forward, when the nodes are not reachable directly")
+	flags.StringVar(&o.AgentNamespace, "agent-namespace", defaultAgentNamespace,
+		"Namespace of the debug-agent DaemonSet, used by --port-forward")
+	flags.StringVar(&o.AgentSelector, "agent-selector", defaultAgentSelector,
+		"Label selector of the debug-agent pods, used by --port-forward")
+}
+
+// addDebugFlags registers the flags controlling the debug container, which are
+// shared by the debug command and the commands previewing it
+func (o *DebugOptions) addDebugFlags(flags *pflag.FlagSet) {
+	o.addAgentFlags(flags)
+	flags.BoolVarP(&o.RetainContainer, "retain", "r", false,
+		"Retain the debug container after the debug session closed, default to retain_namespaces in the config file")
+	flags.BoolVar(&o.NoRetain, "no-retain", false,
+		"Remove the debug container after the debug session closed even if retain_namespaces in the config file matches")
+	flags.StringVar(&o.Image, "image", "",
+		fmt.Sprintf("Container Image to run the debug container, default to $%s, image in the config file or %s", imageEnvironment, defaultImage))
+	flags.StringVar(&o.PodIP, "pod-ip", "",
+		"Debug the running pod with this ip instead of passing the pod, e.g. an ip from logs or metrics")
+	flags.BoolVarP(&o.AllNamespaces, "all-namespaces", "A", false,
+		"Search the pod of --pod-ip in all namespaces instead of the current one")
+	flags.StringVarP(&o.ContainerName, "container", "c", "",
+		"Target container to debug, default to the first ready container in pod")
+	flags.StringVar(&o.ContainerID, "container-id", "",
+		"Id of the target container, e.g. docker://<id> or a bare (short) id, instead of resolving it from the container name")
+	flags.IntVar(&o.APIRetries, "api-retries", defaultAPIRetries,
+		"Retry the lookup of the pod this many times with backoff on transient api server errors, e.g. 5xx or timeouts, zero means no retry")
+	flags.DurationVar(&o.ReadyWait, "ready-wait", 0,
+		"Wait up to this duration for the target container to become ready, zero means failing at once if it is not ready")
+	flags.DurationVar(&o.AttachTimeout, "attach-timeout", 0,
+		"Kill the debug container if it writes nothing for this duration after it is created, e.g. a shell which never comes up, zero means no timeout")
+	flags.DurationVar(&o.CommandTimeout, "command-timeout", 0,
+		fmt.Sprintf("Kill the debug container once it has run for this duration and exit with code %d, zero means no timeout", commandTimeoutExitCode))
+	flags.StringVar(&o.CommandEncoding, "command-encoding", commandEncodingAuto,
+		"How the command is sent to the agent, one of auto, json, base64, body, auto uses body if the agent supports it, which keeps long commands out of the url")
+	flags.DurationVar(&o.KeepaliveInterval, "keepalive-interval", defaultKeepaliveInterval,
+		"Send keepalives on the connection to the agent at this interval, so that load balancers and firewalls do not drop quiet sessions, zero means no keepalive")
+	flags.StringVar(&o.TimeoutProfile, "timeout-profile", "",
+		"Set the attach, command, idle, ready and keepalive timeouts and the api retries for a scenario, one of interactive, batch, ci or a profile of the config file, the individual flags override it")
+	flags.DurationVar(&o.IdleTimeout, "idle-timeout", 0,
+		"Close the session after no stdin/stdout activity for this duration, default to idle_timeout in the config file, zero means no timeout")
+	flags.BoolVar(&o.NoJoin, "no-join", false,
+		"Run a standalone debug container on the node of the pod, which joins the host network and pid namespaces instead of a container")
+	flags.StringVar(&o.Runtime, "runtime", "",
+		"Container runtime of the target container, default to runtime in the config file or detected from the container id")
+	flags.BoolVar(&o.ForceResize, "force-initial-resize", false,
+		"Send the terminal size again once the debug container is attached, for terminals showing a broken layout until the first resize")
+	flags.StringArrayVar(&o.RuntimeArgs, "runtime-arg", nil,
+		"Extra KEY=VALUE arg applied by the agent when creating the debug container, keys not allowed by the agent are rejected")
+	flags.BoolVar(&o.InheritSecurityContext, "inherit-security-context", false,
+		"Run the debug container with the user, capabilities and seccomp of the target container, sent as runtime args which the agent must allow, --runtime-arg overrides them by key")
+	flags.StringVar(&o.Term, "term", "",
+		fmt.Sprintf("TERM of the debug container, default to the local $TERM or %s, overridden by --env TERM=...", defaultTerm))
+	flags.StringVar(&o.Entrypoint, "entrypoint", "",
+		"Entrypoint of the debug container, the arguments after the pod become its args instead of the whole command, like docker run --entrypoint")
+	flags.BoolVar(&o.Login, "login", false,
+		"Run the shell as a login shell, e.g. bash -l, which sources /etc/profile, only for the default or an explicit shell without arguments")
+	flags.StringArrayVar(&o.Env, "env", nil,
+		"Environment variable KEY=VALUE of the debug container, can be repeated")
+	flags.StringArrayVar(&o.EnvFromConfigMaps, "env-from-configmap", nil,
+		"ConfigMap in the namespace of the pod whose keys become environment variables of the debug container, can be repeated")
+	flags.StringArrayVar(&o.EnvFromSecrets, "env-from-secret", nil,
+		"Secret in the namespace of the pod whose keys become environment variables of the debug container, can be repeated")
+	flags.BoolVar(&o.CheckUpdate, "check-update", false,
+		"Check in the background whether a newer kubectl-debug is released and print a notice after the session, nothing is installed")
+	flags.StringArrayVar(&o.DNSServers, "dns-server", nil,
+		"Nameserver ip of the debug container, can be repeated, the dns config of the target pod is used if not set")
+	flags.StringArrayVar(&o.DNSSearches, "dns-search", nil,
+		"Search domain of the debug container, can be repeated, requires --dns-server")
+	flags.Int64Var(&o.MaxOutputBytes, "max-output-bytes", 0,
+		"Discard the stdout and stderr of a session without tty beyond this many bytes each, zero means no limit")
+	flags.StringVar(&o.Transcript, "transcript", "",
+		"Write a plain text log of the session output to this file, with terminal escape sequences stripped")
+	flags.StringVar(&o.OutFile, "out-file", "",
+		"Write the stdout of the debug container to this file instead of the terminal, implies a session without tty")
+	flags.StringVar(&o.ErrFile, "err-file", "",
+		"Write the stderr of the debug container to this file instead of the terminal, implies a session without tty")
+	flags.BoolVar(&o.PreserveANSI, "preserve-ansi", false,
+		"Keep the ANSI escape sequences, e.g. colors, in --out-file, --err-file and --transcript instead of stripping them")
+	flags.StringVar(&o.SaveLogs, "save-logs", "",
+		"Save the complete logs of the debug container to this file when the session ends")
+	flags.BoolVar(&o.Watch, "watch", false,
+		"Once the pod is gone after the session, e.g. recreated by its controller, wait for its replacement and debug it again")
+	flags.DurationVar(&o.WatchTimeout, "watch-timeout", defaultWatchTimeout,
+		"How long --watch waits for the replacement of the pod")
+	flags.BoolVar(&o.WithLogsPane, "with-logs-pane", false,
+		"Follow the logs of the target container on stderr while the shell runs on stdout, redirect stderr to another terminal to keep them apart")
+	flags.BoolVar(&o.OutputSpec, "output-container-spec", false,
+		"Print the spec of the debug container as yaml instead of creating it")
+	flags.BoolVar(&o.NoDefaultWarn, "suppress-default-warning", false,
+		"Do not warn about the container picked when --container is not set, for scripts relying on the default")
+	flags.BoolVar(&o.QuietPull, "quiet-pull", false,
+		"Hide the progress of pulling the debug image, other messages are still shown")
+	flags.BoolVar(&o.SkipArchCheck, "skip-arch-check", false,
+		"Skip checking whether the image supports the architecture of the node")
+	flags.StringVar(&o.SummaryTemplate, "summary-template", "",
+		"Go template printed to stdout when the session ends, with the fields Namespace, Pod, Node, Container, TargetContainerID, Image, Command, StartTime, EndTime, Duration and Error")
+	flags.StringVar(&o.AuditFile, "audit-file", "",
+		"Append a json audit record of the session to this file when it ends, e.g. set in the defaults of the config file")
+	flags.StringVar(&o.AuditWebhook, "audit-webhook", "",
+		"Post a json audit record of the session to this http or https url when it ends, failures only print a warning")
+	flags.BoolVar(&o.AuditRedactCommand, "audit-redact-command", false,
+		"Leave the command out of the audit record, e.g. when it carries credentials")
+	flags.StringVar(&o.Reason, "reason", "",
+		"Why the session is run, e.g. a ticket id, recorded in the audit record")
+	flags.BoolVar(&o.JSONEvents, "json-events", false,
+		"Write lifecycle events of the session to stderr as newline-delimited json, for tools wrapping kubectl debug")
+	flags.BoolVar(&o.DumpRestConfig, "dump-rest-config", false,
+		"Print the resolved rest config used for the api and the agent stream to stderr, without any credential")
+	// only meant for diagnosing auth problems
+	flags.MarkHidden("dump-rest-config")
+	flags.BoolVarP(&o.TTY, "tty", "t", true,
+		"Allocate a tty for the debug container if stdin is a terminal, --tty=false streams stdout and stderr apart even in a terminal")
+	flags.BoolVarP(&o.Stdin, "stdin", "i", true,
+		"Pass stdin to the debug container, --stdin=false closes its stdin right away, e.g. for commands in scripts which must not consume the input of the script")
+	flags.BoolVar(&o.StdinOnce, "stdin-once", true,
+		"Without tty, close the stdin of the debug container once the local stdin reaches EOF, like kubectl exec -i, --stdin-once=false keeps it open until the command exits, e.g. for commands which stop at the end of their input")
+	flags.BoolVar(&o.Fork, "fork", false,
+		"Debug a copy of the pod on the same node, without labels and probes, e.g. for a crash looping pod whose container is not running, the copy is deleted when the session ends")
+	flags.BoolVar(&o.ForkHold, "fork-hold", false,
+		"With --fork, run `sleep infinity` instead of the entrypoint of the target container in the copy, to keep it running")
+	flags.BoolVar(&o.PickPod, "pick-pod", false,
+		"Prompt for the pod to debug among the running pods of a workload, instead of picking the most recent one")
+	flags.StringVar(&o.CPU, "cpu", "",
+		"CPU limit of the debug container, e.g. 500m or 2, default to the default of the agent config, which is unlimited if not set")
+	flags.StringVar(&o.Memory, "memory", "",
+		"Memory limit of the debug container, e.g. 256Mi, default to the default of the agent config, which is unlimited if not set")
+	flags.StringSliceVar(&o.MountVolumes, "mount-volume", nil,
+		"Volumes of the target container to mount in the debug container at the same paths, by name, e.g. data,config, for emptyDir, persistentVolumeClaim, configMap and other volumes")
+	flags.BoolVar(&o.Lxcfs, "lxcfs", false,
+		"Mount the /proc files of lxcfs in the debug container, so that tools like top and free report the limits of the pod instead of the node, requires lxcfs on the node")
+	flags.StringArrayVar(&o.ImagePullSecrets, "image-pull-secret", nil,
+		"Secret of type kubernetes.io/dockerconfigjson in the namespace of the pod whose credentials the agent pulls the debug image with, can be repeated")
+	flags.StringVar(&o.RegistryConfig, "registry-config", "",
+		"Local docker config.json whose credentials the agent pulls the debug image with, if no --image-pull-secret has credentials for its registry")
+	flags.BoolVar(&o.LocalExec, "local-exec", false,
+		"Run the command as a local process instead of in a debug container, through the same tty and stream handling, not for production use")
+	// only meant for development and smoke tests without a cluster
+	flags.MarkHidden("local-exec")
+}
+
 // Complete populate default values from KUBECONFIG file
 func (o *DebugOptions) Complete(cmd *cobra.Command, args []string, argsLenAtDash int) error {
-	fmt.Println("hello i'm here, in cmd/ newDebugCmd / Complete")
-
-	o.Args = args
-	if len(args) == 0 {
+	// without a pod, it is picked among the running pods of the namespace in a terminal
+	pickPod := len(args) == 0 && len(o.PodIP) < 1
+	if pickPod && (o.LocalExec || !(term.TTY{In: o.In}).IsTerminalIn()) {
 		return fmt.Errorf("error pod not specified")
 	}
-
 	var err error
-	configLoader := o.Flags.ToRawKubeConfigLoader()
-	o.Namespace, _, err = configLoader.Namespace()
-	if err != nil {
+	if len(o.PodIP) > 0 || pickPod {
+		// there is no pod argument, an empty one stands in for it so that
+		// the command starts at args[1] either way
+		args = append([]string{""}, args...)
+	} else if args, err = parseArgsAfterPod(cmd.Flags(), args, argsLenAtDash); err != nil {
 		return err
 	}
+	o.Args = args
+	if len(o.SummaryTemplate) > 0 {
+		if o.summaryTemplate, err = parseSummaryTemplate(o.SummaryTemplate); err != nil {
+			return err
+		}
+	}
+	if o.JSONEvents {
+		o.events = newEventEmitter(o.ErrOut)
+		o.emit(event{Type: eventResolving, Pod: args[0]})
+	}
 
-	fmt.Println("------print flags-----", o.Flags.ToRawKubeConfigLoader(), o.Namespace)
-
-	o.PodName = args[0]
-	fmt.Println("------print flags-----", o.Flags.ToRawKubeConfigLoader(), o.Namespace, o.PodName, "---", args)
-
-	// read defaults from config file
-	configFile := o.ConfigLocation
-	if len(o.ConfigLocation) < 1 {
-		usr, err := user.Current()
-		if err == nil {
-			configFile = usr.HomeDir + defaultConfigLocation
+	config, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	o.redactor = newRedactor(config.SensitiveKeys)
+	// apply the flag defaults first, as they may change the kubeconfig flags
+	if err := applyFlagDefaults(cmd.Flags(), config.Defaults); err != nil {
+		return err
+	}
+	// the profile only fills in what is still unset, so explicit flags and defaults win
+	if len(o.TimeoutProfile) > 0 {
+		if err := applyTimeoutProfile(cmd.Flags(), o.TimeoutProfile, config.TimeoutProfiles); err != nil {
+			return err
 		}
 	}
-	config, err := LoadFile(configFile)
+
+	configLoader := o.Flags.ToRawKubeConfigLoader()
+	o.Namespace, _, err = configLoader.Namespace()
 	if err != nil {
-		log.Println("error loading file ", err)
-		config = &Config{}
+		return err
 	}
 
-	// combine defaults, config file and user parameters
+	o.PodName = args[0]
+	klog.V(4).Info(o.redact(fmt.Sprintf("namespace: %s, pod: %s, args: %v", o.Namespace, o.PodName, args)))
+
+	// combine defaults, config file and user parameters, the config file
+	// overrides the user parameters if its precedence is config-first
+	configFirst := config.Precedence == PrecedenceConfigFirst
 	o.Command = args[1:]
-	if len(o.Command) < 1 {
-		if len(config.Command) > 0 {
+	// with --entrypoint, the arguments are the args of the entrypoint, which may be none
+	if len(o.Entrypoint) < 1 {
+		if len(config.Command) > 0 && (len(o.Command) < 1 || configFirst) {
 			o.Command = config.Command
-		} else {
+		}
+		if len(o.Command) < 1 {
 			o.Command = []string{"bash"}
+			o.commandDefaulted = true
+		}
+	}
+	if o.Login {
+		if len(o.Entrypoint) > 0 {
+			return fmt.Errorf("--login cannot be used together with --entrypoint")
+		}
+		if o.Command, err = loginCommand(o.Command); err != nil {
+			return err
 		}
 	}
 	if len(o.Image) < 1 {
-		if len(config.Image) > 0 {
-			o.Image = config.Image
-		} else {
-			o.Image = defaultImage
+		o.Image = os.Getenv(imageEnvironment)
+	}
+	if len(config.Image) > 0 && (len(o.Image) < 1 || configFirst) {
+		o.Image = config.Image
+	}
+	if len(o.Image) < 1 {
+		o.Image = defaultImage
+	}
+	o.completeAgentPort(config)
+	if !cmd.Flags().Changed("idle-timeout") {
+		o.IdleTimeout = config.IdleTimeout
+	}
+	if cmd.Flags().Changed("tty") && o.TTY && !o.Stdin {
+		return fmt.Errorf("--tty requires --stdin, set --tty=false to run without stdin")
+	}
+	if len(o.Runtime) < 1 {
+		o.Runtime = config.Runtime
+	}
+	o.SSHBastion = config.SSHBastion
+	o.PreCommand = config.PreCommand
+	o.PostCommand = config.PostCommand
+	o.MinAgentVersion = config.MinAgentVersion
+	o.MaxAgentVersion = config.MaxAgentVersion
+	o.UpdateURL = config.UpdateURL
+	o.ForbiddenNodeLabels = config.ForbiddenNodeLabels
+	o.AllowedNodeLabels = config.AllowedNodeLabels
+	o.AgentAnnotations = config.AgentAnnotations
+	if len(config.DefaultContainerMatch) > 0 {
+		o.DefaultContainerMatch = regexp.MustCompile(config.DefaultContainerMatch)
+	}
+	if len(o.Term) < 1 {
+		o.Term = os.Getenv("TERM")
+		if len(o.Term) < 1 {
+			o.Term = defaultTerm
+		}
+	}
+
+	if o.LocalExec {
+		// nothing on the cluster is used, so a kubeconfig is not required
+		return nil
+	}
+	if err := o.completeClient(); err != nil {
+		return err
+	}
+	if o.DumpRestConfig {
+		if err := o.dumpRestConfig(); err != nil {
+			return err
+		}
+	}
+	if pickPod {
+		o.PodName, err = o.pickPodInteractively()
+		o.completeRetain(cmd.Flags(), config)
+		return err
+	}
+	if len(o.PodIP) > 0 {
+		o.PodName, err = o.podByIP()
+		o.completeRetain(cmd.Flags(), config)
+		return err
+	}
+	if nodeName, ok := nodeArg(args[0]); ok {
+		if len(nodeName) < 1 {
+			return fmt.Errorf("invalid argument %q, name must be specified", args[0])
 		}
+		o.PodName = ""
+		o.NodeName = nodeName
+		o.completeRetain(cmd.Flags(), config)
+		return nil
+	}
+	podArg, err := o.completeNamespace(args[0])
+	if err != nil {
+		return err
+	}
+	o.completeRetain(cmd.Flags(), config)
+	o.PodName, err = o.resolvePodName(podArg)
+	return err
+}
+
+// completeRetain decides whether the debug container is retained, --retain and
+// --no-retain take precedence over retain_namespaces of the config file
+func (o *DebugOptions) completeRetain(flags *pflag.FlagSet, config *Config) {
+	if flags.Changed("no-retain") && o.NoRetain {
+		o.RetainContainer = false
+		return
+	}
+	if flags.Changed("retain") {
+		return
+	}
+	o.RetainContainer = config.retainNamespace(o.Namespace)
+}
+
+// configFiles returns the locations of the debug config files in the order they
+// are merged, or of the bundle if set
+func (o *DebugOptions) configFiles() []string {
+	if len(o.BundleFile) > 0 {
+		return []string{o.BundleFile}
+	}
+	if len(o.ConfigLocations) > 0 {
+		return o.ConfigLocations
+	}
+	usr, err := user.Current()
+	if err != nil {
+		return nil
+	}
+	return []string{usr.HomeDir + defaultConfigLocation}
+}
+
+// completeAgentPort combines the --port flag, the config file and the default,
+// the agent port annotation of the pod takes precedence over the config file unless
+// it is config-first
+func (o *DebugOptions) completeAgentPort(config *Config) {
+	o.agentPortExplicit = o.AgentPort > 0 || (config.AgentPort > 0 && config.Precedence == PrecedenceConfigFirst)
+	if config.AgentPort > 0 && (o.AgentPort < 1 || config.Precedence == PrecedenceConfigFirst) {
+		o.AgentPort = config.AgentPort
 	}
 	if o.AgentPort < 1 {
-		if config.AgentPort > 0 {
-			o.AgentPort = config.AgentPort
-		} else {
-			o.AgentPort = defaultAgentPort
+		o.AgentPort = defaultAgentPort
+	}
+}
+
+// loadConfig reads the bundle if set, the debug config files merged in order
+// otherwise, missing config files are skipped
+func (o *DebugOptions) loadConfig() (*Config, error) {
+	if len(o.BundleFile) > 0 {
+		if len(o.ConfigLocations) > 0 {
+			return nil, fmt.Errorf("--bundle cannot be used together with --debug-config")
 		}
+		config, err := LoadBundle(o.BundleFile, o.AllowBundleHooks)
+		if err != nil {
+			return nil, fmt.Errorf("error loading bundle %s: %v", o.BundleFile, err)
+		}
+		return config, nil
 	}
+	config := &Config{}
+	for _, configFile := range o.configFiles() {
+		if err := config.mergeFile(configFile); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error loading config file %s: %v", configFile, err)
+		}
+	}
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("error loading config files %s: %v", strings.Join(o.configFiles(), ", "), err)
+	}
+	return config, nil
+}
 
-	o.Config, err = configLoader.ClientConfig()
+// completeClient builds the rest config and api clients from the kubeconfig flags
+func (o *DebugOptions) completeClient() error {
+	if err := o.completeAPIProxy(); err != nil {
+		return err
+	}
+	var err error
+	o.Config, err = o.Flags.ToRawKubeConfigLoader().ClientConfig()
 	if err != nil {
 		return err
 	}
-	clientset, err := kubernetes.NewForConfig(o.Config)
+	// the stream to the agent is not an api call, so only wrap a copy for the clientset
+	apiConfig := o.Config
+	if o.apiProxy != nil || o.ShowAPICalls {
+		apiConfig = restclient.CopyConfig(o.Config)
+	}
+	if o.apiProxy != nil {
+		apiConfig.Wrap(wrapAPIProxy(o.apiProxy))
+	}
+	if o.ShowAPICalls {
+		apiConfig.Wrap(newAPICallLogger(o.ErrOut, o.redact))
+	}
+	clientset, err := kubernetes.NewForConfig(apiConfig)
 	if err != nil {
-		fmt.Println("err; ---", err, "---NewForConfig")
 		return err
 	}
+	o.KubeCli = clientset
 	o.PodClient = clientset.CoreV1()
+	o.NodeClient = clientset.CoreV1()
 
 	return nil
 }
 
 func (o *DebugOptions) Validate() error {
-	if len(o.PodName) == 0 {
+	if len(o.PodName) == 0 && len(o.NodeName) == 0 {
 		return fmt.Errorf("pod name must be specified")
 	}
-	if len(o.Command) == 0 {
+	if o.AllNamespaces && len(o.PodIP) < 1 {
+		return fmt.Errorf("--all-namespaces requires --pod-ip")
+	}
+	if len(o.NodeName) > 0 && !o.NoJoin {
+		return fmt.Errorf("debugging node/%s requires --no-join, there is no container to join", o.NodeName)
+	}
+	if len(o.Command) == 0 && len(o.Entrypoint) == 0 {
 		return fmt.Errorf("you must specify at least one command for the container")
 	}
+	if err := validateImage(o.Image); err != nil {
+		return err
+	}
+	if o.NoJoin && len(o.ContainerName) > 0 {
+		return fmt.Errorf("--no-join cannot be used together with --container")
+	}
+	if o.NoJoin && o.InheritSecurityContext {
+		return fmt.Errorf("--inherit-security-context requires a target container, it cannot be used together with --no-join")
+	}
+	if o.Watch && (len(o.ContainerID) > 0 || len(o.NodeName) > 0) {
+		return fmt.Errorf("--watch cannot be used together with --container-id or a node, which do not carry over to a replacement pod")
+	}
+	if o.WatchTimeout <= 0 {
+		return fmt.Errorf("--watch-timeout must be positive")
+	}
+	if o.Fork && (o.NoJoin || o.Watch || len(o.ContainerID) > 0) {
+		return fmt.Errorf("--fork cannot be used together with --no-join, --watch, --container-id or a node")
+	}
+	if o.ForkHold && !o.Fork {
+		return fmt.Errorf("--fork-hold requires --fork")
+	}
+	if o.PortForward && o.UseSSHBastion {
+		return fmt.Errorf("--port-forward cannot be used together with --ssh-bastion")
+	}
+	// the agent authorizes the requests with token and access reviews, which the default
+	// service account of the namespace may not create
+	if o.Agentless && !o.PortForward && len(o.AgentServiceAccount) < 1 {
+		return fmt.Errorf("--agentless requires --agent-service-account, whose rbac is described in the README, or --port-forward")
+	}
+	for name, value := range map[string]string{"--cpu": o.CPU, "--memory": o.Memory} {
+		if len(value) < 1 {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil || quantity.Sign() <= 0 {
+			return fmt.Errorf("%s must be a positive quantity, e.g. 500m or 256Mi, got %q", name, value)
+		}
+	}
+	if o.NoJoin && len(o.MountVolumes) > 0 {
+		return fmt.Errorf("--mount-volume requires a target container, it cannot be used together with --no-join")
+	}
+	if o.NoJoin && o.Lxcfs {
+		return fmt.Errorf("--lxcfs requires a target container, it cannot be used together with --no-join")
+	}
+	if o.NoJoin && o.WithLogsPane {
+		return fmt.Errorf("--with-logs-pane requires a target container, it cannot be used together with --no-join")
+	}
+	if len(o.Runtime) > 0 {
+		if err := validateRuntime(o.Runtime); err != nil {
+			return err
+		}
+	}
+	if len(o.ContainerID) > 0 {
+		if o.NoJoin {
+			return fmt.Errorf("--no-join cannot be used together with --container-id")
+		}
+		if _, _, err := splitContainerID(o.ContainerID); err != nil {
+			return err
+		}
+	}
+	for _, env := range o.Env {
+		if !strings.Contains(env, "=") || strings.HasPrefix(env, "=") {
+			return fmt.Errorf("invalid env %q, must be KEY=VALUE", env)
+		}
+	}
+	if o.CommandTimeout < 0 {
+		return fmt.Errorf("--command-timeout must not be negative")
+	}
+	if o.RetainContainer && o.NoRetain {
+		return fmt.Errorf("--retain cannot be used together with --no-retain")
+	}
+	if o.AttachTimeout < 0 {
+		return fmt.Errorf("--attach-timeout must not be negative")
+	}
+	if o.KeepaliveInterval < 0 {
+		return fmt.Errorf("--keepalive-interval must not be negative")
+	}
+	if len(o.AuditWebhook) > 0 {
+		if err := validateAuditWebhook(o.AuditWebhook); err != nil {
+			return err
+		}
+	}
+	if o.APIRetries < 0 {
+		return fmt.Errorf("--api-retries must not be negative")
+	}
+	if err := validateCommandEncoding(o.CommandEncoding); err != nil {
+		return err
+	}
+	if o.MaxOutputBytes < 0 {
+		return fmt.Errorf("--max-output-bytes must not be negative")
+	}
+	for _, arg := range o.RuntimeArgs {
+		if !strings.Contains(arg, "=") || strings.HasPrefix(arg, "=") {
+			return fmt.Errorf("invalid runtime arg %q, must be KEY=VALUE", arg)
+		}
+	}
+	for _, server := range o.DNSServers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid --dns-server %q, must be an ip address", server)
+		}
+	}
+	if len(o.DNSSearches) > 0 && len(o.DNSServers) < 1 {
+		return fmt.Errorf("--dns-search requires --dns-server")
+	}
+	if o.UseSSHBastion && o.SSHBastion == nil {
+		return fmt.Errorf("--ssh-bastion requires ssh_bastion to be set in the debug config file")
+	}
 	return nil
 }
 
+// Run runs the debug session, the temporary pods registered with onInterrupt are
+// deleted even if the plugin is interrupted
 func (o *DebugOptions) Run() error {
+	o.interrupts = interrupt.New(nil, o.runInterruptCleanups)
+	return o.interrupts.Run(o.run)
+}
+
+func (o *DebugOptions) run() error {
 
-	fmt.Println("run; function")
+	if o.LocalExec {
+		return o.runLocal()
+	}
+
+	// the check runs alongside the session and is never waited for
+	updates := o.checkUpdate()
+	defer o.notifyUpdate(updates)
 
-	pod, err := o.PodClient.Pods(o.Namespace).Get(o.PodName, v1.GetOptions{})
+	var pod *corev1.Pod
+	var err error
+	if len(o.NodeName) > 0 {
+		pod, err = o.nodePod()
+	} else {
+		pod, err = o.getPod()
+	}
 	if err != nil {
-		fmt.Println("run; function; <o.PodClient.Pods>")
+		if errors.IsNotFound(err) && len(o.NodeName) < 1 {
+			return o.podNotFoundError(err)
+		}
 		return err
 	}
+	if o.Fork {
+		// the copy is debugged instead, which also works for completed or crash looping pods
+		if len(o.ContainerName) < 1 {
+			o.ContainerName = o.defaultContainerName(pod)
+		}
+		forked, deleteFork, err := o.forkPod(pod, o.ContainerName)
+		if err != nil {
+			return err
+		}
+		defer deleteFork()
+		pod, o.PodName = forked, forked.Name
+	}
 	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
 		return fmt.Errorf("cannot debug in a completed pod; current phase is %s", pod.Status.Phase)
 	}
+	if o.nodeOS(pod) == osWindows {
+		if err := o.completeWindows(pod); err != nil {
+			return err
+		}
+	}
+	if len(o.NodeName) < 1 {
+		o.targetPod = pod
+	}
 
-	fmt.Printf("pod:[%+v]", pod)
+	if klog.V(6) {
+		klog.Infof("pod: %s", o.redact(fmt.Sprintf("%+v", pod)))
+	}
 
 	hostIP := pod.Status.HostIP
+	if len(o.AgentURLTemplate) < 1 {
+		if err := o.applyAgentAnnotations(pod); err != nil {
+			return err
+		}
+	}
+
+	klog.V(4).Infof("host ip: %s", hostIP)
 
-	fmt.Printf("hostIP:[%+v]\n\n", hostIP)
+	var containerName, containerId string
+	if len(o.ContainerID) > 0 {
+		containerName, containerId, err = o.getContainerById(pod, o.ContainerID)
+		if err != nil {
+			return err
+		}
+		if pod, err = o.waitContainerReady(pod, containerName); err != nil {
+			return err
+		}
+		// the container may have been restarted while waiting
+		containerName, containerId, err = o.getContainerById(pod, o.ContainerID)
+		if err != nil {
+			return err
+		}
+	} else if !o.NoJoin {
+		containerName = o.ContainerName
+		if len(containerName) == 0 {
+			containerName = o.defaultContainerName(pod)
+			if len(pod.Spec.Containers) > 1 && !o.NoDefaultWarn {
+				usageString := fmt.Sprintf("Defaulting container name to %s.", containerName)
+				if first := pod.Spec.Containers[0].Name; first != containerName && !containerReady(pod, first) {
+					usageString += fmt.Sprintf(" The first container %s is not ready, use -c %s to debug it anyway.", first, first)
+				}
+				fmt.Fprintf(o.ErrOut, "%s\n\r", usageString)
+			}
+		}
 
-	containerName := o.ContainerName
-	if len(containerName) == 0 {
-		if len(pod.Spec.Containers) > 1 {
-			usageString := fmt.Sprintf("Defaulting container name to %s.", pod.Spec.Containers[0].Name)
-			fmt.Fprintf(o.ErrOut, "%s\n\r", usageString)
+		if pod, err = o.waitContainerReady(pod, containerName); err != nil {
+			return err
+		}
+		containerId, err = o.getContainerIdByName(pod, containerName)
+		if err != nil {
+			return err
 		}
-		containerName = pod.Spec.Containers[0].Name
 	}
 
-	containerId, err := o.getContainerIdByName(pod, containerName)
+	klog.V(4).Infof("container id: %s", containerId)
+	o.emit(event{Type: eventPodFound, Namespace: o.Namespace, Pod: pod.Name, Node: pod.Spec.NodeName})
+	if err := o.checkNodePolicy(pod.Spec.NodeName); err != nil {
+		return err
+	}
+	if len(containerName) > 0 {
+		o.emit(event{Type: eventContainerSelected, Container: containerName, ContainerID: containerId})
+	}
+
+	if o.InheritSecurityContext {
+		o.RuntimeArgs = mergeRuntimeArgs(inheritedRuntimeArgs(pod, containerName), o.RuntimeArgs)
+	}
+	volumes, err := o.volumeParams(pod, containerName)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("containerId:[%+v]\n\n", containerId)
+	if o.OutputSpec {
+		return o.printContainerSpec(pod, containerName, containerId, term.TTY{In: o.In}.IsTerminalIn())
+	}
 
-	t := o.setupTTY()
-	var sizeQueue remotecommand.TerminalSizeQueue
-	if t.Raw {
-		// this call spawns a goroutine to monitor/update the terminal size
-		sizeQueue = t.MonitorSize(t.GetSize())
-		// unset p.Err if it was previously set because both stdout and stderr go over p.Out when tty is
-		// true
-		o.ErrOut = nil
+	o.summary = &sessionSummary{
+		Namespace:         o.Namespace,
+		Pod:               o.PodName,
+		Node:              pod.Spec.NodeName,
+		Container:         containerName,
+		TargetContainerID: containerId,
+		Image:             o.Image,
+		Command:           o.containerCommand(),
+		StartTime:         time.Now(),
+	}
+
+	envFrom, err := o.envFromSources()
+	if err != nil {
+		return err
 	}
+	if o.registryAuthHeader, err = o.registryAuth(); err != nil {
+		return err
+	}
+
+	hookEnv := o.hookEnv(pod, containerName)
+	if err := o.runHook("pre_command", o.PreCommand, hookEnv); err != nil {
+		return err
+	}
+	defer func() {
+		if err := o.runHook("post_command", o.PostCommand, hookEnv); err != nil {
+			fmt.Fprintf(o.messageOut(), "warning: %v\n", err)
+		}
+	}()
 
+	if err := o.openSessionFiles(); err != nil {
+		return err
+	}
+	defer o.closeSessionFiles()
+
+	if o.WithLogsPane {
+		// stderr is reset below for tty sessions, so the logs pane takes it first
+		stopLogs, err := o.tailLogs(pod.Name, containerName, o.messageOut())
+		if err != nil {
+			return err
+		}
+		defer stopLogs()
+	}
+
+	t := o.setupTTY()
+	// the terminal is restored before the temporary pods are deleted on interrupt
+	t.Parent = o.interrupts
+	sizeQueue := o.monitorSize(&t)
+
+	var logsErr error
 	fn := func() error {
 
+		// the namespace and name of the agent pod are only needed by --port-forward
+		agentNamespace, agentPod := o.AgentNamespace, ""
+		if o.Agentless {
+			name, stopAgent, err := o.startAgentPod(pod.Spec.NodeName, o.agentRuntime(containerId))
+			if err != nil {
+				return err
+			}
+			defer stopAgent()
+			agentNamespace, agentPod = o.Namespace, name
+		}
+		agentURL, closeAgent, err := o.dialAgent(agentURLParams{
+			HostIP:    hostIP,
+			NodeName:  pod.Spec.NodeName,
+			Port:      o.AgentPort,
+			Namespace: o.Namespace,
+			Pod:       o.PodName,
+		}, agentNamespace, agentPod)
+		if err != nil {
+			return err
+		}
+		defer closeAgent()
+		o.emit(event{Type: eventDialing, Node: pod.Spec.NodeName, Agent: agentHostPort(agentURL)})
+		if err := o.checkAgentReachable(pod, agentHostPort(agentURL)); err != nil {
+			return err
+		}
+		if err := o.checkAgentVersion(agentURL, pod.Spec.NodeName); err != nil {
+			return err
+		}
+
 		// TODO: refactor as kubernetes api style, reuse rbac mechanism of kubernetes
-		uri, err := url.Parse(fmt.Sprintf("http://%s:%d", hostIP, o.AgentPort))
+		versionClient, err := o.agentHTTPClient(agentVersionTimeout)
 		if err != nil {
 			return err
 		}
-		uri.Path = fmt.Sprintf("/api/v1/debug")
+		features := &agentFeatures{client: versionClient, agentURL: agentURL}
 		params := url.Values{}
 		params.Add("image", o.Image)
-		params.Add("container", containerId)
-		bytes, err := json.Marshal(o.Command)
-		if err != nil {
+		if !t.Raw {
+			supported, err := features.has(featureNoTTY)
+			if err != nil {
+				return fmt.Errorf("cannot check whether the agent on node %s supports sessions without tty: %v", pod.Spec.NodeName, err)
+			}
+			if !supported {
+				return fmt.Errorf("agent on node %s is version %s, which does not support sessions without tty, "+
+					"upgrade the debug-agent DaemonSet or run kubectl debug with stdin and stdout in a terminal", pod.Spec.NodeName, features.version())
+			}
+			params.Add("tty", "false")
+		}
+		if o.ForceResize {
+			params.Add("forceresize", "true")
+		}
+		if o.QuietPull {
+			params.Add("quietpull", "true")
+		}
+		o.addTimeoutParams(params)
+		if o.RetainContainer {
+			params.Add("retain", "true")
+		}
+		if len(o.CPU) > 0 {
+			params.Add("cpu", o.CPU)
+		}
+		if len(o.Memory) > 0 {
+			params.Add("memory", o.Memory)
+		}
+		if o.Lxcfs {
+			params.Add("lxcfs", "true")
+		}
+		for _, volume := range volumes {
+			params.Add("volume", volume)
+		}
+		// agents which do not support it ignore this and always report success
+		params.Add("exitcode", "true")
+		for _, arg := range o.RuntimeArgs {
+			params.Add("runtimeArg", arg)
+		}
+		for _, server := range o.DNSServers {
+			params.Add("dnsServer", server)
+		}
+		for _, search := range o.DNSSearches {
+			params.Add("dnsSearch", search)
+		}
+		// explicit env comes last to override the referenced ConfigMaps and Secrets
+		for _, env := range append(envFrom, o.containerEnv(t.Raw)...) {
+			params.Add("env", env)
+		}
+		logsSession := ""
+		if len(o.SaveLogs) > 0 {
+			logsSession = rand.String(16)
+			params.Add("logsSession", logsSession)
+		}
+		if o.NoJoin {
+			params.Add("nojoin", "true")
+		} else {
+			params.Add("container", containerId)
+		}
+		body := url.Values{}
+		if err := o.addCommandParams(params, body, features, pod.Spec.NodeName); err != nil {
 			return err
 		}
-		params.Add("command", string(bytes))
-		uri.RawQuery = params.Encode()
+		o.requestBody = body
+		params.Add("namespace", o.Namespace)
+		params.Add("pod", o.PodName)
+		params.Add("containerName", containerName)
+		params.Add("user", o.currentUser())
+		if len(o.Runtime) > 0 {
+			params.Add("runtime", o.Runtime)
+		}
+		if !o.SkipArchCheck {
+			params.Add("arch", o.nodeArch(pod.Spec.NodeName))
+		}
+		uri := agentAPI(agentURL, "/api/v1/debug", params)
 
-		return o.remoteExecute("POST", uri, o.Config, o.In, o.Out, o.ErrOut, t.Raw, sizeQueue)
+		err = o.streamSession(uri, t.Raw, sizeQueue)
+		if len(logsSession) > 0 {
+			logsErr = o.saveLogs(agentURL, logsSession, o.SaveLogs)
+		}
+		return err
 	}
 
 	if err := t.Safe(fn); err != nil {
-		fmt.Printf("error execute remote, %v\n", err)
+		if timeoutErr := o.commandTimeoutErr(err); timeoutErr != nil {
+			return timeoutErr
+		}
+		if o.targetPodDeleted() {
+			return &podDeletedError{pod: o.targetPod.Name}
+		}
+		if code, ok := commandExitCode(err); ok {
+			o.emit(event{Type: eventExited, ExitCode: code})
+			return err
+		}
+		klog.V(4).Infof("error execute remote, %v", o.redact(err.Error()))
 		return err
 	}
+	if len(o.SaveLogs) > 0 {
+		if logsErr != nil {
+			fmt.Fprintf(o.messageOut(), "error saving logs of debug container: %v\n", logsErr)
+		} else {
+			fmt.Fprintf(o.messageOut(), "logs of debug container saved to %s\n", o.SaveLogs)
+		}
+	}
+	o.emit(event{Type: eventExited})
+
+	return nil
+}
+
+// containerCommand returns the entrypoint followed by the args of the debug container
+func (o *DebugOptions) containerCommand() []string {
+	if len(o.Entrypoint) < 1 {
+		return o.Command
+	}
+	return append([]string{o.Entrypoint}, o.Command...)
+}
+
+// containerEnv returns the env of the debug container, TERM is set from --term
+// for tty sessions unless it is given explicitly by --env
+func (o *DebugOptions) containerEnv(tty bool) []string {
+	env := o.Env
+	if !tty {
+		return env
+	}
+	for _, e := range env {
+		if strings.HasPrefix(e, "TERM=") {
+			return env
+		}
+	}
+	return append([]string{"TERM=" + o.Term}, env...)
+}
+
+// streamSession streams the debug session, closing it once idle for too long and
+// limiting the captured output of sessions without tty if configured
+func (o *DebugOptions) streamSession(uri *url.URL, tty bool, sizeQueue remotecommand.TerminalSizeQueue) error {
+	var stdin io.Reader = o.In
+	if !o.Stdin {
+		// an empty stdin closes the stdin of the debug container right away
+		stdin = strings.NewReader("")
+	}
+	var stdout, stderr io.Writer = flushWriter(o.Out), flushWriter(o.ErrOut)
+	if o.sessionOut != nil {
+		stdout = o.sessionOut
+		if !o.PreserveANSI {
+			stdout = newANSIStripper(stdout)
+		}
+	}
+	if o.sessionErr == o.sessionOut && o.sessionErr != nil {
+		// a single stripper keeps the shared file consistent
+		stderr = stdout
+	} else if o.sessionErr != nil {
+		stderr = o.sessionErr
+		if !o.PreserveANSI {
+			stderr = newANSIStripper(stderr)
+		}
+	}
+
+	// the progress of the agent goes to stderr without tty
+	stdout = o.watchProgress(stdout)
+	stderr = o.watchProgress(stderr)
+
+	if len(o.Transcript) > 0 {
+		transcript, err := newTranscript(o.Transcript, o.PreserveANSI)
+		if err != nil {
+			return fmt.Errorf("cannot create transcript: %v", err)
+		}
+		defer transcript.Close()
+		stdout = transcript.Wrap(stdout)
+		stderr = transcript.Wrap(stderr)
+	}
+
+	var stdoutLimit, stderrLimit *limitWriter
+	if !tty && o.MaxOutputBytes > 0 {
+		stdoutLimit = newLimitWriter(stdout, o.MaxOutputBytes)
+		stdout = stdoutLimit
+		if stderr != nil {
+			stderrLimit = newLimitWriter(stderr, o.MaxOutputBytes)
+			stderr = stderrLimit
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var watcher *idleWatcher
+	if o.IdleTimeout > 0 {
+		watcher = newIdleWatcher(o.IdleTimeout, cancel)
+		if o.Stdin && o.In != nil {
+			stdin = o.inputPump().Reader(watcher.Done())
+		}
+		stdin = watcher.WrapReader(stdin)
+		stdout = watcher.WrapWriter(stdout)
+		stderr = watcher.WrapWriter(stderr)
+		watcher.Start()
+		defer watcher.Stop()
+	}
+
+	if !tty && o.Stdin {
+		stdin = &stdinOnceReader{in: stdin, keepOpen: !o.StdinOnce, done: ctx.Done()}
+	}
 
+	var err error
+	if o.LocalExec {
+		err = o.localExecute(stdin, stdout, stderr, tty, sizeQueue)
+	} else {
+		err = o.remoteExecute(ctx, "POST", uri, o.Config, stdin, stdout, stderr, tty, sizeQueue)
+	}
+	if watcher != nil && watcher.Expired() {
+		fmt.Fprintf(o.Out, "\r\nsession closed due to inactivity after %s\r\n", o.IdleTimeout)
+	}
+	if stdoutLimit != nil && stdoutLimit.Truncated() {
+		fmt.Fprintf(o.messageOut(), "stdout truncated after %d bytes\n", o.MaxOutputBytes)
+	}
+	if stderrLimit != nil && stderrLimit.Truncated() {
+		fmt.Fprintf(o.messageOut(), "stderr truncated after %d bytes\n", o.MaxOutputBytes)
+	}
+	return err
+}
+
+// inputPump returns the pump of the input, which is kept for the sessions of --watch
+func (o *DebugOptions) inputPump() *inputPump {
+	if o.stdinPump == nil || o.stdinPump.in != o.In {
+		o.stdinPump = newInputPump(o.In)
+	}
+	return o.stdinPump
+}
+
+// openSessionFiles creates the files given by --out-file and --err-file
+func (o *DebugOptions) openSessionFiles() error {
+	if len(o.OutFile) > 0 {
+		file, err := os.Create(o.OutFile)
+		if err != nil {
+			return fmt.Errorf("cannot create --out-file: %v", err)
+		}
+		o.sessionOut = file
+	}
+	if len(o.ErrFile) > 0 {
+		if o.ErrFile == o.OutFile {
+			o.sessionErr = o.sessionOut
+			return nil
+		}
+		file, err := os.Create(o.ErrFile)
+		if err != nil {
+			o.closeSessionFiles()
+			return fmt.Errorf("cannot create --err-file: %v", err)
+		}
+		o.sessionErr = file
+	}
 	return nil
 }
 
+func (o *DebugOptions) closeSessionFiles() {
+	if o.sessionOut != nil {
+		o.sessionOut.Close()
+	}
+	if o.sessionErr != nil && o.sessionErr != o.sessionOut {
+		o.sessionErr.Close()
+	}
+}
+
+// messageOut returns the writer for messages of the plugin itself, which is
+// stderr unless it is merged into stdout by the tty
+func (o *DebugOptions) messageOut() io.Writer {
+	if o.ErrOut != nil {
+		return o.ErrOut
+	}
+	return o.Out
+}
+
+// defaultContainerName picks the target container when --container is not set, which is
+// the one named by the default container annotation, the first one matching
+// default_container_match of the config file, or the first ready container of the pod,
+// falling back to the first container if none is ready
+func (o *DebugOptions) defaultContainerName(pod *corev1.Pod) string {
+	if name := pod.Annotations[defaultContainerAnnotation]; len(name) > 0 {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == name {
+				return name
+			}
+		}
+	}
+	if o.DefaultContainerMatch != nil {
+		for _, container := range pod.Spec.Containers {
+			if o.DefaultContainerMatch.MatchString(container.Name) || o.DefaultContainerMatch.MatchString(container.Image) {
+				return container.Name
+			}
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		if containerReady(pod, container.Name) {
+			return container.Name
+		}
+	}
+	return pod.Spec.Containers[0].Name
+}
+
 func (o *DebugOptions) getContainerIdByName(pod *corev1.Pod, containerName string) (string, error) {
 	for _, containerStatus := range pod.Status.ContainerStatuses {
 		if containerStatus.Name != containerName {
@@ -303,10 +1491,85 @@ func (o *DebugOptions) getContainerIdByName(pod *corev1.Pod, containerName strin
 		}
 		return containerStatus.ContainerID, nil
 	}
-	return "", fmt.Errorf("cannot find specified container %s", containerName)
+	return "", containerNotFoundError(pod, containerName)
+}
+
+// getContainerById finds the container of the pod with the given id, which may be
+// a prefix of the full id, and returns its name and full id, regardless of its readiness
+func (o *DebugOptions) getContainerById(pod *corev1.Pod, id string) (string, string, error) {
+	runtime, bareId, err := splitContainerID(id)
+	if err != nil {
+		return "", "", err
+	}
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		statusRuntime, statusId, err := splitContainerID(containerStatus.ContainerID)
+		if err != nil || !strings.HasPrefix(statusId, bareId) {
+			continue
+		}
+		if len(runtime) > 0 && runtime != statusRuntime {
+			continue
+		}
+		if len(o.ContainerName) > 0 && o.ContainerName != containerStatus.Name {
+			return "", "", fmt.Errorf("container id %s belongs to container %s, not %s", id, containerStatus.Name, o.ContainerName)
+		}
+		return containerStatus.Name, containerStatus.ContainerID, nil
+	}
+	return "", "", fmt.Errorf("container id %s does not belong to pod %s", id, pod.Name)
+}
+
+// splitContainerID splits a container id in the form of [runtime://]id into
+// the runtime, which is empty for a bare id, and the hex id
+func splitContainerID(containerID string) (string, string, error) {
+	runtime, id := "", containerID
+	if i := strings.Index(containerID, "://"); i >= 0 {
+		runtime, id = containerID[:i], containerID[i+len("://"):]
+		if err := validateRuntime(runtime); err != nil {
+			return "", "", fmt.Errorf("invalid container id %q: %v", containerID, err)
+		}
+	}
+	if !containerIDPattern.MatchString(id) {
+		return "", "", fmt.Errorf("invalid container id %q, must be [runtime://]id with at least 12 hex digits", containerID)
+	}
+	return runtime, id, nil
+}
+
+// nodeArch returns the architecture of the node, or empty if it cannot be determined,
+// e.g. when getting nodes is forbidden, in which case the agent skips the check
+func (o *DebugOptions) nodeArch(nodeName string) string {
+	if len(nodeName) < 1 {
+		return ""
+	}
+	node, err := o.NodeClient.Nodes().Get(nodeName, v1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	return node.Status.NodeInfo.Architecture
+}
+
+// currentUser returns the user name of the current kubeconfig context,
+// falling back to the local os user
+func (o *DebugOptions) currentUser() string {
+	if o.Flags.AuthInfoName != nil && len(*o.Flags.AuthInfoName) > 0 {
+		return *o.Flags.AuthInfoName
+	}
+	rawConfig, err := o.Flags.ToRawKubeConfigLoader().RawConfig()
+	if err == nil {
+		contextName := rawConfig.CurrentContext
+		if o.Flags.Context != nil && len(*o.Flags.Context) > 0 {
+			contextName = *o.Flags.Context
+		}
+		if context, ok := rawConfig.Contexts[contextName]; ok && len(context.AuthInfo) > 0 {
+			return context.AuthInfo
+		}
+	}
+	if usr, err := user.Current(); err == nil {
+		return usr.Username
+	}
+	return ""
 }
 
 func (o *DebugOptions) remoteExecute(
+	ctx context.Context,
 	method string,
 	url *url.URL,
 	config *restclient.Config,
@@ -315,10 +1578,17 @@ func (o *DebugOptions) remoteExecute(
 	tty bool,
 	terminalSizeQueue remotecommand.TerminalSizeQueue) error {
 
-	exec, err := remotecommand.NewSPDYExecutor(config, method, url)
+	header := http.Header{}
+	if len(o.registryAuthHeader) > 0 {
+		header.Set(term.RegistryAuthHeader, o.registryAuthHeader)
+	}
+	exec, err := newSPDYExecutor(ctx, config, method, url, o.KeepaliveInterval, header, o.requestBody)
 	if err != nil {
 		return err
 	}
+	if terminalSizeQueue != nil && o.KeepaliveInterval > 0 {
+		terminalSizeQueue = newKeepaliveSizeQueue(terminalSizeQueue, o.KeepaliveInterval)
+	}
 	return exec.Stream(remotecommand.StreamOptions{
 		Stdin:             stdin,
 		Stdout:            stdout,
@@ -328,13 +1598,46 @@ func (o *DebugOptions) remoteExecute(
 	})
 }
 
+// monitorSize returns the queue of the terminal sizes for tty sessions, nil otherwise
+func (o *DebugOptions) monitorSize(t *term.TTY) remotecommand.TerminalSizeQueue {
+	if !t.Raw {
+		return nil
+	}
+	// this call spawns a goroutine to monitor/update the terminal size
+	initialSize := t.GetSize()
+	if o.ForceResize && (initialSize == nil || initialSize.Width < 1 || initialSize.Height < 1) {
+		initialSize = &remotecommand.TerminalSize{Width: defaultTerminalWidth, Height: defaultTerminalHeight}
+	}
+	t.FallbackSize = initialSize
+	if t.FallbackSize == nil {
+		t.FallbackSize = &remotecommand.TerminalSize{Width: defaultTerminalWidth, Height: defaultTerminalHeight}
+	}
+	sizeQueue := t.MonitorSize(initialSize)
+	// unset p.Err if it was previously set because both stdout and stderr go over p.Out when tty is
+	// true
+	o.ErrOut = nil
+	return sizeQueue
+}
+
 func (o *DebugOptions) setupTTY() term.TTY {
 	t := term.TTY{
 		Out: o.Out,
 	}
 	t.In = o.In
 	t.Raw = true
+	if len(o.OutFile) > 0 || len(o.ErrFile) > 0 {
+		// the output goes to files, which must not get terminal sequences
+		t.Raw = false
+		return t
+	}
+	if !o.TTY || !o.Stdin {
+		t.Raw = false
+		return t
+	}
 	if !t.IsTerminalIn() {
+		// fall back to a binary-safe stream without tty, so that piped
+		// data passes through byte for byte
+		t.Raw = false
 		if o.ErrOut != nil {
 			fmt.Fprintln(o.ErrOut, "Unable to use a TTY - input is not a terminal or the right kind of file")
 		}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+func TestDebugCmdTakesPodArgument(t *testing.T) {
+	cmd := NewDebugCmd(genericclioptions.NewTestIOStreamsDiscard())
+	var called bool
+	var podArgs []string
+	cmd.Run = func(c *cobra.Command, args []string) {
+		called, podArgs = true, args
+	}
+	cmd.SetArgs([]string{"mypod", "--", "ls"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("error running the debug command with a pod: %v", err)
+	}
+	if !called {
+		t.Fatalf("the debug command did not run")
+	}
+	if len(podArgs) < 1 || podArgs[0] != "mypod" {
+		t.Errorf("expected the pod as the first argument, got %v", podArgs)
+	}
+}
+
+func TestDebugCmdFindsSubcommands(t *testing.T) {
+	cmd := NewDebugCmd(genericclioptions.NewTestIOStreamsDiscard())
+	found, _, err := cmd.Find([]string{"sessions", "node1"})
+	if err != nil {
+		t.Fatalf("error finding the sessions command: %v", err)
+	}
+	if found.Name() != "sessions" {
+		t.Errorf("expected the sessions command, got %s", found.Name())
+	}
+}
+
+func TestContainerNotFoundListsCandidates(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "web"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "istio-proxy"}}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "app", Ready: true, ContainerID: "docker://abc"},
+			{Name: "istio-proxy", Ready: false},
+		}},
+	}
+	o := &DebugOptions{}
+	_, err := o.getContainerIdByName(pod, "ap")
+	if err == nil {
+		t.Fatal("expected an error for a missing container")
+	}
+	want := "cannot find specified container ap in pod web, available containers: app (ready), istio-proxy (not ready)"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+	if id, err := o.getContainerIdByName(pod, "app"); err != nil || id != "docker://abc" {
+		t.Errorf("got %q, %v, want the id of app", id, err)
+	}
+	if _, err := o.getContainerIdByName(pod, "istio-proxy"); err == nil || strings.Contains(err.Error(), "cannot find") {
+		t.Errorf("got %v, want a not ready error for istio-proxy", err)
+	}
+}
+
+func TestDefaultContainerSkipsUnreadyContainers(t *testing.T) {
+	pod := func(ready ...bool) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Name: "web", Annotations: map[string]string{}}}
+		for i, r := range ready {
+			name := []string{"istio-proxy", "app", "logger"}[i]
+			pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{Name: name, Image: name + ":latest"})
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{Name: name, Ready: r})
+		}
+		return pod
+	}
+	withAnnotation := pod(false, true, true)
+	withAnnotation.Annotations[defaultContainerAnnotation] = "logger"
+	withMissingAnnotation := pod(false, true, true)
+	withMissingAnnotation.Annotations[defaultContainerAnnotation] = "db"
+
+	tests := []struct {
+		name  string
+		pod   *corev1.Pod
+		match string
+		want  string
+	}{
+		{name: "first ready", pod: pod(true, true), want: "istio-proxy"},
+		{name: "first not ready", pod: pod(false, true, true), want: "app"},
+		{name: "only last ready", pod: pod(false, false, true), want: "logger"},
+		{name: "none ready", pod: pod(false, false), want: "istio-proxy"},
+		{name: "no status", pod: &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}}}, want: "app"},
+		{name: "annotation", pod: withAnnotation, want: "logger"},
+		{name: "missing annotation", pod: withMissingAnnotation, want: "app"},
+		{name: "match not ready", pod: pod(true, false), match: "^app", want: "app"},
+	}
+	for _, test := range tests {
+		o := &DebugOptions{}
+		if len(test.match) > 0 {
+			o.DefaultContainerMatch = regexp.MustCompile(test.match)
+		}
+		if got := o.defaultContainerName(test.pod); got != test.want {
+			t.Errorf("%s: got container %s, want %s", test.name, got, test.want)
+		}
+	}
+}
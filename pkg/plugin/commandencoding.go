@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+const (
+	// commandEncodingAuto uses body if the agent supports it, json otherwise
+	commandEncodingAuto = "auto"
+	// commandEncodingJSON sends the command as a json list in the query string,
+	// understood by every agent
+	commandEncodingJSON = "json"
+	// commandEncodingBase64 sends the json list base64 encoded in the query string,
+	// which is a third longer than json
+	commandEncodingBase64 = "base64"
+	// commandEncodingBody sends the json list in the form body of the debug request,
+	// which keeps long commands out of the query string whose length proxies limit
+	commandEncodingBody = "body"
+
+	// featureCommandBase64 is reported by the agents accepting a base64 encoded command
+	featureCommandBase64 = "command-base64"
+	// featureCommandBody is reported by the agents reading the command from the form body
+	featureCommandBody = "command-body"
+	// featureEntrypointArgs is reported by the agents accepting args apart from the command
+	featureEntrypointArgs = "entrypoint-args"
+	// featureNoTTY is reported by the agents honouring tty=false, older agents allocate
+	// a tty anyway, which corrupts binary streams
+	featureNoTTY = "no-tty"
+)
+
+var commandEncodings = []string{commandEncodingAuto, commandEncodingJSON, commandEncodingBase64, commandEncodingBody}
+
+func validateCommandEncoding(encoding string) error {
+	for _, supported := range commandEncodings {
+		if encoding == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported --command-encoding %q, must be one of %v", encoding, commandEncodings)
+}
+
+// addCommandParams adds the entrypoint and the args of the debug container to the
+// params of the debug request, or to its form body, encoded as set by --command-encoding
+func (o *DebugOptions) addCommandParams(params url.Values, body url.Values, features *agentFeatures, nodeName string) error {
+	command, args := o.Command, []string(nil)
+	if len(o.Entrypoint) > 0 {
+		command, args = []string{o.Entrypoint}, o.Command
+	}
+
+	if len(args) > 0 {
+		supported, err := features.has(featureEntrypointArgs)
+		if err != nil {
+			return fmt.Errorf("cannot check whether the agent on node %s supports --entrypoint with args: %v", nodeName, err)
+		}
+		if !supported {
+			return fmt.Errorf("agent on node %s is version %s, which does not support --entrypoint with args, "+
+				"upgrade the debug-agent DaemonSet or pass the entrypoint as the first argument instead", nodeName, features.version())
+		}
+	}
+
+	encoding := o.CommandEncoding
+	if encoding == commandEncodingAuto {
+		encoding = commandEncodingJSON
+		// agents which cannot tell their features only understand json
+		if supported, err := features.has(featureCommandBody); err == nil && supported {
+			encoding = commandEncodingBody
+		}
+	} else if feature := encodingFeature(encoding); len(feature) > 0 {
+		supported, err := features.has(feature)
+		if err != nil {
+			return fmt.Errorf("cannot check whether the agent on node %s supports --command-encoding=%s: %v", nodeName, encoding, err)
+		}
+		if !supported {
+			return fmt.Errorf("agent on node %s is version %s, which does not support --command-encoding=%s, "+
+				"upgrade the debug-agent DaemonSet or use --command-encoding=json", nodeName, features.version(), encoding)
+		}
+	}
+	target := params
+	switch encoding {
+	case commandEncodingBase64:
+		params.Add("commandencoding", commandEncodingBase64)
+	case commandEncodingBody:
+		// the agent reads the form of the body and the query string alike
+		target, encoding = body, commandEncodingJSON
+	}
+	if err := addEncodedParam(target, "command", command, encoding); err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return addEncodedParam(target, "args", args, encoding)
+	}
+	return nil
+}
+
+// encodingFeature returns the agent feature the command encoding requires, if any
+func encodingFeature(encoding string) string {
+	switch encoding {
+	case commandEncodingBase64:
+		return featureCommandBase64
+	case commandEncodingBody:
+		return featureCommandBody
+	}
+	return ""
+}
+
+func addEncodedParam(params url.Values, key string, value []string, encoding string) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if encoding == commandEncodingBase64 {
+		params.Add(key, base64.RawURLEncoding.EncodeToString(bytes))
+	} else {
+		params.Add(key, string(bytes))
+	}
+	return nil
+}
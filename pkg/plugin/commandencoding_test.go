@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	remoteapi "k8s.io/apimachinery/pkg/util/remotecommand"
+	kubeletremote "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
+)
+
+func decodeParam(t *testing.T, params url.Values, key string) []string {
+	value := params.Get(key)
+	if len(value) < 1 {
+		return nil
+	}
+	if params.Get("commandencoding") == commandEncodingBase64 {
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			t.Fatalf("cannot decode %s %q: %v", key, value, err)
+		}
+		value = string(decoded)
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(value), &list); err != nil {
+		t.Fatalf("cannot unmarshal %s %q: %v", key, value, err)
+	}
+	return list
+}
+
+func TestAddCommandParamsEntrypoint(t *testing.T) {
+	allFeatures := []string{featureCommandBase64, featureEntrypointArgs}
+	tests := []struct {
+		name       string
+		entrypoint string
+		command    []string
+		encoding   string
+		features   []string
+		want       []string
+		wantArgs   []string
+		wantErr    string
+	}{
+		{name: "command only", command: []string{"ls", "-l"}, encoding: commandEncodingAuto,
+			features: allFeatures, want: []string{"ls", "-l"}},
+		{name: "entrypoint without args", entrypoint: "/bin/sh", encoding: commandEncodingAuto,
+			features: allFeatures, want: []string{"/bin/sh"}},
+		{name: "entrypoint with args", entrypoint: "/bin/sh", command: []string{"-c", "echo 'a b' && ls"}, encoding: commandEncodingAuto,
+			features: allFeatures, want: []string{"/bin/sh"}, wantArgs: []string{"-c", "echo 'a b' && ls"}},
+		{name: "entrypoint with args as json", entrypoint: "/bin/sh", command: []string{"-c", "id"}, encoding: commandEncodingJSON,
+			features: allFeatures, want: []string{"/bin/sh"}, wantArgs: []string{"-c", "id"}},
+		{name: "entrypoint with args to an agent without base64", entrypoint: "tcpdump", command: []string{"-i", "any"}, encoding: commandEncodingAuto,
+			features: []string{featureEntrypointArgs}, want: []string{"tcpdump"}, wantArgs: []string{"-i", "any"}},
+		{name: "entrypoint with args to an old agent", entrypoint: "tcpdump", command: []string{"-i", "any"}, encoding: commandEncodingAuto,
+			features: []string{featureCommandBase64}, wantErr: "does not support --entrypoint with args"},
+		{name: "entrypoint without args to an old agent", entrypoint: "tcpdump", encoding: commandEncodingAuto,
+			want: []string{"tcpdump"}},
+	}
+	for _, test := range tests {
+		o := &DebugOptions{Entrypoint: test.entrypoint, Command: test.command, CommandEncoding: test.encoding}
+		features := &agentFeatures{info: &agentInfo{Version: "0.2.0", Features: test.features}}
+		params := url.Values{}
+
+		err := o.addCommandParams(params, url.Values{}, features, "node1")
+		if len(test.wantErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if got := decodeParam(t, params, "command"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got command %q, want %q", test.name, got, test.want)
+		}
+		if got := decodeParam(t, params, "args"); !reflect.DeepEqual(got, test.wantArgs) {
+			t.Errorf("%s: got args %q, want %q", test.name, got, test.wantArgs)
+		}
+		if got := o.containerCommand(); !reflect.DeepEqual(got, append(test.want, test.wantArgs...)) {
+			t.Errorf("%s: got container command %q, want %q", test.name, got, append(test.want, test.wantArgs...))
+		}
+	}
+}
+
+// TestCommandEncodingsRoundTrip sends a command with quotes, spaces and non-ascii
+// characters to a fake agent decoding it like the agent does, in every encoding
+func TestCommandEncodingsRoundTrip(t *testing.T) {
+	command := []string{"sh", "-c", `echo "héllo  wörld" 'it''s' && printf '%s\n' 日本語 ` + "`id -u`"}
+	for _, encoding := range []string{commandEncodingJSON, commandEncodingBase64, commandEncodingBody} {
+		var received []string
+		var inQuery bool
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			inQuery = len(req.URL.Query().Get("command")) > 0
+			value := req.FormValue("command")
+			if req.FormValue("commandencoding") == commandEncodingBase64 {
+				decoded, err := base64.RawURLEncoding.DecodeString(value)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				value = string(decoded)
+			}
+			if err := json.Unmarshal([]byte(value), &received); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			opts := &kubeletremote.Options{Stdin: true, Stdout: true, Stderr: true}
+			kubeletremote.ServeExec(w, req, execFunc(func(in io.Reader, out, errOut io.WriteCloser) error {
+				_, err := io.Copy(out, in)
+				return err
+			}), "", "", "", []string{"debug"}, opts, time.Minute, 10*time.Second, remoteapi.SupportedStreamingProtocols)
+		}))
+
+		var out, errOut bytes.Buffer
+		o, uri := newStreamOptions(t, agent, strings.NewReader("ok"), &out, &errOut)
+		o.Command, o.CommandEncoding = command, encoding
+		features := &agentFeatures{info: &agentInfo{Features: []string{featureCommandBase64, featureCommandBody}}}
+		params, body := url.Values{}, url.Values{}
+		if err := o.addCommandParams(params, body, features, "node1"); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		o.requestBody = body
+		uri.RawQuery = params.Encode()
+
+		err := o.streamSession(uri, false, nil)
+		agent.Close()
+		if err != nil {
+			t.Fatalf("%s: error streaming: %v", encoding, err)
+		}
+		if !reflect.DeepEqual(received, command) {
+			t.Errorf("%s: agent received %q, want %q", encoding, received, command)
+		}
+		if inQuery == (encoding == commandEncodingBody) {
+			t.Errorf("%s: command in the query string is %v", encoding, inQuery)
+		}
+		if out.String() != "ok" {
+			t.Errorf("%s: got output %q, want ok", encoding, out.String())
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"io"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"sort"
+	"strings"
+)
+
+const (
+	// completionExecutable is the command the scripts complete, kubectl does not
+	// complete plugins, so `kubectl debug` itself is not completed
+	completionExecutable = "kubectl-debug"
+	// completionTimeout bounds the api requests of the completion, unless --request-timeout is set
+	completionTimeout = "5s"
+)
+
+// completionFlags are the flags whose values are completed with the names of __complete-names
+var completionFlags = map[string]string{
+	"namespace":       "namespaces",
+	"agent-namespace": "namespaces",
+	"context":         "contexts",
+	"container":       "containers",
+	"timeout-profile": "profiles",
+}
+
+// completionFileFlags are the flags whose values are local files
+var completionFileFlags = []string{"kubeconfig", "debug-config", "bundle", "transcript", "out-file", "err-file",
+	"audit-file", "registry-config"}
+
+// markCompletionFlags annotates the flags of the debug command for the bash completion,
+// the zsh and fish scripts are generated from the same annotations
+func markCompletionFlags(cmd *cobra.Command) {
+	for _, flags := range []*pflag.FlagSet{cmd.Flags(), cmd.PersistentFlags()} {
+		for name, kind := range completionFlags {
+			if flags.Lookup(name) != nil {
+				flags.SetAnnotation(name, cobra.BashCompCustom, []string{"__kubectl_debug_complete_" + kind})
+			}
+		}
+		for _, name := range completionFileFlags {
+			if flags.Lookup(name) != nil {
+				flags.SetAnnotation(name, cobra.BashCompFilenameExt, nil)
+			}
+		}
+	}
+}
+
+// NewCompletionCmd returns a cobra command printing the completion script of a shell
+func NewCompletionCmd(opts *DebugOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:       "completion SHELL",
+		Short:     "Print the completion script of bash, zsh or fish",
+		Long:      completionLongDesc,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		Run: func(c *cobra.Command, args []string) {
+			if err := writeCompletion(opts.Out, c.Root(), args[0]); err != nil {
+				fmt.Fprintln(opts.ErrOut, err)
+			}
+		},
+	}
+}
+
+// NewCompleteNamesCmd returns the hidden command the completion scripts run to list
+// the names of pods, containers, namespaces, kubeconfig contexts and timeout profiles
+func NewCompleteNamesCmd(opts *DebugOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:    "__complete-names KIND [POD]",
+		Hidden: true,
+		Args:   cobra.RangeArgs(1, 2),
+		Run: func(c *cobra.Command, args []string) {
+			names, err := opts.CompletionNames(args[0], args[1:])
+			if err != nil {
+				// nothing is completed, an error would mess up the command line
+				klog.V(2).Infof("error completing %s: %v", args[0], opts.redact(err.Error()))
+				return
+			}
+			for _, name := range names {
+				fmt.Fprintln(opts.Out, name)
+			}
+		},
+	}
+}
+
+// CompletionNames returns the names of a kind for the completion, the containers of the pod
+// given in args, in the namespace and with the context of the kubeconfig flags
+func (o *DebugOptions) CompletionNames(kind string, args []string) ([]string, error) {
+	var names []string
+	switch kind {
+	case "contexts":
+		config, err := o.Flags.ToRawKubeConfigLoader().RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		for name := range config.Contexts {
+			names = append(names, name)
+		}
+	case "profiles":
+		config, err := o.loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		names = timeoutProfileNames(config.TimeoutProfiles)
+	case "namespaces", "pods", "containers":
+		if o.Flags.Timeout != nil && (len(*o.Flags.Timeout) < 1 || *o.Flags.Timeout == "0") {
+			*o.Flags.Timeout = completionTimeout
+		}
+		if err := o.completeClient(); err != nil {
+			return nil, err
+		}
+		namespace, _, err := o.Flags.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case "namespaces":
+			list, err := o.KubeCli.CoreV1().Namespaces().List(v1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			for _, ns := range list.Items {
+				names = append(names, ns.Name)
+			}
+		case "pods":
+			list, err := o.PodClient.Pods(namespace).List(v1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			for _, pod := range list.Items {
+				names = append(names, pod.Name)
+			}
+		case "containers":
+			// workloads and nodes are resolved to a pod only when debugging
+			if len(args) < 1 || strings.Contains(args[0], "/") {
+				return nil, nil
+			}
+			pod, err := o.PodClient.Pods(namespace).Get(args[0], v1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			for _, container := range pod.Spec.Containers {
+				names = append(names, container.Name)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown kind %q, must be one of pods, containers, namespaces, contexts or profiles", kind)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// writeCompletion writes the completion script of the shell for the debug command
+func writeCompletion(out io.Writer, cmd *cobra.Command, shell string) error {
+	switch shell {
+	case "bash":
+		return writeBashCompletion(out, cmd)
+	case "zsh":
+		return writeZshCompletion(out, cmd)
+	case "fish":
+		return writeFishCompletion(out, cmd)
+	}
+	return fmt.Errorf("unsupported shell %q, must be one of bash, zsh or fish", shell)
+}
+
+const bashCompletionFunctions = `__kubectl_debug_scope()
+{
+    local flag
+    for flag in -n --namespace --context --kubeconfig; do
+        if [[ -n ${flaghash[${flag}=]} ]]; then
+            echo "${flag}=${flaghash[${flag}=]}"
+        elif [[ -n ${flaghash[${flag}]} ]]; then
+            echo "${flag}=${flaghash[${flag}]}"
+        fi
+    done
+}
+
+__kubectl_debug_names()
+{
+    local names
+    names=$(kubectl-debug __complete-names "$@" $(__kubectl_debug_scope) 2>/dev/null)
+    COMPREPLY+=( $(compgen -W "${names}" -- "${cur}") )
+}
+
+__kubectl_debug_complete_namespaces()
+{
+    __kubectl_debug_names namespaces
+}
+
+__kubectl_debug_complete_contexts()
+{
+    __kubectl_debug_names contexts
+}
+
+__kubectl_debug_complete_profiles()
+{
+    __kubectl_debug_names profiles
+}
+
+# the pod is the first argument, so the containers are only completed after it
+__kubectl_debug_complete_containers()
+{
+    if [[ ${#nouns[@]} -gt 0 ]]; then
+        __kubectl_debug_names containers "${nouns[0]}"
+    fi
+}
+
+__custom_func()
+{
+    if [[ ${last_command} == debug && ${#nouns[@]} -eq 0 ]]; then
+        __kubectl_debug_names pods
+    fi
+}
+`
+
+func writeBashCompletion(out io.Writer, cmd *cobra.Command) error {
+	cmd.BashCompletionFunction = bashCompletionFunctions
+	var buf bytes.Buffer
+	if err := cmd.GenBashCompletion(&buf); err != nil {
+		return err
+	}
+	// cobra only completes the arguments when no subcommand matches, the pods are
+	// completed along with the subcommands instead
+	script := strings.Replace(buf.String(),
+		"if [[ ${#COMPREPLY[@]} -eq 0 ]]; then\n        declare -F __custom_func",
+		"if [[ ${#COMPREPLY[@]} -eq 0 || ${last_command} == debug ]]; then\n        declare -F __custom_func", 1)
+	// the script completes the name of the root command, which is not the executable
+	script += fmt.Sprintf(`if [[ $(type -t compopt) = "builtin" ]]; then
+    complete -o default -F __start_%[1]s %[2]s
+else
+    complete -o default -o nospace -F __start_%[1]s %[2]s
+fi
+`, cmd.Name(), completionExecutable)
+	_, err := io.WriteString(out, script)
+	return err
+}
+
+// completionFlag is a flag of the debug command as the zsh and fish scripts complete it
+type completionFlag struct {
+	name      string
+	shorthand string
+	usage     string
+	takesArg  bool
+	repeated  bool
+	files     bool
+	// names is the kind of __complete-names completing the value
+	names string
+}
+
+func completionFlagsOf(cmd *cobra.Command) []completionFlag {
+	var flags []completionFlag
+	cmd.LocalFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Hidden || len(f.Deprecated) > 0 {
+			return
+		}
+		_, files := f.Annotations[cobra.BashCompFilenameExt]
+		flags = append(flags, completionFlag{
+			name:      f.Name,
+			shorthand: f.Shorthand,
+			usage:     strings.SplitN(f.Usage, "\n", 2)[0],
+			takesArg:  len(f.NoOptDefVal) < 1,
+			repeated:  strings.HasSuffix(f.Value.Type(), "Slice") || strings.HasSuffix(f.Value.Type(), "Array"),
+			files:     files,
+			names:     completionFlags[f.Name],
+		})
+	})
+	return flags
+}
+
+func completionCommandsOf(cmd *cobra.Command) []*cobra.Command {
+	var commands []*cobra.Command
+	for _, c := range cmd.Commands() {
+		if c.IsAvailableCommand() && c.Name() != "help" {
+			commands = append(commands, c)
+		}
+	}
+	return commands
+}
+
+const zshCompletionFunctions = `#compdef kubectl-debug
+
+__kubectl_debug_scope() {
+    local flag
+    for flag in -n --namespace --context --kubeconfig; do
+        (( $+opt_args[$flag] )) && print -r -- "$flag=${opt_args[$flag]}"
+    done
+}
+
+__kubectl_debug_names() {
+    local -a names
+    names=(${(f)"$(kubectl-debug __complete-names "$@" ${(f)"$(__kubectl_debug_scope)"} 2>/dev/null)"})
+    compadd -a names
+}
+
+# the pod is the first argument, so the containers are only completed after it
+__kubectl_debug_containers() {
+    (( ${#line} > 0 )) && __kubectl_debug_names containers "$line[1]"
+}
+
+`
+
+func writeZshCompletion(out io.Writer, cmd *cobra.Command) error {
+	var buf bytes.Buffer
+	buf.WriteString(zshCompletionFunctions)
+	buf.WriteString("__kubectl_debug_first() {\n    local -a commands\n    commands=(\n")
+	for _, c := range completionCommandsOf(cmd) {
+		fmt.Fprintf(&buf, "        %s\n", shellQuote(c.Name()+":"+c.Short))
+	}
+	buf.WriteString("    )\n    _describe -t commands command commands\n    __kubectl_debug_names pods\n}\n\n")
+
+	buf.WriteString("_kubectl_debug() {\n    _arguments \\\n")
+	for _, f := range completionFlagsOf(cmd) {
+		action := ""
+		if f.takesArg {
+			switch {
+			case f.names == "containers":
+				action = ":" + f.name + ":__kubectl_debug_containers"
+			case len(f.names) > 0:
+				action = ":" + f.name + ":__kubectl_debug_names " + f.names
+			case f.files:
+				action = ":" + f.name + ":_files"
+			default:
+				action = ":" + f.name + ": "
+			}
+		}
+		exclusion := ""
+		if f.repeated {
+			exclusion = "*"
+		} else if len(f.shorthand) > 0 {
+			exclusion = fmt.Sprintf("(-%s --%s)", f.shorthand, f.name)
+		}
+		description := "[" + zshEscapeDescription(f.usage) + "]"
+		if len(f.shorthand) > 0 {
+			short := "-" + f.shorthand
+			if f.takesArg {
+				short += "+"
+			}
+			fmt.Fprintf(&buf, "        %s \\\n", shellQuote(exclusion+short+description+action))
+		}
+		long := "--" + f.name
+		if f.takesArg {
+			long += "="
+		}
+		fmt.Fprintf(&buf, "        %s \\\n", shellQuote(exclusion+long+description+action))
+	}
+	buf.WriteString("        '1: :__kubectl_debug_first'\n}\n\n")
+	buf.WriteString(`if [[ "$funcstack[1]" == "_kubectl-debug" ]]; then
+    _kubectl_debug "$@"
+else
+    compdef _kubectl_debug kubectl-debug
+fi
+`)
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+func zshEscapeDescription(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(s)
+}
+
+// shellQuote quotes s in single quotes for zsh and fish
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+const fishCompletionFunctions = `function __kubectl_debug_scope
+    set -l words (commandline -opc)
+    for i in (seq 2 (count $words))
+        switch $words[$i]
+            case -n --namespace --context --kubeconfig
+                if test $i -lt (count $words)
+                    echo $words[$i]=$words[(math $i + 1)]
+                end
+            case '-n=*' '--namespace=*' '--context=*' '--kubeconfig=*'
+                echo $words[$i]
+        end
+    end
+end
+
+function __kubectl_debug_names
+    kubectl-debug __complete-names $argv (__kubectl_debug_scope) 2>/dev/null
+end
+
+# __kubectl_debug_pod prints the first argument, which is neither a flag nor the value of one
+function __kubectl_debug_pod
+    set -l words (commandline -opc)
+    set -l skip 0
+    for word in $words[2..-1]
+        if test $skip -eq 1
+            set skip 0
+            continue
+        end
+        if contains -- $word $__kubectl_debug_value_flags
+            set skip 1
+        else if not string match -q -- '-*' $word
+            echo $word
+            return 0
+        end
+    end
+    return 1
+end
+
+function __kubectl_debug_containers
+    set -l pod (__kubectl_debug_pod); or return
+    __kubectl_debug_names containers $pod
+end
+
+complete -c kubectl-debug -f
+complete -c kubectl-debug -n 'not __kubectl_debug_pod >/dev/null' -a '(__kubectl_debug_names pods)'
+`
+
+func writeFishCompletion(out io.Writer, cmd *cobra.Command) error {
+	var buf bytes.Buffer
+	flags := completionFlagsOf(cmd)
+	var valueFlags []string
+	for _, f := range flags {
+		if f.takesArg {
+			if len(f.shorthand) > 0 {
+				valueFlags = append(valueFlags, "-"+f.shorthand)
+			}
+			valueFlags = append(valueFlags, "--"+f.name)
+		}
+	}
+	fmt.Fprintf(&buf, "set -g __kubectl_debug_value_flags %s\n\n", strings.Join(valueFlags, " "))
+	buf.WriteString(fishCompletionFunctions)
+	for _, c := range completionCommandsOf(cmd) {
+		fmt.Fprintf(&buf, "complete -c kubectl-debug -n 'not __kubectl_debug_pod >/dev/null' -a %s -d %s\n",
+			c.Name(), shellQuote(c.Short))
+		if len(c.ValidArgs) > 0 {
+			fmt.Fprintf(&buf, "complete -c kubectl-debug -n '__fish_seen_subcommand_from %s' -a %s\n",
+				c.Name(), shellQuote(strings.Join(c.ValidArgs, " ")))
+		}
+	}
+	for _, f := range flags {
+		line := "complete -c kubectl-debug -l " + f.name
+		if len(f.shorthand) > 0 {
+			line += " -s " + f.shorthand
+		}
+		if f.takesArg {
+			line += " -r"
+			switch {
+			case f.names == "containers":
+				line += " -a '(__kubectl_debug_containers)'"
+			case len(f.names) > 0:
+				line += " -a '(__kubectl_debug_names " + f.names + ")'"
+			case f.files:
+				line += " -F"
+			}
+		}
+		buf.WriteString(line + " -d " + shellQuote(f.usage) + "\n")
+	}
+	_, err := buf.WriteTo(out)
+	return err
+}
+
+const completionLongDesc = `
+Print the completion script of bash, zsh or fish for kubectl-debug, which completes the
+flags, the subcommands and the names of pods, containers, namespaces, kubeconfig contexts
+and timeout profiles, queried from the cluster of the current context when completing.
+
+  # bash, requires the bash-completion package
+  source <(kubectl-debug completion bash)
+  # zsh
+  source <(kubectl-debug completion zsh)
+  # fish
+  kubectl-debug completion fish | source
+`
@@ -1,23 +1,94 @@
 package plugin
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/version"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
 )
 
+const (
+	// PrecedenceFlagsFirst lets the flags override the config file
+	PrecedenceFlagsFirst = "flags-first"
+	// PrecedenceConfigFirst lets the config file override the flags
+	PrecedenceConfigFirst = "config-first"
+)
+
+// supportedRuntimes are the container runtimes the agent is able to debug
+var supportedRuntimes = []string{"docker", "containerd", "cri-o"}
+
 type Config struct {
-	AgentPort int      `yaml:"agent_port,omitempty"`
-	Image     string   `yaml:"image,omitempty"`
-	Command   []string `yaml:"command,omitempty"`
+	AgentPort int    `yaml:"agent_port,omitempty"`
+	Image     string `yaml:"image,omitempty"`
+	// Command is the entrypoint of the debug container, it must be a yaml list,
+	// e.g. ["/bin/sh", "-c", "top"], and is used verbatim
+	Command []string `yaml:"command,omitempty"`
+	// IdleTimeout is the default of --idle-timeout
+	IdleTimeout time.Duration `yaml:"idle_timeout,omitempty"`
+	// Runtime forces the container runtime of the target container instead of
+	// detecting it from the container id prefix, overridden by --runtime
+	Runtime string `yaml:"runtime,omitempty"`
+	// SSHBastion is used to reach the agent when --ssh-bastion is set
+	SSHBastion *SSHBastionConfig `yaml:"ssh_bastion,omitempty"`
+	// PreCommand is run locally before the session starts, the session is
+	// aborted if it fails
+	PreCommand []string `yaml:"pre_command,omitempty"`
+	// PostCommand is run locally after the session ends
+	PostCommand []string `yaml:"post_command,omitempty"`
+	// Precedence decides whether the flags or the config file win when both
+	// set the image, command or agent port, default to flags-first
+	Precedence string `yaml:"precedence,omitempty"`
+	// Defaults maps flag names to the values used when the flag is not set
+	// on the command line, they take effect as if they were set there
+	Defaults map[string]string `yaml:"defaults,omitempty"`
+	// MinAgentVersion and MaxAgentVersion bound the versions of the agent
+	// the plugin works with, both inclusive
+	MinAgentVersion string `yaml:"min_agent_version,omitempty"`
+	MaxAgentVersion string `yaml:"max_agent_version,omitempty"`
+	// DefaultContainerMatch is a regular expression matched against the name
+	// and the image of the containers to pick the target container when
+	// --container is not set
+	DefaultContainerMatch string `yaml:"default_container_match,omitempty"`
+	// SensitiveKeys are redacted from the output of the plugin in addition to
+	// the built-in ones such as token, password and secret
+	SensitiveKeys []string `yaml:"sensitive_keys,omitempty"`
+	// UpdateURL is queried for the latest release by --check-update,
+	// e.g. a mirror in air-gapped environments
+	UpdateURL string `yaml:"update_url,omitempty"`
+	// RetainNamespaces are glob patterns, e.g. staging-*, of the namespaces whose
+	// debug containers are retained, unless --retain or --no-retain is set
+	RetainNamespaces []string `yaml:"retain_namespaces,omitempty"`
+	// ForbiddenNodeLabels and AllowedNodeLabels are label selectors, e.g. pool=gpu,
+	// the plugin refuses to debug on a node matching any of the forbidden ones or,
+	// if allowed ones are set, matching none of them
+	ForbiddenNodeLabels []string `yaml:"forbidden_node_labels,omitempty"`
+	AllowedNodeLabels   []string `yaml:"allowed_node_labels,omitempty"`
+	// TimeoutProfiles override the flags of the built-in timeout profiles by
+	// name, or add new profiles, selected by --timeout-profile
+	TimeoutProfiles map[string]map[string]string `yaml:"timeout_profiles,omitempty"`
+	// AgentAnnotations are the agent annotations of the target pod which are honoured,
+	// e.g. debug.kubectl.io/agent-port. They are ignored unless listed, as they decide
+	// where the credentials of the debug stream are sent
+	AgentAnnotations []string `yaml:"agent_annotations,omitempty"`
 }
 
 func Load(s string) (*Config, error) {
 	cfg := &Config{}
 
-	err := yaml.UnmarshalStrict([]byte(s), cfg)
+	err := unmarshalConfig([]byte(s), cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
@@ -28,3 +99,166 @@ func LoadFile(filename string) (*Config, error) {
 	}
 	return Load(string(c))
 }
+
+// mergeFile reads a config file over c: scalars override, lists replace the
+// ones of c, and maps, e.g. defaults, as well as sections such as ssh_bastion,
+// are merged key by key, a profile of timeout_profiles is replaced as a whole.
+// The result is not validated, as a file may rely on the ones merged before it
+func (c *Config) mergeFile(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	// the strict decoding into an empty config catches unknown keys, it cannot
+	// decode over c, where it would refuse the keys of maps already set
+	if err := unmarshalConfig(content, &Config{}); err != nil {
+		return err
+	}
+	return yaml.Unmarshal(content, c)
+}
+
+// unmarshalConfig decodes a config strictly, a value of the wrong type, e.g. a string
+// where a list is expected, is reported with its key and the form the key accepts, as
+// yaml only reports the line and the go type
+func unmarshalConfig(content []byte, out interface{}) error {
+	err := yaml.UnmarshalStrict(content, out)
+	if _, ok := err.(*yaml.TypeError); !ok {
+		return err
+	}
+	var keys yaml.MapSlice
+	if yaml.Unmarshal(content, &keys) != nil {
+		return err
+	}
+	for _, item := range keys {
+		key, ok := item.Key.(string)
+		if !ok {
+			continue
+		}
+		value, marshalErr := yaml.Marshal(yaml.MapSlice{item})
+		if marshalErr != nil {
+			continue
+		}
+		if _, ok := yaml.Unmarshal(value, &Config{}).(*yaml.TypeError); ok {
+			return fmt.Errorf("invalid %s, must be %s: %v", key, configKeyForm(key), err)
+		}
+	}
+	return err
+}
+
+// configKeyForm describes the yaml accepted by the key of the config
+func configKeyForm(key string) string {
+	if key == "command" {
+		return `a list of strings, e.g. ["/bin/sh", "-c", "top"]`
+	}
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		if strings.Split(field.Tag.Get("yaml"), ",")[0] != key {
+			continue
+		}
+		if field.Type == reflect.TypeOf(time.Duration(0)) {
+			return "a duration, e.g. 30m"
+		}
+		switch field.Type.Kind() {
+		case reflect.Slice:
+			return "a list of strings, e.g. [a, b]"
+		case reflect.Map:
+			return "a map of keys to values"
+		case reflect.Ptr, reflect.Struct:
+			return "a section of keys"
+		case reflect.Int, reflect.Int64:
+			return "a number"
+		case reflect.Bool:
+			return "true or false"
+		}
+		return "a string"
+	}
+	return "a valid value"
+}
+
+func (c *Config) validate() error {
+	if c.Command != nil && len(c.Command) < 1 {
+		return fmt.Errorf("command must be a non-empty list of strings, e.g. [\"/bin/sh\", \"-c\", \"top\"]")
+	}
+	for i, arg := range c.Command {
+		if len(arg) < 1 {
+			return fmt.Errorf("command[%d] must not be empty", i)
+		}
+	}
+	if c.PreCommand != nil && len(c.PreCommand) < 1 {
+		return fmt.Errorf("pre_command must be a non-empty list of strings")
+	}
+	if c.PostCommand != nil && len(c.PostCommand) < 1 {
+		return fmt.Errorf("post_command must be a non-empty list of strings")
+	}
+	switch c.Precedence {
+	case "", PrecedenceFlagsFirst, PrecedenceConfigFirst:
+	default:
+		return fmt.Errorf("unsupported precedence %q, must be one of %s, %s", c.Precedence, PrecedenceFlagsFirst, PrecedenceConfigFirst)
+	}
+	if len(c.MinAgentVersion) > 0 {
+		if _, err := version.ParseGeneric(c.MinAgentVersion); err != nil {
+			return fmt.Errorf("invalid min_agent_version: %v", err)
+		}
+	}
+	if len(c.MaxAgentVersion) > 0 {
+		if _, err := version.ParseGeneric(c.MaxAgentVersion); err != nil {
+			return fmt.Errorf("invalid max_agent_version: %v", err)
+		}
+	}
+	if len(c.DefaultContainerMatch) > 0 {
+		if _, err := regexp.Compile(c.DefaultContainerMatch); err != nil {
+			return fmt.Errorf("invalid default_container_match: %v", err)
+		}
+	}
+	if len(c.Runtime) > 0 {
+		if err := validateRuntime(c.Runtime); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range c.RetainNamespaces {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid retain_namespaces pattern %q: %v", pattern, err)
+		}
+	}
+	for _, selector := range append(c.ForbiddenNodeLabels, c.AllowedNodeLabels...) {
+		if _, err := labels.Parse(selector); err != nil {
+			return fmt.Errorf("invalid node label selector %q: %v", selector, err)
+		}
+	}
+	if len(c.UpdateURL) > 0 {
+		if u, err := url.Parse(c.UpdateURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid update_url %q, must be a http or https url", c.UpdateURL)
+		}
+	}
+	for _, annotation := range c.AgentAnnotations {
+		if !isAgentAnnotation(annotation) {
+			return fmt.Errorf("unsupported agent_annotations %q, must be one of %s", annotation, strings.Join(agentAnnotations, ", "))
+		}
+	}
+	if c.SSHBastion != nil {
+		if err := c.SSHBastion.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retainNamespace returns true if a pattern of retain_namespaces matches the namespace
+func (c *Config) retainNamespace(namespace string) bool {
+	for _, pattern := range c.RetainNamespaces {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func validateRuntime(runtime string) error {
+	for _, supported := range supportedRuntimes {
+		if runtime == supported {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported runtime %q, must be one of %v", runtime, supportedRuntimes)
+}
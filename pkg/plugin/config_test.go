@@ -0,0 +1,154 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLoadCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		command []string
+		err     string
+	}{
+		{
+			name:    "flow list",
+			config:  `command: ["/bin/sh", "-c", "top"]`,
+			command: []string{"/bin/sh", "-c", "top"},
+		},
+		{
+			name:    "block list",
+			config:  "command:\n- /bin/sh\n- -c\n- ls -l /proc\n",
+			command: []string{"/bin/sh", "-c", "ls -l /proc"},
+		},
+		{
+			name:   "string",
+			config: `command: /bin/sh -c top`,
+			err:    `invalid command, must be a list of strings, e.g. ["/bin/sh", "-c", "top"]: yaml: unmarshal errors:`,
+		},
+		{
+			name:   "string after other keys",
+			config: "image: busybox\ncommand: top\n",
+			err:    "invalid command, must be a list of strings",
+		},
+		{
+			name:   "string for a map",
+			config: "defaults: quiet-pull\n",
+			err:    "invalid defaults, must be a map of keys to values",
+		},
+		{
+			name:   "empty list",
+			config: `command: []`,
+			err:    "command must be a non-empty list of strings",
+		},
+		{
+			name:   "empty argument",
+			config: `command: ["/bin/sh", ""]`,
+			err:    "command[1] must not be empty",
+		},
+		{
+			name:   "not set",
+			config: `image: busybox`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := Load(test.config)
+			if len(test.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config.Command, test.command) {
+				t.Errorf("expected command %q, got %q", test.command, config.Command)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{name: "empty"},
+		{name: "command", config: Config{Command: []string{"bash"}}},
+		{name: "empty command", config: Config{Command: []string{}}, err: "command must be a non-empty list"},
+		{name: "empty pre_command", config: Config{PreCommand: []string{}}, err: "pre_command must be a non-empty list"},
+		{name: "empty post_command", config: Config{PostCommand: []string{}}, err: "post_command must be a non-empty list"},
+		{name: "precedence", config: Config{Precedence: PrecedenceConfigFirst}},
+		{name: "unknown precedence", config: Config{Precedence: "both"}, err: "unsupported precedence"},
+		{name: "unknown runtime", config: Config{Runtime: "rkt"}, err: "unsupported runtime"},
+		{name: "invalid agent version", config: Config{MinAgentVersion: "latest"}, err: "invalid min_agent_version"},
+		{name: "invalid update url", config: Config{UpdateURL: "ftp://mirror"}, err: "invalid update_url"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.config.validate()
+			if len(test.err) < 1 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestRetainNamespace(t *testing.T) {
+	config := &Config{RetainNamespaces: []string{"staging-*", "debug"}}
+	tests := map[string]bool{
+		"staging-eu": true,
+		"staging-":   true,
+		"debug":      true,
+		"debugging":  false,
+		"prod":       false,
+		"staging":    false,
+	}
+	for namespace, want := range tests {
+		if got := config.retainNamespace(namespace); got != want {
+			t.Errorf("retainNamespace(%q) = %v, want %v", namespace, got, want)
+		}
+	}
+}
+
+func TestCompleteRetain(t *testing.T) {
+	config := &Config{RetainNamespaces: []string{"staging-*"}}
+	tests := []struct {
+		name      string
+		namespace string
+		args      []string
+		want      bool
+	}{
+		{name: "matching namespace", namespace: "staging-eu", want: true},
+		{name: "other namespace", namespace: "prod", want: false},
+		{name: "--no-retain in a matching namespace", namespace: "staging-eu", args: []string{"--no-retain"}, want: false},
+		{name: "--retain in another namespace", namespace: "prod", args: []string{"--retain"}, want: true},
+		{name: "--retain=false in a matching namespace", namespace: "staging-eu", args: []string{"--retain=false"}, want: false},
+	}
+	for _, test := range tests {
+		o := &DebugOptions{Namespace: test.namespace}
+		flags := pflag.NewFlagSet("debug", pflag.ContinueOnError)
+		flags.BoolVar(&o.RetainContainer, "retain", false, "")
+		flags.BoolVar(&o.NoRetain, "no-retain", false, "")
+		if err := flags.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		o.completeRetain(flags, config)
+		if o.RetainContainer != test.want {
+			t.Errorf("%s: got retain %v, want %v", test.name, o.RetainContainer, test.want)
+		}
+	}
+}
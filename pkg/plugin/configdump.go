@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"time"
+)
+
+// effectiveConfig is the fully resolved settings of a debug session
+type effectiveConfig struct {
+	ConfigFile         string        `json:"configFile" yaml:"config_file"`
+	Precedence         string        `json:"precedence" yaml:"precedence"`
+	Namespace          string        `json:"namespace" yaml:"namespace"`
+	Pod                string        `json:"pod" yaml:"pod"`
+	Node               string        `json:"node,omitempty" yaml:"node,omitempty"`
+	Container          string        `json:"container,omitempty" yaml:"container,omitempty"`
+	ContainerID        string        `json:"containerID,omitempty" yaml:"container_id,omitempty"`
+	NoJoin             bool          `json:"noJoin" yaml:"no_join"`
+	Retain             bool          `json:"retain" yaml:"retain"`
+	Image              string        `json:"image" yaml:"image"`
+	Command            []string      `json:"command" yaml:"command"`
+	AgentPort          int           `json:"agentPort" yaml:"agent_port"`
+	AgentURLTemplate   string        `json:"agentURLTemplate,omitempty" yaml:"agent_url_template,omitempty"`
+	Runtime            string        `json:"runtime,omitempty" yaml:"runtime,omitempty"`
+	RuntimeArgs        []string      `json:"runtimeArgs,omitempty" yaml:"runtime_args,omitempty"`
+	Term               string        `json:"term" yaml:"term"`
+	Env                []string      `json:"env,omitempty" yaml:"env,omitempty"`
+	EnvFromConfigMaps  []string      `json:"envFromConfigMaps,omitempty" yaml:"env_from_configmaps,omitempty"`
+	EnvFromSecrets     []string      `json:"envFromSecrets,omitempty" yaml:"env_from_secrets,omitempty"`
+	DNSServers         []string      `json:"dnsServers,omitempty" yaml:"dns_servers,omitempty"`
+	DNSSearches        []string      `json:"dnsSearches,omitempty" yaml:"dns_searches,omitempty"`
+	IdleTimeout        time.Duration `json:"idleTimeout" yaml:"idle_timeout"`
+	SaveLogs           string        `json:"saveLogs,omitempty" yaml:"save_logs,omitempty"`
+	Transcript         string        `json:"transcript,omitempty" yaml:"transcript,omitempty"`
+	MaxOutputBytes     int64         `json:"maxOutputBytes,omitempty" yaml:"max_output_bytes,omitempty"`
+	SkipArchCheck      bool          `json:"skipArchCheck" yaml:"skip_arch_check"`
+	ForceInitialResize bool          `json:"forceInitialResize" yaml:"force_initial_resize"`
+	SSHBastion         string        `json:"sshBastion,omitempty" yaml:"ssh_bastion,omitempty"`
+	PreCommand         []string      `json:"preCommand,omitempty" yaml:"pre_command,omitempty"`
+	PostCommand        []string      `json:"postCommand,omitempty" yaml:"post_command,omitempty"`
+}
+
+// NewConfigDumpCmd returns a cobra command printing the effective settings of a debug session
+func NewConfigDumpCmd(opts *DebugOptions) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "config-dump POD [-c CONTAINER] -- COMMAND [args...]",
+		Short: "Print the effective settings of a debug session without running it",
+		Long: `Print the settings in effect after merging the flags, the environment and the debug config file,
+nothing is created on the cluster.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(c *cobra.Command, args []string) {
+			if err := opts.DumpConfig(c, args, c.ArgsLenAtDash(), output); err != nil {
+				fmt.Fprintln(opts.ErrOut, err)
+			}
+		},
+	}
+	opts.addDebugFlags(cmd.Flags())
+	cmd.Flags().SetInterspersed(false)
+	cmd.Flags().StringVarP(&output, "output", "o", "yaml", "Output format, one of: yaml|json")
+	return cmd
+}
+
+// DumpConfig resolves the debug options like the debug command does and prints them
+func (o *DebugOptions) DumpConfig(cmd *cobra.Command, args []string, argsLenAtDash int, output string) error {
+	if output != "yaml" && output != "json" {
+		return fmt.Errorf("unsupported output format %q, must be one of yaml, json", output)
+	}
+	if err := o.Complete(cmd, args, argsLenAtDash); err != nil {
+		return err
+	}
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	config, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	precedence := config.Precedence
+	if len(precedence) < 1 {
+		precedence = PrecedenceFlagsFirst
+	}
+	effective := effectiveConfig{
+		ConfigFile:         strings.Join(o.configFiles(), ","),
+		Precedence:         precedence,
+		Namespace:          o.Namespace,
+		Pod:                o.PodName,
+		Node:               o.NodeName,
+		Container:          o.ContainerName,
+		ContainerID:        o.ContainerID,
+		NoJoin:             o.NoJoin,
+		Retain:             o.RetainContainer,
+		Image:              o.Image,
+		Command:            o.containerCommand(),
+		AgentPort:          o.AgentPort,
+		AgentURLTemplate:   o.AgentURLTemplate,
+		Runtime:            o.Runtime,
+		RuntimeArgs:        o.RuntimeArgs,
+		Term:               o.Term,
+		Env:                o.Env,
+		EnvFromConfigMaps:  o.EnvFromConfigMaps,
+		EnvFromSecrets:     o.EnvFromSecrets,
+		DNSServers:         o.DNSServers,
+		DNSSearches:        o.DNSSearches,
+		IdleTimeout:        o.IdleTimeout,
+		SaveLogs:           o.SaveLogs,
+		Transcript:         o.Transcript,
+		MaxOutputBytes:     o.MaxOutputBytes,
+		SkipArchCheck:      o.SkipArchCheck,
+		ForceInitialResize: o.ForceResize,
+		PreCommand:         o.PreCommand,
+		PostCommand:        o.PostCommand,
+	}
+	if o.UseSSHBastion {
+		effective.SSHBastion = o.SSHBastion.Host
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(o.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(effective)
+	}
+	bytes, err := yaml.Marshal(effective)
+	if err != nil {
+		return err
+	}
+	_, err = o.Out.Write(bytes)
+	return err
+}
@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"sort"
+	"text/tabwriter"
+)
+
+// NewContextsCmd returns a cobra command listing the contexts of the kubeconfig
+func NewContextsCmd(opts *DebugOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "contexts",
+		Short: "List the kubeconfig contexts and mark the one a debug session would use",
+		Args:  cobra.NoArgs,
+		Run: func(c *cobra.Command, args []string) {
+			if err := opts.ListContexts(); err != nil {
+				fmt.Fprintln(opts.ErrOut, err)
+			}
+		},
+	}
+}
+
+// ListContexts prints the contexts of the kubeconfig with their cluster, server and namespace,
+// the current one, which --context overrides, is marked with *
+func (o *DebugOptions) ListContexts() error {
+	config, err := o.Flags.ToRawKubeConfigLoader().RawConfig()
+	if err != nil {
+		return err
+	}
+	current := config.CurrentContext
+	if o.Flags.Context != nil && len(*o.Flags.Context) > 0 {
+		current = *o.Flags.Context
+	}
+	if _, ok := config.Contexts[current]; len(current) > 0 && !ok {
+		return fmt.Errorf("context %q does not exist in the kubeconfig", current)
+	}
+
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENT\tNAME\tCLUSTER\tSERVER\tNAMESPACE")
+	for _, name := range names {
+		context := config.Contexts[name]
+		mark := ""
+		if name == current {
+			mark = "*"
+		}
+		server := ""
+		if cluster, ok := config.Clusters[context.Cluster]; ok {
+			server = cluster.Server
+		}
+		namespace := context.Namespace
+		if len(namespace) < 1 {
+			namespace = "default"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", mark, name, context.Cluster, server, namespace)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,31 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"sort"
+)
+
+// applyFlagDefaults sets the flags which are not set on the command line to
+// the values of the defaults in the config file
+func applyFlagDefaults(flags *pflag.FlagSet, defaults map[string]string) error {
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+	// apply in a stable order so that errors are reproducible
+	sort.Strings(names)
+	for _, name := range names {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown flag %q in defaults of the config file", name)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := flags.Set(name, defaults[name]); err != nil {
+			return fmt.Errorf("invalid default %q for flag %q in the config file: %v", defaults[name], name, err)
+		}
+	}
+	return nil
+}
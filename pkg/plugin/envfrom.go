@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+)
+
+// envFromSources returns the env of the debug container taken from the keys of
+// the ConfigMaps and Secrets given by --env-from-configmap and --env-from-secret.
+// Secret values are only sent to the agent and never printed.
+func (o *DebugOptions) envFromSources() ([]string, error) {
+	var env []string
+	for _, name := range o.EnvFromConfigMaps {
+		configMap, err := o.KubeCli.CoreV1().ConfigMaps(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, fmt.Errorf("configmap %s referenced by --env-from-configmap not found in namespace %s", name, o.Namespace)
+			}
+			return nil, err
+		}
+		env = append(env, sortedEnv(configMap.Data)...)
+	}
+	for _, name := range o.EnvFromSecrets {
+		secret, err := o.KubeCli.CoreV1().Secrets(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return nil, fmt.Errorf("secret %s referenced by --env-from-secret not found in namespace %s", name, o.Namespace)
+			}
+			return nil, err
+		}
+		data := make(map[string]string, len(secret.Data))
+		for key, value := range secret.Data {
+			data[key] = string(value)
+		}
+		env = append(env, sortedEnv(data)...)
+	}
+	return env, nil
+}
+
+// sortedEnv converts the data to KEY=VALUE pairs in the order of the keys
+func sortedEnv(data map[string]string) []string {
+	env := make([]string, 0, len(data))
+	for key, value := range data {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// the lifecycle events emitted by --json-events
+const (
+	eventResolving         = "resolving"
+	eventPodFound          = "pod-found"
+	eventContainerSelected = "container-selected"
+	eventDialing           = "dialing"
+	eventPulling           = "pulling"
+	eventAttached          = "attached"
+	eventExited            = "exited"
+	eventError             = "error"
+)
+
+// the progress messages of the agent marking the pulling and attached events
+var (
+	agentPullingMessage  = []byte("pulling image ")
+	agentAttachedMessage = []byte("container created, open tty")
+)
+
+// event is a line of --json-events, only the fields relevant to its type are set
+type event struct {
+	Type        string    `json:"type"`
+	Time        time.Time `json:"time"`
+	Namespace   string    `json:"namespace,omitempty"`
+	Pod         string    `json:"pod,omitempty"`
+	Node        string    `json:"node,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	ContainerID string    `json:"containerID,omitempty"`
+	Agent       string    `json:"agent,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	// ExitCode is set on the exited event of a command which failed
+	ExitCode int `json:"exitCode,omitempty"`
+}
+
+// eventEmitter writes the lifecycle events as newline-delimited json,
+// stderr is captured on creation since it is reset for tty sessions
+type eventEmitter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func newEventEmitter(out io.Writer) *eventEmitter {
+	return &eventEmitter{encoder: json.NewEncoder(out)}
+}
+
+// emit writes an event if --json-events is set
+func (o *DebugOptions) emit(e event) {
+	if o.events == nil {
+		return
+	}
+	e.Time = time.Now()
+	o.events.mu.Lock()
+	defer o.events.mu.Unlock()
+	o.events.encoder.Encode(e)
+}
+
+// emitError writes an error event, the error is redacted like the printed one
+func (o *DebugOptions) emitError(err error) {
+	o.emit(event{Type: eventError, Error: o.redact(err.Error())})
+}
+
+// watchProgress returns a writer emitting the pulling and attached events when the
+// progress messages of the agent pass through it, the output is left untouched
+func (o *DebugOptions) watchProgress(out io.Writer) io.Writer {
+	if o.events == nil || out == nil {
+		return out
+	}
+	pulling, attached := false, false
+	return writerFunc(func(p []byte) (int, error) {
+		if !pulling && bytes.Contains(p, agentPullingMessage) {
+			pulling = true
+			o.emit(event{Type: eventPulling, Image: o.Image})
+		}
+		if !attached && bytes.Contains(p, agentAttachedMessage) {
+			attached = true
+			o.emit(event{Type: eventAttached})
+		}
+		return out.Write(p)
+	})
+}
@@ -0,0 +1,26 @@
+package plugin
+
+import (
+	"io"
+)
+
+// flusher is implemented by buffered outputs, e.g. a bufio.Writer the plugin is embedded with
+type flusher interface {
+	Flush() error
+}
+
+// flushWriter flushes a buffered output after every write, so that the output of
+// the session shows up as it arrives from the stream rather than when it ends
+func flushWriter(out io.Writer) io.Writer {
+	f, ok := out.(flusher)
+	if !ok {
+		return out
+	}
+	return writerFunc(func(p []byte) (int, error) {
+		n, err := out.Write(p)
+		if err != nil {
+			return n, err
+		}
+		return n, f.Flush()
+	})
+}
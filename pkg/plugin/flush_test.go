@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// notifyWriter records the output and signals when it contains the expected text
+type notifyWriter struct {
+	lock   sync.Mutex
+	buf    bytes.Buffer
+	expect string
+	seen   chan struct{}
+}
+
+func (w *notifyWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	n, err := w.buf.Write(p)
+	if strings.Contains(w.buf.String(), w.expect) {
+		select {
+		case <-w.seen:
+		default:
+			close(w.seen)
+		}
+	}
+	return n, err
+}
+
+// TestSlowOutputWithoutTTY checks that the output of a command which prints slowly
+// shows up before the command prints more, even through a buffered output
+func TestSlowOutputWithoutTTY(t *testing.T) {
+	recorder := &notifyWriter{expect: "first\n", seen: make(chan struct{})}
+	agent := newFakeAgent(func(in io.Reader, out, errOut io.WriteCloser) error {
+		out.Write([]byte("first\n"))
+		select {
+		case <-recorder.seen:
+			out.Write([]byte("second\n"))
+		case <-time.After(5 * time.Second):
+			out.Write([]byte("the first line did not show up\n"))
+		}
+		return nil
+	})
+	defer agent.Close()
+	var errOut bytes.Buffer
+	o, uri := newStreamOptions(t, agent, strings.NewReader(""), bufio.NewWriter(recorder), &errOut)
+	if err := o.streamSession(uri, false, nil); err != nil {
+		t.Fatalf("error streaming: %v", err)
+	}
+	if got := recorder.buf.String(); got != "first\nsecond\n" {
+		t.Errorf("got output %q, want the first line before the second", got)
+	}
+}
@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// permissionError explains a Forbidden error of the api server. It keeps the
+// status of the original error, so errors.IsForbidden still holds for it
+type permissionError struct {
+	verb      string
+	resource  string
+	name      string
+	namespace string
+	err       error
+}
+
+func (e *permissionError) Error() string {
+	target := e.resource
+	if len(e.name) > 0 {
+		target += " " + e.name
+	}
+	if len(e.namespace) > 0 {
+		target += " in namespace " + e.namespace
+	}
+	return fmt.Sprintf("you don't have permission to %s %s, run `kubectl debug rbac-help` for the permissions needed: %v",
+		e.verb, target, e.err)
+}
+
+// Status implements errors.APIStatus
+func (e *permissionError) Status() v1.Status {
+	return e.err.(errors.APIStatus).Status()
+}
+
+// explainForbidden returns a permissionError for Forbidden errors, other errors are returned as is
+func explainForbidden(err error, verb, resource, name, namespace string) error {
+	if _, ok := err.(errors.APIStatus); !ok || !errors.IsForbidden(err) {
+		return err
+	}
+	return &permissionError{verb: verb, resource: resource, name: name, namespace: namespace, err: err}
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+// forkReadyTimeout bounds the wait for the target container of the forked pod to run
+const forkReadyTimeout = 2 * time.Minute
+
+// forkPod creates a copy of the pod on the same node and returns it once the target
+// container runs, the returned func deletes the copy and must be called when the session ends.
+// The copy has no labels, so that no service or controller picks it up, and no probes,
+// so that it is neither restarted nor left unready while being debugged
+func (o *DebugOptions) forkPod(pod *corev1.Pod, containerName string) (*corev1.Pod, func(), error) {
+	fork := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			GenerateName: pod.Name + "-debug-",
+			Annotations:  map[string]string{"kubectl-debug/forked-from": pod.Name},
+		},
+		Spec: *pod.Spec.DeepCopy(),
+	}
+	fork.Spec.RestartPolicy = corev1.RestartPolicyNever
+	// the copy is stopped if the plugin dies before deleting it
+	deadline := int64(temporaryPodDeadline.Seconds())
+	if fork.Spec.ActiveDeadlineSeconds == nil || *fork.Spec.ActiveDeadlineSeconds > deadline {
+		fork.Spec.ActiveDeadlineSeconds = &deadline
+	}
+	for i := range fork.Spec.Containers {
+		container := &fork.Spec.Containers[i]
+		container.LivenessProbe = nil
+		container.ReadinessProbe = nil
+		if o.ForkHold && container.Name == containerName {
+			// keep the container running whatever its entrypoint does, to debug it by hand
+			container.Command = []string{"sleep", "infinity"}
+			container.Args = nil
+		}
+	}
+
+	created, err := o.PodClient.Pods(o.Namespace).Create(fork)
+	if err != nil {
+		return nil, nil, explainForbidden(err, "create", "pods", "", o.Namespace)
+	}
+	fmt.Fprintf(o.messageOut(), "Forked pod %s to %s\n", pod.Name, created.Name)
+	cleanup := o.onInterrupt(func() {
+		zero := int64(0)
+		err := o.PodClient.Pods(o.Namespace).Delete(created.Name, &v1.DeleteOptions{GracePeriodSeconds: &zero})
+		if err != nil {
+			fmt.Fprintf(o.messageOut(), "warning: error deleting forked pod %s: %v\n", created.Name, err)
+		}
+	})
+
+	err = wait.PollImmediate(readyPollInterval, forkReadyTimeout, func() (bool, error) {
+		current, err := o.PodClient.Pods(o.Namespace).Get(created.Name, v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, status := range current.Status.ContainerStatuses {
+			if status.Name != containerName {
+				continue
+			}
+			if status.State.Terminated != nil {
+				return false, fmt.Errorf("container %s of the forked pod %s exited with code %d, use --fork-hold to keep it running",
+					containerName, created.Name, status.State.Terminated.ExitCode)
+			}
+			if status.State.Running != nil {
+				created = current
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		err = fmt.Errorf("container %s of the forked pod %s is still not running after waiting %s", containerName, created.Name, forkReadyTimeout)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return created, cleanup, nil
+}
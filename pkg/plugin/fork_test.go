@@ -0,0 +1,46 @@
+package plugin
+
+import (
+	"bytes"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestForkPodDeletedOnInterrupt forks a pod, then runs the cleanups of an interrupt
+func TestForkPodDeletedOnInterrupt(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Name = pod.GenerateName + "x1"
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+			{Name: "app", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+		}
+		return false, nil, nil
+	})
+	out := &bytes.Buffer{}
+	o := &DebugOptions{Namespace: "default", PodClient: clientset.CoreV1()}
+	o.Out = out
+	original := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+	}
+
+	forked, _, err := o.forkPod(original, "app")
+	if err != nil {
+		t.Fatalf("error forking the pod: %v", err)
+	}
+	deadline := forked.Spec.ActiveDeadlineSeconds
+	if deadline == nil || *deadline != int64(temporaryPodDeadline.Seconds()) {
+		t.Errorf("got activeDeadlineSeconds %v, want %v", deadline, temporaryPodDeadline.Seconds())
+	}
+
+	o.runInterruptCleanups()
+	if _, err := clientset.CoreV1().Pods("default").Get(forked.Name, v1.GetOptions{}); err == nil {
+		t.Errorf("forked pod %s is still there after the interrupt", forked.Name)
+	}
+}
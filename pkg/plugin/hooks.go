@@ -0,0 +1,39 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// hookEnv returns the environment passed to the pre and post commands,
+// describing the debug session
+func (o *DebugOptions) hookEnv(pod *corev1.Pod, containerName string) []string {
+	return append(os.Environ(),
+		"KUBECTL_DEBUG_NAMESPACE="+o.Namespace,
+		"KUBECTL_DEBUG_POD="+pod.Name,
+		"KUBECTL_DEBUG_CONTAINER="+containerName,
+		"KUBECTL_DEBUG_NODE="+pod.Spec.NodeName,
+		"KUBECTL_DEBUG_HOST_IP="+pod.Status.HostIP,
+		"KUBECTL_DEBUG_AGENT_PORT="+strconv.Itoa(o.AgentPort),
+		"KUBECTL_DEBUG_IMAGE="+o.Image,
+	)
+}
+
+// runHook runs a local command configured in the debug config file, its output
+// goes to the message output of the plugin
+func (o *DebugOptions) runHook(name string, command []string, env []string) error {
+	if len(command) < 1 {
+		return nil
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Stdout = o.messageOut()
+	cmd.Stderr = o.messageOut()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %v failed: %v", name, command, err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// idleWatcher closes the session once there has been no stdin/stdout activity
+// for the given timeout. The session is closed by canceling the stream, which
+// closes the connection to the agent, so that commands which do not read their
+// stdin, e.g. a shell with a tty, are closed as well.
+type idleWatcher struct {
+	timeout time.Duration
+	// lastActivity is the unix nano timestamp of the last read or write
+	lastActivity int64
+	expired      int32
+
+	cancel   func()
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func newIdleWatcher(timeout time.Duration, cancel func()) *idleWatcher {
+	return &idleWatcher{
+		timeout:      timeout,
+		lastActivity: time.Now().UnixNano(),
+		cancel:       cancel,
+		stop:         make(chan struct{}),
+	}
+}
+
+func (w *idleWatcher) touch() {
+	atomic.StoreInt64(&w.lastActivity, time.Now().UnixNano())
+}
+
+// Expired returns true if the session was closed due to inactivity
+func (w *idleWatcher) Expired() bool {
+	return atomic.LoadInt32(&w.expired) == 1
+}
+
+// Done returns a channel which is closed once the watcher is stopped
+func (w *idleWatcher) Done() <-chan struct{} {
+	return w.stop
+}
+
+// WrapReader returns a reader which records activity
+func (w *idleWatcher) WrapReader(in io.Reader) io.Reader {
+	if in == nil {
+		return nil
+	}
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := in.Read(p)
+		if n > 0 {
+			w.touch()
+		}
+		return n, err
+	})
+}
+
+// WrapWriter returns a writer which records activity
+func (w *idleWatcher) WrapWriter(out io.Writer) io.Writer {
+	if out == nil {
+		return nil
+	}
+	return writerFunc(func(p []byte) (int, error) {
+		w.touch()
+		return out.Write(p)
+	})
+}
+
+// Start spawns a goroutine checking for inactivity until Stop is called, the stream
+// is canceled on expiry
+func (w *idleWatcher) Start() {
+	go func() {
+		ticker := time.NewTicker(w.checkInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				last := time.Unix(0, atomic.LoadInt64(&w.lastActivity))
+				if time.Since(last) < w.timeout {
+					continue
+				}
+				atomic.StoreInt32(&w.expired, 1)
+				w.cancel()
+				return
+			}
+		}
+	}()
+}
+
+func (w *idleWatcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+func (w *idleWatcher) checkInterval() time.Duration {
+	interval := w.timeout / 10
+	if interval < 100*time.Millisecond {
+		interval = 100 * time.Millisecond
+	}
+	if interval > time.Second {
+		interval = time.Second
+	}
+	return interval
+}
+
+// writerFunc adapts a function to io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// readerFunc adapts a function to io.Reader
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// inputPump reads the input of the plugin in a goroutine which outlives the session.
+// A read blocked on a terminal cannot be canceled, so a session which is over stops
+// taking from the pump instead, and what it did not take is left to the next session
+// of --watch rather than being swallowed by a stale read
+type inputPump struct {
+	in     io.Reader
+	chunks chan []byte
+	// err is set before chunks is closed
+	err error
+
+	mu      sync.Mutex
+	pending []byte
+}
+
+func newInputPump(in io.Reader) *inputPump {
+	p := &inputPump{in: in, chunks: make(chan []byte)}
+	go func() {
+		defer close(p.chunks)
+		for {
+			buf := make([]byte, 32*1024)
+			n, err := in.Read(buf)
+			if n > 0 {
+				p.chunks <- buf[:n]
+			}
+			if err != nil {
+				p.err = err
+				return
+			}
+		}
+	}()
+	return p
+}
+
+// Reader returns a reader of the pump which returns EOF once done is closed
+func (p *inputPump) Reader(done <-chan struct{}) io.Reader {
+	return readerFunc(func(buf []byte) (int, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.pending) < 1 {
+			select {
+			case <-done:
+				return 0, io.EOF
+			case chunk, ok := <-p.chunks:
+				if !ok {
+					return 0, p.err
+				}
+				p.pending = chunk
+			}
+		}
+		n := copy(buf, p.pending)
+		p.pending = p.pending[n:]
+		return n, nil
+	})
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdleTimeoutClosesSessionIgnoringStdin(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	agent := newFakeAgent(func(in io.Reader, out, errOut io.WriteCloser) error {
+		// like a shell with a tty, the command neither reads stdin nor exits
+		<-done
+		return nil
+	})
+	defer agent.Close()
+
+	stdin, stdinWriter := io.Pipe()
+	defer stdinWriter.Close()
+	var out bytes.Buffer
+	o, uri := newStreamOptions(t, agent, stdin, &out, ioutil.Discard)
+	o.IdleTimeout = 200 * time.Millisecond
+
+	result := make(chan error, 1)
+	go func() {
+		result <- o.streamSession(uri, false, nil)
+	}()
+	select {
+	case <-result:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("session still open after the idle timeout")
+	}
+	if !strings.Contains(out.String(), "session closed due to inactivity") {
+		t.Errorf("expected the inactivity message, got %q", out.String())
+	}
+}
+
+func TestInputPumpLeavesInputToNextReader(t *testing.T) {
+	in, inWriter := io.Pipe()
+	pump := newInputPump(in)
+
+	first := make(chan struct{})
+	close(first)
+	if n, err := pump.Reader(first).Read(make([]byte, 8)); n != 0 || err != io.EOF {
+		t.Fatalf("expected EOF from a stopped reader, got %d, %v", n, err)
+	}
+
+	go inWriter.Write([]byte("hello"))
+	buf := make([]byte, 8)
+	n, err := pump.Reader(make(chan struct{})).Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("expected the input in the next reader, got %q, %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,15 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/docker/distribution/reference"
+)
+
+// validateImage checks the image reference, including the format of the digest of
+// a digest reference such as repo@sha256:..., which pins the exact image the agent pulls
+func validateImage(image string) error {
+	if _, err := reference.ParseNormalizedNamed(image); err != nil {
+		return fmt.Errorf("invalid image %q: %v", image, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+)
+
+const testDigest = "sha256:4a8a8d4a9b5c0e3c5d7d4f1b1e1f1a9d2c3b4a5f6e7d8c9b0a1f2e3d4c5b6a7f"
+
+func TestValidateImage(t *testing.T) {
+	tests := []struct {
+		image  string
+		tag    string
+		digest string
+		err    string
+	}{
+		{image: "nicolaka/netshoot"},
+		{image: "nicolaka/netshoot:latest", tag: "latest"},
+		{image: "registry.example.com:5000/tools/netshoot:v0.9", tag: "v0.9"},
+		{image: "nicolaka/netshoot@" + testDigest, digest: testDigest},
+		{image: "nicolaka/netshoot:latest@" + testDigest, tag: "latest", digest: testDigest},
+		{image: "nicolaka/netshoot@sha256:" + strings.Repeat("a", 40), err: "invalid checksum digest length"},
+		{image: "nicolaka/netshoot@sha256:1234", err: "invalid reference format"},
+		{image: "nicolaka/netshoot@md5:" + strings.Repeat("a", 32), err: "unsupported digest algorithm"},
+		{image: "Nicolaka/Netshoot", err: "must be lowercase"},
+		{image: "nicolaka/netshoot:", err: "invalid reference format"},
+	}
+	for _, test := range tests {
+		err := validateImage(test.image)
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.image, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.image, err)
+			continue
+		}
+		named, _ := reference.ParseNormalizedNamed(test.image)
+		tag, digest := "", ""
+		if tagged, ok := named.(reference.Tagged); ok {
+			tag = tagged.Tag()
+		}
+		if canonical, ok := named.(reference.Canonical); ok {
+			digest = canonical.Digest().String()
+		}
+		if tag != test.tag || digest != test.digest {
+			t.Errorf("%s: got tag %q and digest %q, want %q and %q", test.image, tag, digest, test.tag, test.digest)
+		}
+	}
+}
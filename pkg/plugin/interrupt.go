@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"sync"
+)
+
+// onInterrupt registers a cleanup which also runs if the plugin is interrupted,
+// as deferred calls do not run on a termination signal, e.g. deleting the temporary
+// pods of the session. The returned func runs the cleanup at most once and is to be
+// deferred as well
+func (o *DebugOptions) onInterrupt(cleanup func()) func() {
+	var once sync.Once
+	guarded := func() { once.Do(cleanup) }
+	o.interruptMu.Lock()
+	defer o.interruptMu.Unlock()
+	o.interruptCleanups = append(o.interruptCleanups, guarded)
+	return guarded
+}
+
+// runInterruptCleanups runs the cleanups registered with onInterrupt which did not
+// run yet, the latest first like deferred calls
+func (o *DebugOptions) runInterruptCleanups() {
+	o.interruptMu.Lock()
+	cleanups := o.interruptCleanups
+	o.interruptCleanups = nil
+	o.interruptMu.Unlock()
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
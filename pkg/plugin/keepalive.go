@@ -0,0 +1,174 @@
+package plugin
+
+import (
+	"context"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultKeepaliveInterval = 30 * time.Second
+
+// newSPDYExecutor is remotecommand.NewSPDYExecutor with tcp keepalives sent at
+// the given interval, zero leaves the keepalive of the os, the extra header set
+// on the upgrade request along with the form body, and the stream canceled once ctx is done
+func newSPDYExecutor(ctx context.Context, config *restclient.Config, method string, url *url.URL, keepalive time.Duration, header http.Header, body url.Values) (remotecommand.Executor, error) {
+	tlsConfig, err := restclient.TLSConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	upgradeRoundTripper := spdy.NewSpdyRoundTripper(tlsConfig, true, false)
+	if keepalive > 0 {
+		upgradeRoundTripper.Dialer = keepaliveDialer(0, keepalive)
+	}
+	var wrapper http.RoundTripper
+	wrapper, err = restclient.HTTPWrappersForConfig(config, upgradeRoundTripper)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) > 0 {
+		wrapper = &headerRoundTripper{header: header, rt: wrapper}
+	}
+	if len(body) > 0 {
+		wrapper = &formBodyRoundTripper{body: body.Encode(), rt: wrapper}
+	}
+	upgrader := &cancelableUpgrader{SpdyRoundTripper: upgradeRoundTripper, ctx: ctx}
+	return remotecommand.NewSPDYExecutorForTransports(wrapper, upgrader, method, url)
+}
+
+// keepaliveRoundTripperFor is spdy.RoundTripperFor of client-go with tcp keepalives sent
+// at the given interval, for the port-forward to the agent through the api server
+func keepaliveRoundTripperFor(config *restclient.Config, keepalive time.Duration) (http.RoundTripper, *spdy.SpdyRoundTripper, error) {
+	tlsConfig, err := restclient.TLSConfigFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	upgradeRoundTripper := spdy.NewSpdyRoundTripper(tlsConfig, true, false)
+	if keepalive > 0 {
+		upgradeRoundTripper.Dialer = keepaliveDialer(0, keepalive)
+	}
+	wrapper, err := restclient.HTTPWrappersForConfig(config, upgradeRoundTripper)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrapper, upgradeRoundTripper, nil
+}
+
+// keepaliveDialer dials the connections carrying a session, which go through the load
+// balancers and nats dropping idle connections: to the agent, to the api server for
+// --port-forward, to its proxy and to the ssh bastion. Zero leaves the keepalive of go
+func keepaliveDialer(timeout, keepalive time.Duration) *net.Dialer {
+	dialer := &net.Dialer{Timeout: timeout}
+	if keepalive > 0 {
+		dialer.KeepAlive = keepalive
+	}
+	return dialer
+}
+
+// cancelableUpgrader closes the upgraded connection once the context is done, which
+// ends the stream, as a stream of remotecommand cannot be canceled otherwise
+type cancelableUpgrader struct {
+	*spdy.SpdyRoundTripper
+	ctx context.Context
+}
+
+func (u *cancelableUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.SpdyRoundTripper.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-u.ctx.Done():
+			conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+	return conn, nil
+}
+
+// headerRoundTripper sets the header on every request
+type headerRoundTripper struct {
+	header http.Header
+	rt     http.RoundTripper
+}
+
+func (h *headerRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = utilnet.CloneRequest(req)
+	for key, values := range h.header {
+		req.Header[key] = values
+	}
+	return h.rt.RoundTrip(req)
+}
+
+// formBodyRoundTripper sends the url encoded form as the body of every request
+type formBodyRoundTripper struct {
+	body string
+	rt   http.RoundTripper
+}
+
+func (f *formBodyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = utilnet.CloneRequest(req)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Body = ioutil.NopCloser(strings.NewReader(f.body))
+	req.ContentLength = int64(len(f.body))
+	return f.rt.RoundTrip(req)
+}
+
+// keepaliveSizeQueue sends the last terminal size again when the terminal was
+// not resized for the keepalive interval. The agent resizes the tty to the size
+// it already has, which changes nothing, but the frame on the stream keeps load
+// balancers and firewalls with idle timeouts from dropping a quiet session
+type keepaliveSizeQueue struct {
+	sizes    chan *remotecommand.TerminalSize
+	interval time.Duration
+	last     *remotecommand.TerminalSize
+}
+
+func newKeepaliveSizeQueue(queue remotecommand.TerminalSizeQueue, interval time.Duration) *keepaliveSizeQueue {
+	q := &keepaliveSizeQueue{
+		sizes:    make(chan *remotecommand.TerminalSize),
+		interval: interval,
+	}
+	go func() {
+		defer close(q.sizes)
+		for {
+			size := queue.Next()
+			if size == nil {
+				return
+			}
+			q.sizes <- size
+		}
+	}()
+	return q
+}
+
+// Next returns the next resize of the terminal, or the last size once the interval elapsed
+func (q *keepaliveSizeQueue) Next() *remotecommand.TerminalSize {
+	timer := time.NewTimer(q.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case size, ok := <-q.sizes:
+			if !ok {
+				return nil
+			}
+			q.last = size
+			return size
+		case <-timer.C:
+			if q.last != nil {
+				size := *q.last
+				return &size
+			}
+			timer.Reset(q.interval)
+		}
+	}
+}
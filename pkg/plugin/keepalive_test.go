@@ -0,0 +1,28 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+// TestKeepaliveRoundTripperFor checks that the port-forward to the agent dials the api
+// server with the keepalive interval
+func TestKeepaliveRoundTripperFor(t *testing.T) {
+	for _, keepalive := range []time.Duration{0, 15 * time.Second} {
+		_, upgrader, err := keepaliveRoundTripperFor(&restclient.Config{Host: "https://127.0.0.1:6443"}, keepalive)
+		if err != nil {
+			t.Fatalf("keepalive %s: %v", keepalive, err)
+		}
+		if keepalive < 1 {
+			if upgrader.Dialer != nil {
+				t.Errorf("keepalive %s: got dialer %+v, want the default", keepalive, upgrader.Dialer)
+			}
+			continue
+		}
+		if upgrader.Dialer == nil || upgrader.Dialer.KeepAlive != keepalive {
+			t.Errorf("keepalive %s: got dialer %+v", keepalive, upgrader.Dialer)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"io"
+	"sync"
+)
+
+// limitWriter passes at most limit bytes to the underlying writer and silently
+// discards the rest, so that the remote command is not interrupted
+type limitWriter struct {
+	out       io.Writer
+	limit     int64
+	written   int64
+	truncated bool
+	lock      sync.Mutex
+}
+
+func newLimitWriter(out io.Writer, limit int64) *limitWriter {
+	return &limitWriter{out: out, limit: limit}
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	remaining := w.limit - w.written
+	if int64(len(p)) > remaining {
+		w.truncated = true
+		if remaining > 0 {
+			n, err := w.out.Write(p[:remaining])
+			w.written += int64(n)
+			if err != nil {
+				return n, err
+			}
+		}
+		return len(p), nil
+	}
+	n, err := w.out.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// Truncated returns true if any output was discarded
+func (w *limitWriter) Truncated() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.truncated
+}
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"k8s.io/client-go/tools/remotecommand"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// runLocal runs the session with --local-exec, nothing on the cluster is touched
+// and the command runs as a local process, which exercises the tty, transcript,
+// output limits and idle timeout like a real session does
+func (o *DebugOptions) runLocal() error {
+	fmt.Fprintf(o.messageOut(), "warning: --local-exec is for development only, running %q as a local process\n",
+		strings.Join(o.containerCommand(), " "))
+	if err := o.openSessionFiles(); err != nil {
+		return err
+	}
+	defer o.closeSessionFiles()
+
+	t := o.setupTTY()
+	sizeQueue := o.monitorSize(&t)
+	return t.Safe(func() error {
+		return o.streamSession(nil, t.Raw, sizeQueue)
+	})
+}
+
+// localExecute runs the command as a local process in place of remoteExecute.
+// There is no pseudo terminal, so for tty sessions the output gets carriage
+// returns added for the raw local terminal and the terminal size is only
+// passed as COLUMNS and LINES when the process starts
+func (o *DebugOptions) localExecute(stdin io.Reader, stdout, stderr io.Writer, tty bool,
+	terminalSizeQueue remotecommand.TerminalSizeQueue) error {
+	command := o.containerCommand()
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), o.containerEnv(tty)...)
+	if tty {
+		stdout = &crlfWriter{w: stdout}
+		// stdout and stderr share the terminal like in a tty session
+		stderr = stdout
+		if terminalSizeQueue != nil {
+			if size := terminalSizeQueue.Next(); size != nil {
+				cmd.Env = append(cmd.Env, fmt.Sprintf("COLUMNS=%d", size.Width), fmt.Sprintf("LINES=%d", size.Height))
+			}
+			// drain the later resizes, which the process cannot be told about
+			go func() {
+				for terminalSizeQueue.Next() != nil {
+				}
+			}()
+		}
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// stdin is copied apart from cmd, as cmd.Wait would otherwise block on
+	// reading stdin until the next keystroke after the process exited
+	processIn, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if stdin != nil {
+		go func() {
+			io.Copy(processIn, stdin)
+			processIn.Close()
+		}()
+	}
+	return cmd.Wait()
+}
+
+// crlfWriter turns \n into \r\n for a terminal in raw mode
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.Replace(p, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
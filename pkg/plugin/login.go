@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// loginShells accept -l to run as a login shell, which sources /etc/profile and ~/.profile
+var loginShells = []string{"ash", "bash", "dash", "ksh", "sh", "zsh"}
+
+// loginCommand turns a bare shell, e.g. the default bash or an explicit /bin/sh,
+// into a login shell for --login. Other commands are refused, as the login shell
+// setup does not apply to them
+func loginCommand(command []string) ([]string, error) {
+	shell := path.Base(command[0])
+	for _, loginShell := range loginShells {
+		if shell != loginShell {
+			continue
+		}
+		if len(command) > 1 {
+			if command[1] == "-l" || command[1] == "--login" {
+				return command, nil
+			}
+			return nil, fmt.Errorf("--login only applies to an interactive shell without arguments, "+
+				"run %s -l -c ... to source the profile for a command", shell)
+		}
+		return []string{command[0], "-l"}, nil
+	}
+	return nil, fmt.Errorf("--login requires the command to be one of the shells %s, got %s",
+		strings.Join(loginShells, ", "), command[0])
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	saveLogsTimeout  = time.Minute
+	saveLogsInterval = 500 * time.Millisecond
+)
+
+// saveLogs fetches the logs of the finished debug session from the agent and
+// writes them to path. The agent saves the logs while cleaning up the debug
+// container, so the request is retried until the logs are available. agentURL
+// is the one the session was dialed with, e.g. through the port-forward.
+func (o *DebugOptions) saveLogs(agentURL *url.URL, session, path string) error {
+	client, err := o.agentHTTPClient(0)
+	if err != nil {
+		return err
+	}
+	// only the response header is bounded, the logs may take long to download
+	client.Transport.(*http.Transport).ResponseHeaderTimeout = agentRequestTimeout
+	uri := agentAPI(agentURL, "/api/v1/logs", url.Values{"session": []string{session}})
+	deadline := time.Now().Add(saveLogsTimeout)
+	for {
+		resp, err := client.Get(uri.String())
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == http.StatusNotFound && time.Now().Before(deadline) {
+			resp.Body.Close()
+			time.Sleep(saveLogsInterval)
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("agent responded with status %s", resp.Status)
+		}
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		// stream to the file, the logs may be large
+		_, err = io.Copy(file, resp.Body)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	restclient "k8s.io/client-go/rest"
+)
+
+func TestSaveLogsRetriesUntilSaved(t *testing.T) {
+	requests := 0
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.URL.Path != "/api/v1/logs" || req.FormValue("session") != "abc" {
+			http.Error(w, "unexpected request", 400)
+			return
+		}
+		if requests < 3 {
+			http.Error(w, "logs not found", 404)
+			return
+		}
+		w.Write([]byte("the logs\n"))
+	}))
+	defer agent.Close()
+	agentURL, err := url.Parse(agent.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "kubectl-debug-logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "debug.log")
+	o := &DebugOptions{Config: &restclient.Config{Host: agent.URL}}
+	if err := o.saveLogs(agentURL, "abc", path); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(logs) != "the logs\n" || requests != 3 {
+		t.Errorf("got logs %q after %d requests, want the logs after 3", logs, requests)
+	}
+}
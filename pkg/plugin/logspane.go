@@ -0,0 +1,33 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// logsPaneTailLines is the number of past log lines shown when the logs pane opens
+const logsPaneTailLines = 10
+
+// tailLogs follows the logs of the target container and writes them to out, while the
+// shell of the debug container goes to stdout, the returned func stops following
+func (o *DebugOptions) tailLogs(podName, containerName string, out io.Writer) (func(), error) {
+	tailLines := int64(logsPaneTailLines)
+	stream, err := o.PodClient.Pods(o.Namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: containerName,
+		Follow:    true,
+		TailLines: &tailLines,
+	}).Stream()
+	if err != nil {
+		return nil, fmt.Errorf("cannot follow the logs of container %s: %v", containerName, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(out, stream)
+	}()
+	return func() {
+		stream.Close()
+		<-done
+	}, nil
+}
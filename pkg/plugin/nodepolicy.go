@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// checkNodePolicy refuses to debug on a node excluded by forbidden_node_labels or
+// allowed_node_labels of the config file, the node is only fetched if either is set.
+// This is a guardrail of the client, the agent does not enforce it.
+func (o *DebugOptions) checkNodePolicy(nodeName string) error {
+	if len(o.ForbiddenNodeLabels) < 1 && len(o.AllowedNodeLabels) < 1 {
+		return nil
+	}
+	node, err := o.NodeClient.Nodes().Get(nodeName, v1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("cannot check the node policy of node %s: %v", nodeName, err)
+	}
+	for _, selector := range o.ForbiddenNodeLabels {
+		matched, err := matchesLabels(selector, node.Labels)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return fmt.Errorf("debugging on node %s is forbidden by the debug config, the node matches forbidden_node_labels %q", nodeName, selector)
+		}
+	}
+	if len(o.AllowedNodeLabels) < 1 {
+		return nil
+	}
+	for _, selector := range o.AllowedNodeLabels {
+		matched, err := matchesLabels(selector, node.Labels)
+		if err != nil || matched {
+			return err
+		}
+	}
+	return fmt.Errorf("debugging on node %s is not allowed by the debug config, the node matches none of allowed_node_labels %v", nodeName, o.AllowedNodeLabels)
+}
+
+func matchesLabels(selector string, nodeLabels map[string]string) (bool, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid node label selector %q: %v", selector, err)
+	}
+	return parsed.Matches(labels.Set(nodeLabels)), nil
+}
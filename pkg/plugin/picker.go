@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// promptChoice lists the items on stderr and prompts for one of them, either by its number
+// or by a fuzzy filter, which narrows the list down until a single item matches. An empty
+// answer picks the default item. It returns the index of the picked item
+func (o *DebugOptions) promptChoice(what string, items []string, defaultIndex int) (int, error) {
+	reader := bufio.NewReader(o.In)
+	shown := make([]int, len(items))
+	for i := range items {
+		shown[i] = i
+	}
+	for {
+		for n, i := range shown {
+			fmt.Fprintf(o.ErrOut, "%3d) %s\n", n+1, items[i])
+		}
+		fmt.Fprintf(o.ErrOut, "pick a %s by number or type to filter [%d]: ", what, indexOf(shown, defaultIndex)+1)
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || len(line) < 1) {
+			return 0, fmt.Errorf("no %s picked: %v", what, err)
+		}
+		line = strings.TrimSpace(line)
+		if len(line) < 1 {
+			if indexOf(shown, defaultIndex) < 0 {
+				return shown[0], nil
+			}
+			return defaultIndex, nil
+		}
+		if n, err := strconv.Atoi(line); err == nil {
+			if n < 1 || n > len(shown) {
+				return 0, fmt.Errorf("invalid choice %q, must be a number between 1 and %d", line, len(shown))
+			}
+			return shown[n-1], nil
+		}
+		var matches []int
+		for _, i := range shown {
+			if fuzzyMatch(line, items[i]) {
+				matches = append(matches, i)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			fmt.Fprintf(o.ErrOut, "no %s matches %q\n", what, line)
+		case 1:
+			return matches[0], nil
+		default:
+			shown = matches
+		}
+	}
+}
+
+// fuzzyMatch tells whether the characters of the filter appear in order in s, ignoring case
+func fuzzyMatch(filter, s string) bool {
+	s = strings.ToLower(s)
+	for _, c := range strings.ToLower(filter) {
+		i := strings.IndexRune(s, c)
+		if i < 0 {
+			return false
+		}
+		s = s[i+1:]
+	}
+	return true
+}
+
+func indexOf(list []int, value int) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// pickPodInteractively prompts for a running pod of the namespace, then for its container
+// if it has several and --container is not set, when no pod is given in a terminal
+func (o *DebugOptions) pickPodInteractively() (string, error) {
+	list, err := o.PodClient.Pods(o.Namespace).List(v1.ListOptions{})
+	if err != nil {
+		return "", explainForbidden(err, "list", "pods", "", o.Namespace)
+	}
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			pods = append(pods, pod)
+		}
+	}
+	if len(pods) < 1 {
+		return "", fmt.Errorf("error pod not specified, and there is no running pod in namespace %s", o.Namespace)
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+
+	items := make([]string, len(pods))
+	for i, pod := range pods {
+		ready := 0
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Ready {
+				ready++
+			}
+		}
+		items[i] = fmt.Sprintf("%s\t%d/%d\t%s\t%s", pod.Name, ready, len(pod.Spec.Containers), pod.Spec.NodeName,
+			duration.HumanDuration(time.Since(pod.CreationTimestamp.Time)))
+	}
+	fmt.Fprintf(o.ErrOut, "running pods in namespace %s:\n", o.Namespace)
+	i, err := o.promptChoice("pod", items, 0)
+	if err != nil {
+		return "", err
+	}
+	pod := &pods[i]
+
+	if len(o.ContainerName) < 1 && len(pod.Spec.Containers) > 1 {
+		names := make([]string, len(pod.Spec.Containers))
+		defaultIndex := 0
+		defaultName := o.defaultContainerName(pod)
+		for j, container := range pod.Spec.Containers {
+			names[j] = container.Name + "\t" + container.Image
+			if container.Name == defaultName {
+				defaultIndex = j
+			}
+		}
+		fmt.Fprintf(o.ErrOut, "containers of pod %s:\n", pod.Name)
+		j, err := o.promptChoice("container", names, defaultIndex)
+		if err != nil {
+			return "", err
+		}
+		o.ContainerName = pod.Spec.Containers[j].Name
+	}
+	return pod.Name, nil
+}
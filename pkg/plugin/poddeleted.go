@@ -0,0 +1,27 @@
+package plugin
+
+import (
+	"fmt"
+)
+
+// podDeletedExitCode is the exit code when the target pod is deleted during the session
+const podDeletedExitCode = 3
+
+// podDeletedError is returned when the session ended because its target pod was deleted
+type podDeletedError struct {
+	pod string
+}
+
+func (e *podDeletedError) Error() string {
+	return fmt.Sprintf("target pod %s was deleted during the session", e.pod)
+}
+
+// targetPodDeleted tells whether a broken session is caused by the deletion of
+// its target pod rather than by the stream itself
+func (o *DebugOptions) targetPodDeleted() bool {
+	if o.targetPod == nil {
+		return false
+	}
+	gone, err := o.podGone(o.targetPod)
+	return err == nil && gone
+}
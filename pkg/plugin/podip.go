@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+	"net"
+	"strings"
+)
+
+// podByIP finds the running pod with the ip of --pod-ip in the namespace, or in
+// all namespaces with --all-namespaces, and sets the namespace to the one of the pod
+func (o *DebugOptions) podByIP() (string, error) {
+	ip := net.ParseIP(o.PodIP)
+	if ip == nil {
+		return "", fmt.Errorf("invalid --pod-ip %q, must be an ip address", o.PodIP)
+	}
+	namespace := o.Namespace
+	if o.AllNamespaces {
+		namespace = ""
+	}
+	// the pod ips are stored in their canonical form, e.g. fd00::1 for fd00:0:0:0:0:0:0:1
+	pods, err := o.PodClient.Pods(namespace).List(v1.ListOptions{FieldSelector: "status.podIP=" + ip.String()})
+	if errors.IsBadRequest(err) {
+		// older api servers cannot select pods by status.podIP, they are filtered below instead
+		klog.V(2).Infof("cannot select pods by status.podIP, listing every pod: %v", err)
+		pods, err = o.PodClient.Pods(namespace).List(v1.ListOptions{})
+	}
+	if err != nil {
+		return "", explainForbidden(err, "list", "pods", "", namespace)
+	}
+	var matches []corev1.Pod
+	for _, pod := range pods.Items {
+		// the ips of completed pods are reused
+		if !ip.Equal(net.ParseIP(pod.Status.PodIP)) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		matches = append(matches, pod)
+	}
+	where := "namespace " + o.Namespace
+	if o.AllNamespaces {
+		where = "any namespace"
+	}
+	switch len(matches) {
+	case 0:
+		if o.AllNamespaces {
+			return "", fmt.Errorf("no running pod has the ip %s in %s", o.PodIP, where)
+		}
+		return "", fmt.Errorf("no running pod has the ip %s in %s, use --all-namespaces to search every namespace", o.PodIP, where)
+	case 1:
+		o.Namespace = matches[0].Namespace
+		return matches[0].Name, nil
+	default:
+		var names []string
+		for _, pod := range matches {
+			names = append(names, pod.Namespace+"/"+pod.Name)
+		}
+		return "", fmt.Errorf("%d pods have the ip %s in %s, e.g. pods on the host network share the ip of the node, pass one of them instead: %s",
+			len(matches), o.PodIP, where, strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func podWithIP(namespace, name, ip string, phase corev1.PodPhase) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: name, Namespace: namespace},
+		Status:     corev1.PodStatus{PodIP: ip, Phase: phase},
+	}
+}
+
+// TestPodByIPSelectsByField checks that the pods are selected by status.podIP on the
+// server, and filtered on the client only if the server rejects the field selector
+func TestPodByIPSelectsByField(t *testing.T) {
+	for _, rejectSelector := range []bool{false, true} {
+		clientset := fake.NewSimpleClientset(
+			podWithIP("default", "web", "10.0.0.1", corev1.PodRunning),
+			podWithIP("default", "job", "10.0.0.1", corev1.PodSucceeded),
+			podWithIP("default", "db", "10.0.0.2", corev1.PodRunning),
+		)
+		var selectors []string
+		clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			selector := action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+			selectors = append(selectors, selector)
+			if rejectSelector && len(selector) > 0 {
+				return true, nil, errors.NewBadRequest(`field label not supported: status.podIP`)
+			}
+			return false, nil, nil
+		})
+		o := &DebugOptions{Namespace: "default", PodIP: "10.0.0.1", PodClient: clientset.CoreV1()}
+
+		name, err := o.podByIP()
+		if err != nil {
+			t.Fatalf("rejectSelector=%v: error finding the pod by ip: %v", rejectSelector, err)
+		}
+		if name != "web" {
+			t.Errorf("rejectSelector=%v: got pod %s, want web", rejectSelector, name)
+		}
+		want := []string{"status.podIP=10.0.0.1"}
+		if rejectSelector {
+			want = append(want, "")
+		}
+		if len(selectors) != len(want) {
+			t.Fatalf("rejectSelector=%v: got list selectors %q, want %q", rejectSelector, selectors, want)
+		}
+		for i := range want {
+			if selectors[i] != want[i] {
+				t.Errorf("rejectSelector=%v: got list selectors %q, want %q", rejectSelector, selectors, want)
+			}
+		}
+	}
+}
+
+// TestPodByIPMatchesIPv6Forms selects a pod by an ipv6 address written in another form
+// than the one of its status
+func TestPodByIPMatchesIPv6Forms(t *testing.T) {
+	for _, podIP := range []string{"fd00::1", "fd00:0:0:0:0:0:0:1", "FD00::0:1"} {
+		for _, rejectSelector := range []bool{false, true} {
+			clientset := fake.NewSimpleClientset(
+				podWithIP("default", "web", "fd00::1", corev1.PodRunning),
+				podWithIP("default", "db", "fd00::2", corev1.PodRunning),
+			)
+			var selectors []string
+			clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				selector := action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+				selectors = append(selectors, selector)
+				if rejectSelector && len(selector) > 0 {
+					return true, nil, errors.NewBadRequest(`field label not supported: status.podIP`)
+				}
+				return false, nil, nil
+			})
+			o := &DebugOptions{Namespace: "default", PodIP: podIP, PodClient: clientset.CoreV1()}
+
+			name, err := o.podByIP()
+			if err != nil {
+				t.Fatalf("%s rejectSelector=%v: error finding the pod by ip: %v", podIP, rejectSelector, err)
+			}
+			if name != "web" {
+				t.Errorf("%s rejectSelector=%v: got pod %s, want web", podIP, rejectSelector, name)
+			}
+			if selectors[0] != "status.podIP=fd00::1" {
+				t.Errorf("%s rejectSelector=%v: got selector %q, want the canonical ip", podIP, rejectSelector, selectors[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"net/http"
+)
+
+const (
+	defaultAgentNamespace = "default"
+	defaultAgentSelector  = "app=debug-agent"
+)
+
+// agentPortForward forwards a local port to the agent pod through the api server,
+// like `kubectl port-forward`, for nodes which are not reachable directly
+type agentPortForward struct {
+	forwarder *portforward.PortForwarder
+	stop      chan struct{}
+	localPort uint16
+}
+
+// newAgentPortForward forwards a random local port to the port of the agent pod
+func (o *DebugOptions) newAgentPortForward(namespace string, podName string, port int) (*agentPortForward, error) {
+	var transport http.RoundTripper
+	var upgrader spdy.Upgrader
+	var err error
+	if o.apiProxy != nil {
+		// the port-forward goes through the api server, so through its proxy as well
+		transport, upgrader, err = newProxyUpgrader(o.Config, o.apiProxy, o.KeepaliveInterval)
+	} else {
+		transport, upgrader, err = keepaliveRoundTripperFor(o.Config, o.KeepaliveInterval)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req := o.KubeCli.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	stop, ready := make(chan struct{}), make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)},
+		stop, ready, ioutil.Discard, o.ErrOut)
+	if err != nil {
+		return nil, err
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- forwarder.ForwardPorts()
+	}()
+	select {
+	case err := <-errCh:
+		return nil, fmt.Errorf("cannot port-forward to agent pod %s/%s: %v", namespace, podName, err)
+	case <-ready:
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		close(stop)
+		return nil, err
+	}
+	return &agentPortForward{forwarder: forwarder, stop: stop, localPort: ports[0].Local}, nil
+}
+
+// LocalAddr returns the local address which is forwarded to the agent
+func (f *agentPortForward) LocalAddr() string {
+	return fmt.Sprintf("127.0.0.1:%d", f.localPort)
+}
+
+func (f *agentPortForward) Close() {
+	close(f.stop)
+}
+
+// agentPodOnNode finds the running pod of the debug-agent DaemonSet on the node
+func (o *DebugOptions) agentPodOnNode(nodeName string) (string, error) {
+	pods, err := o.PodClient.Pods(o.AgentNamespace).List(v1.ListOptions{
+		LabelSelector: o.AgentSelector,
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return "", explainForbidden(err, "list", "pods", "", o.AgentNamespace)
+	}
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning {
+			return pod.Name, nil
+		}
+	}
+	return "", fmt.Errorf("no running agent pod matching %q in namespace %s on node %s, set --agent-namespace and --agent-selector to find it",
+		o.AgentSelector, o.AgentNamespace, nodeName)
+}
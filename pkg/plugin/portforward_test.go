@@ -0,0 +1,43 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// TestPortForwardKeepsServerPath checks that the port-forward of the session goes
+// through the path of a server behind a proxy, e.g. `kubectl proxy` or rancher
+func TestPortForwardKeepsServerPath(t *testing.T) {
+	paths := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case paths <- req.URL.Path:
+		default:
+		}
+		http.Error(w, "upgrade refused", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := &restclient.Config{Host: server.URL + "/k8s/clusters/c-1"}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &DebugOptions{Config: config, KubeCli: clientset}
+	if _, err := o.newAgentPortForward("kube-system", "debug-agent-x", 10027); err == nil {
+		t.Fatal("expected the refused upgrade to fail the port-forward")
+	}
+	select {
+	case path := <-paths:
+		want := "/k8s/clusters/c-1/api/v1/namespaces/kube-system/pods/debug-agent-x/portforward"
+		if path != want {
+			t.Errorf("port-forward requested %s, want %s", path, want)
+		}
+	default:
+		t.Fatal("the port-forward did not reach the server")
+	}
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	agentReachable   = "reachable"
+	agentUnreachable = "unreachable"
+	agentUnhealthy   = "unhealthy"
+
+	// probeParallelism bounds the nodes probed at the same time
+	probeParallelism = 16
+)
+
+// agentProbe is the result of probing the agent on a node
+type agentProbe struct {
+	Node    string `json:"node"`
+	Address string `json:"address"`
+	Status  string `json:"status"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// NewProbePortsCmd returns a cobra command probing the agents on all nodes
+func NewProbePortsCmd(opts *DebugOptions) *cobra.Command {
+	var output, selector string
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "probe-ports",
+		Short: "Check that the agent is reachable and healthy on every node",
+		Long: `Dial the agent port of every node and query the health of the agents which
+are reachable, so that dead agents are found before they are needed to debug.`,
+		Args: cobra.NoArgs,
+		Run: func(c *cobra.Command, args []string) {
+			if err := opts.ProbePorts(selector, timeout, output); err != nil {
+				fmt.Fprintln(opts.ErrOut, opts.redact(err.Error()))
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, one of: json")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Label selector of the nodes to probe, default to all nodes")
+	cmd.Flags().DurationVar(&timeout, "timeout", agentDialTimeout, "Timeout of connecting to and querying each agent")
+	return cmd
+}
+
+// ProbePorts probes the agent on each node matching the selector and prints the results
+func (o *DebugOptions) ProbePorts(selector string, timeout time.Duration, output string) error {
+	if len(output) > 0 && output != "json" {
+		return fmt.Errorf("unsupported output format %q, only json is supported", output)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("--timeout must be positive")
+	}
+	config, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	o.redactor = newRedactor(config.SensitiveKeys)
+	o.completeAgentPort(config)
+	if err := o.completeClient(); err != nil {
+		return err
+	}
+
+	nodes, err := o.NodeClient.Nodes().List(v1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return explainForbidden(err, "list", "nodes", "", "")
+	}
+	versionClient, err := o.agentHTTPClient(timeout)
+	if err != nil {
+		return err
+	}
+	probes := make([]agentProbe, len(nodes.Items))
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, probeParallelism)
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		probes[i] = agentProbe{Node: node.Name}
+		address, err := nodeAddress(node)
+		if err != nil {
+			probes[i].Status = agentUnreachable
+			probes[i].Error = err.Error()
+			continue
+		}
+		agentURL, err := o.agentURL(agentURLParams{HostIP: address, NodeName: node.Name, Port: o.AgentPort})
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(probe *agentProbe) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			probe.Address = agentHostPort(agentURL)
+			probeAgent(probe, agentAPI(agentURL, "/healthz", nil).String(), timeout)
+			if probe.Status == agentReachable {
+				if info, err := getAgentInfo(versionClient, agentURL); err == nil {
+					probe.Version = info.Version
+				}
+			}
+		}(&probes[i])
+	}
+	wg.Wait()
+	sort.Slice(probes, func(i, j int) bool { return probes[i].Node < probes[j].Node })
+
+	if output == "json" {
+		encoder := json.NewEncoder(o.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(probes)
+	}
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tADDRESS\tSTATUS\tVERSION\tERROR")
+	for _, p := range probes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Node, p.Address, p.Status, p.Version, o.redact(p.Error))
+	}
+	return w.Flush()
+}
+
+// probeAgent dials the agent like a debug session does, then queries its health
+func probeAgent(probe *agentProbe, healthURL string, timeout time.Duration) {
+	conn, err := net.DialTimeout("tcp", probe.Address, timeout)
+	if err != nil {
+		probe.Status = agentUnreachable
+		probe.Error = err.Error()
+		return
+	}
+	conn.Close()
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(healthURL)
+	if err != nil {
+		probe.Status = agentUnhealthy
+		probe.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		probe.Status = agentUnhealthy
+		probe.Error = fmt.Sprintf("health check responded with status %s", resp.Status)
+		return
+	}
+	probe.Status = agentReachable
+}
@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"text/tabwriter"
+)
+
+// timeoutProfileInfo is a timeout profile as listed by the profiles command
+type timeoutProfileInfo struct {
+	Name string `json:"name"`
+	// Source is builtin, config or builtin+config for a built-in profile the config file overrides
+	Source string            `json:"source"`
+	Flags  map[string]string `json:"flags"`
+}
+
+// NewProfilesCmd returns a cobra command listing the timeout profiles of --timeout-profile
+func NewProfilesCmd(opts *DebugOptions) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "profiles",
+		Short: "List the timeout profiles, built-in and of the config file",
+		Args:  cobra.NoArgs,
+		Run: func(c *cobra.Command, args []string) {
+			if err := opts.ListProfiles(output); err != nil {
+				fmt.Fprintln(opts.ErrOut, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, one of: json")
+	return cmd
+}
+
+// ListProfiles prints the timeout profiles of the resolved config file with the
+// timeouts they set, an empty column is left to the flag or its default
+func (o *DebugOptions) ListProfiles(output string) error {
+	if len(output) > 0 && output != "json" {
+		return fmt.Errorf("unsupported output format %q, only json is supported", output)
+	}
+	config, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	var profiles []timeoutProfileInfo
+	for _, name := range timeoutProfileNames(config.TimeoutProfiles) {
+		_, builtin := timeoutProfiles[name]
+		_, overridden := config.TimeoutProfiles[name]
+		source := "config"
+		if builtin && overridden {
+			source = "builtin+config"
+		} else if builtin {
+			source = "builtin"
+		}
+		profiles = append(profiles, timeoutProfileInfo{
+			Name:   name,
+			Source: source,
+			Flags:  resolveTimeoutProfile(name, config.TimeoutProfiles),
+		})
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(o.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(profiles)
+	}
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSOURCE\tATTACH\tCOMMAND\tIDLE\tREADY\tKEEPALIVE\tRETRIES")
+	for _, profile := range profiles {
+		flags := profile.Flags
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", profile.Name, profile.Source,
+			flags["attach-timeout"], flags["command-timeout"], flags["idle-timeout"],
+			flags["ready-wait"], flags["keepalive-interval"], flags["api-retries"])
+	}
+	return w.Flush()
+}
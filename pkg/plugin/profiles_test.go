@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestListProfiles(t *testing.T) {
+	file, err := ioutil.TempFile("", "kubectl-debug-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString("timeout_profiles:\n  ci:\n    command-timeout: 30m\n  incident:\n    idle-timeout: 2h\n")
+	file.Close()
+
+	var out bytes.Buffer
+	o := &DebugOptions{ConfigLocations: []string{file.Name()}}
+	o.Out = &out
+	if err := o.ListProfiles("json"); err != nil {
+		t.Fatal(err)
+	}
+	var profiles []timeoutProfileInfo
+	if err := json.Unmarshal(out.Bytes(), &profiles); err != nil {
+		t.Fatalf("invalid json %q: %v", out.String(), err)
+	}
+	got := map[string]timeoutProfileInfo{}
+	for _, profile := range profiles {
+		got[profile.Name] = profile
+	}
+	if len(got) != 4 {
+		t.Errorf("got profiles %v, want batch, ci, incident and interactive", profiles)
+	}
+	if ci := got["ci"]; ci.Source != "builtin+config" || ci.Flags["command-timeout"] != "30m" || ci.Flags["idle-timeout"] != "5m" {
+		t.Errorf("got ci %+v, want the built-in one with the command timeout of the config", ci)
+	}
+	if incident := got["incident"]; incident.Source != "config" || len(incident.Flags) != 1 {
+		t.Errorf("got incident %+v, want the one of the config", incident)
+	}
+	if batch := got["batch"]; batch.Source != "builtin" || batch.Flags["command-timeout"] != "1h" {
+		t.Errorf("got batch %+v, want the built-in one", batch)
+	}
+
+	if err := o.ListProfiles("yaml"); err == nil {
+		t.Error("expected an error for output yaml")
+	}
+}
@@ -0,0 +1,235 @@
+package plugin
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	restclient "k8s.io/client-go/rest"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const httpsProxyEnvironment = "HTTPS_PROXY"
+
+// kubeconfigClusters is the part of a kubeconfig file holding the proxy-url of
+// the clusters, which the vendored client-go predates and drops when loading
+type kubeconfigClusters struct {
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			ProxyURL string `yaml:"proxy-url"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+}
+
+// completeAPIProxy resolves the proxy-url of the cluster of the current context, which
+// the api requests go through, including the port-forward, while the agent is still
+// reached directly. An HTTPS_PROXY set by the user takes precedence.
+func (o *DebugOptions) completeAPIProxy() error {
+	o.apiProxy = nil
+	if len(os.Getenv(httpsProxyEnvironment)) > 0 || len(os.Getenv("https_proxy")) > 0 {
+		return nil
+	}
+	proxyURL, err := o.kubeconfigProxyURL()
+	if err != nil || len(proxyURL) < 1 {
+		return err
+	}
+	proxy, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy-url %q in kubeconfig: %v", proxyURL, err)
+	}
+	if proxy.Scheme != "http" && proxy.Scheme != "https" {
+		return fmt.Errorf("invalid proxy-url %q in kubeconfig: scheme must be http or https", proxyURL)
+	}
+	o.apiProxy = proxy
+	return nil
+}
+
+// wrapAPIProxy makes the transport of the api clients go through the proxy
+func wrapAPIProxy(proxy *url.URL) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		transport, ok := rt.(*http.Transport)
+		if !ok {
+			return rt
+		}
+		// the transport is shared through the tls cache of client-go
+		transport = transport.Clone()
+		transport.Proxy = http.ProxyURL(proxy)
+		return transport
+	}
+}
+
+// kubeconfigProxyURL returns the proxy-url of the cluster of the current context
+func (o *DebugOptions) kubeconfigProxyURL() (string, error) {
+	loader := o.Flags.ToRawKubeConfigLoader()
+	rawConfig, err := loader.RawConfig()
+	if err != nil {
+		return "", err
+	}
+	contextName := rawConfig.CurrentContext
+	if o.Flags.Context != nil && len(*o.Flags.Context) > 0 {
+		contextName = *o.Flags.Context
+	}
+	clusterName := ""
+	if context, ok := rawConfig.Contexts[contextName]; ok {
+		clusterName = context.Cluster
+	}
+	if o.Flags.ClusterName != nil && len(*o.Flags.ClusterName) > 0 {
+		clusterName = *o.Flags.ClusterName
+	}
+	if len(clusterName) < 1 {
+		return "", nil
+	}
+
+	files := loader.ConfigAccess().GetLoadingPrecedence()
+	if loader.ConfigAccess().IsExplicitFile() {
+		files = []string{loader.ConfigAccess().GetExplicitFile()}
+	}
+	// the first file defining the cluster wins, like kubeconfig merging does
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var kubeconfig kubeconfigClusters
+		if err := yaml.Unmarshal(content, &kubeconfig); err != nil {
+			continue
+		}
+		for _, cluster := range kubeconfig.Clusters {
+			if cluster.Name == clusterName {
+				return cluster.Cluster.ProxyURL, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// apiProxyView returns the proxy of the api requests without its password
+func (o *DebugOptions) apiProxyView() string {
+	proxy := os.Getenv(httpsProxyEnvironment)
+	if len(proxy) < 1 {
+		proxy = os.Getenv("https_proxy")
+	}
+	if o.apiProxy != nil {
+		proxy = o.apiProxy.String()
+	}
+	if u, err := url.Parse(proxy); err == nil && u.User != nil {
+		u.User = url.User(u.User.Username())
+		return u.String()
+	}
+	return proxy
+}
+
+// proxyUpgrader is the round tripper and upgrader of the port-forward through the
+// proxy-url, as the vendored spdy round tripper only takes the proxy from the environment
+type proxyUpgrader struct {
+	proxy     *url.URL
+	tlsConfig *tls.Config
+	keepalive time.Duration
+	conn      net.Conn
+}
+
+func newProxyUpgrader(config *restclient.Config, proxy *url.URL, keepalive time.Duration) (http.RoundTripper, *proxyUpgrader, error) {
+	tlsConfig, err := restclient.TLSConfigFor(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	upgrader := &proxyUpgrader{proxy: proxy, tlsConfig: tlsConfig, keepalive: keepalive}
+	wrapper, err := restclient.HTTPWrappersForConfig(config, upgrader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrapper, upgrader, nil
+}
+
+func (u *proxyUpgrader) RoundTrip(req *http.Request) (*http.Response, error) {
+	conn, err := dialThroughProxy(u.proxy, req.URL, u.tlsConfig, u.keepalive)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	u.conn = conn
+	return resp, nil
+}
+
+// NewConnection checks the upgrade response like the spdy round tripper does
+func (u *proxyUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	connection := strings.ToLower(resp.Header.Get(httpstream.HeaderConnection))
+	upgrade := strings.ToLower(resp.Header.Get(httpstream.HeaderUpgrade))
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.Contains(connection, strings.ToLower(httpstream.HeaderUpgrade)) ||
+		!strings.Contains(upgrade, strings.ToLower(spdy.HeaderSpdy31)) {
+		defer u.conn.Close()
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("unable to upgrade connection: %s", strings.TrimSpace(string(body)))
+	}
+	return spdy.NewClientConnection(u.conn)
+}
+
+// dialThroughProxy opens a tunnel to target with a CONNECT request to the proxy,
+// and speaks tls over it to https targets
+func dialThroughProxy(proxy *url.URL, target *url.URL, tlsConfig *tls.Config, keepalive time.Duration) (net.Conn, error) {
+	conn, err := keepaliveDialer(agentDialTimeout, keepalive).Dial("tcp", agentHostPort(proxy))
+	if err != nil {
+		return nil, err
+	}
+	if proxy.Scheme == "https" {
+		conn = tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+	}
+	host := agentHostPort(target)
+	connect := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: host}, Host: host, Header: http.Header{}}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		connect.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), connect)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", proxy.Host, host, resp.Status)
+	}
+	if target.Scheme != "https" {
+		return conn, nil
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if len(tlsConfig.ServerName) < 1 {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = target.Hostname()
+	}
+	tlsConn := tls.Client(conn, tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+const proxyKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: behind-proxy
+  cluster:
+    server: http://kube-api.example:6443
+    proxy-url: %s
+contexts:
+- name: behind-proxy
+  context:
+    cluster: behind-proxy
+current-context: behind-proxy
+`
+
+// TestKubeconfigProxyURL checks that the api requests and the port-forward go through the
+// proxy-url of the context, and that nothing else of the process does
+func TestKubeconfigProxyURL(t *testing.T) {
+	if len(os.Getenv(httpsProxyEnvironment)) > 0 || len(os.Getenv("https_proxy")) > 0 {
+		t.Skip("HTTPS_PROXY is set in the environment and takes precedence")
+	}
+	var lock sync.Mutex
+	var requests []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if req.Method == http.MethodConnect {
+			requests = append(requests, "CONNECT "+req.Host)
+		} else {
+			requests = append(requests, req.Method+" "+req.URL.String())
+		}
+		http.Error(w, "denied by the test proxy", http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	kubeconfig, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(kubeconfig.Name())
+	fmt.Fprintf(kubeconfig, proxyKubeconfig, proxy.URL)
+	kubeconfig.Close()
+
+	flags := genericclioptions.NewConfigFlags(false)
+	*flags.KubeConfig = kubeconfig.Name()
+	o := &DebugOptions{Flags: flags}
+	o.ErrOut = ioutil.Discard
+	if err := o.completeClient(); err != nil {
+		t.Fatal(err)
+	}
+	if len(os.Getenv(httpsProxyEnvironment)) > 0 {
+		t.Errorf("the proxy-url must not be set for the whole process")
+	}
+
+	o.PodClient.Pods("default").Get("web", v1.GetOptions{})
+	if _, err := o.newAgentPortForward("default", "debug-agent-x", 10027); err == nil {
+		t.Errorf("expected the port-forward to fail on the denying proxy")
+	}
+	want := []string{
+		"GET http://kube-api.example:6443/api/v1/namespaces/default/pods/web",
+		"CONNECT kube-api.example:6443",
+	}
+	if len(requests) != len(want) || requests[0] != want[0] || requests[1] != want[1] {
+		t.Errorf("the proxy got %q, want %q", requests, want)
+	}
+
+	client, err := o.agentHTTPClient(agentRequestTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	agentRequest, _ := http.NewRequest(http.MethodGet, "https://10.0.0.1:10027/api/v1/sessions", nil)
+	if transportProxy := client.Transport.(*http.Transport).Proxy; transportProxy != nil {
+		if agentProxy, _ := transportProxy(agentRequest); agentProxy != nil {
+			t.Errorf("the agent must be reached without the proxy-url, got proxy %s", agentProxy)
+		}
+	}
+	if view := o.apiProxyView(); view != proxy.URL {
+		t.Errorf("got proxy %q in the rest config dump, want %q", view, proxy.URL)
+	}
+}
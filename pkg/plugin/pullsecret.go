@@ -0,0 +1,68 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/aylei/kubectl-debug/pkg/util"
+	"github.com/docker/docker/api/types"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog"
+)
+
+// registryAuth returns the encoded credentials for the registry of the debug image,
+// taken from the first of the --image-pull-secret secrets, then the --registry-config
+// file, which has credentials for it. It is empty if none has, and the agent pulls
+// with the docker config of the node if it is configured, or anonymously.
+// The credentials are only sent to the agent in a header and never printed.
+func (o *DebugOptions) registryAuth() (string, error) {
+	for _, name := range o.ImagePullSecrets {
+		secret, err := o.KubeCli.CoreV1().Secrets(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				return "", fmt.Errorf("secret %s referenced by --image-pull-secret not found in namespace %s", name, o.Namespace)
+			}
+			return "", explainForbidden(err, "get", "secrets", "", o.Namespace)
+		}
+		var config []byte
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			config = secret.Data[corev1.DockerConfigJsonKey]
+		case corev1.SecretTypeDockercfg:
+			config = secret.Data[corev1.DockerConfigKey]
+		default:
+			return "", fmt.Errorf("secret %s referenced by --image-pull-secret is of type %s, must be %s or %s",
+				name, secret.Type, corev1.SecretTypeDockerConfigJson, corev1.SecretTypeDockercfg)
+		}
+		auth, err := term.RegistryAuth(config, o.Image)
+		if err != nil {
+			return "", fmt.Errorf("secret %s referenced by --image-pull-secret: %v", name, err)
+		}
+		if auth != nil {
+			return encodeRegistryAuth(auth)
+		}
+	}
+	if len(o.RegistryConfig) > 0 {
+		config, err := ioutil.ReadFile(o.RegistryConfig)
+		if err != nil {
+			return "", fmt.Errorf("cannot read --registry-config: %v", err)
+		}
+		auth, err := term.RegistryAuth(config, o.Image)
+		if err != nil {
+			return "", fmt.Errorf("--registry-config %s: %v", o.RegistryConfig, err)
+		}
+		if auth != nil {
+			return encodeRegistryAuth(auth)
+		}
+	}
+	if len(o.ImagePullSecrets) > 0 || len(o.RegistryConfig) > 0 {
+		fmt.Fprintf(o.messageOut(), "warning: no credentials for the registry of image %s, the agent pulls it with its own or anonymously\n", o.Image)
+	}
+	return "", nil
+}
+
+func encodeRegistryAuth(auth *types.AuthConfig) (string, error) {
+	klog.V(4).Infof("sending credentials of user %s for registry %s", auth.Username, auth.ServerAddress)
+	return term.EncodeRegistryAuth(auth)
+}
@@ -0,0 +1,167 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const defaultRBACName = "kubectl-debug"
+
+// rbacRule is a permission the plugin needs, namespaced unless cluster is set
+type rbacRule struct {
+	apiGroup string
+	resource string
+	verbs    []string
+	cluster  bool
+	// usedFor tells which feature needs the rule, empty for the required ones
+	usedFor string
+}
+
+// rbacModes are the rules of each debug mode compiled into the plugin. In the
+// agent mode the plugin talks to the agent on the node directly, so no pods/exec
+// or pods/ephemeralcontainers is needed, the agent port must be reachable instead
+var rbacModes = map[string][]rbacRule{
+	"agent": {
+		{resource: "pods", verbs: []string{"get"}},
+		{resource: "pods", verbs: []string{"list"}, usedFor: "workloads, job/NAME, cronjob/NAME, --watch and --port-forward"},
+		{resource: "pods", verbs: []string{"create", "delete"}, usedFor: "--agentless and --fork"},
+		{resource: "pods/portforward", verbs: []string{"create"}, usedFor: "--port-forward, in the namespace of the agent pods"},
+		{resource: "pods/log", verbs: []string{"get"}, usedFor: "--with-logs-pane"},
+		{resource: "configmaps", verbs: []string{"get"}, usedFor: "--env-from-configmap"},
+		{resource: "secrets", verbs: []string{"get"}, usedFor: "--env-from-secret and --image-pull-secret"},
+		{apiGroup: "apps", resource: "deployments", verbs: []string{"get"}, usedFor: "deployment/NAME"},
+		{apiGroup: "apps", resource: "statefulsets", verbs: []string{"get"}, usedFor: "statefulset/NAME"},
+		{apiGroup: "apps", resource: "daemonsets", verbs: []string{"get"}, usedFor: "daemonset/NAME"},
+		{apiGroup: "apps", resource: "replicasets", verbs: []string{"get"}, usedFor: "replicaset/NAME"},
+		{apiGroup: "batch", resource: "jobs", verbs: []string{"get"}, usedFor: "job/NAME and cronjob/NAME"},
+		{apiGroup: "batch", resource: "cronjobs", verbs: []string{"get"}, usedFor: "cronjob/NAME"},
+		{resource: "nodes", verbs: []string{"get"}, cluster: true,
+			usedFor: "node/NAME, sessions, node label policies and the architecture check"},
+		{resource: "nodes", verbs: []string{"list"}, cluster: true, usedFor: "probe-ports"},
+	},
+}
+
+// roleRule and role are the yaml of a ready-to-apply Role or ClusterRole
+type roleRule struct {
+	APIGroups []string `yaml:"apiGroups"`
+	Resources []string `yaml:"resources"`
+	Verbs     []string `yaml:"verbs"`
+}
+
+type roleMetadata struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+type role struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   roleMetadata `yaml:"metadata"`
+	Rules      []roleRule   `yaml:"rules"`
+}
+
+// NewRBACHelpCmd returns a cobra command printing the rbac rules needed by the plugin
+func NewRBACHelpCmd(opts *DebugOptions) *cobra.Command {
+	var mode, output, name string
+	cmd := &cobra.Command{
+		Use:   "rbac-help",
+		Short: "Print the rbac rules a user needs to debug pods",
+		Long: `Print the minimal rbac rules a user needs for each debug mode, with the features needing
+the optional ones. With -o yaml, a Role for the namespace and a ClusterRole for the
+cluster scoped resources are printed, ready to be applied and bound to the user.`,
+		Args: cobra.NoArgs,
+		Run: func(c *cobra.Command, args []string) {
+			if err := opts.PrintRBAC(mode, output, name); err != nil {
+				fmt.Fprintln(opts.ErrOut, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&mode, "mode", "agent",
+		fmt.Sprintf("Debug mode to print the rules of, one of: %s", strings.Join(rbacModeNames(), "|")))
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, one of: yaml")
+	cmd.Flags().StringVar(&name, "name", defaultRBACName, "Name of the Role and ClusterRole printed by -o yaml")
+	return cmd
+}
+
+// PrintRBAC prints the rbac rules of the debug mode as a table or as yaml
+func (o *DebugOptions) PrintRBAC(mode string, output string, name string) error {
+	rules, ok := rbacModes[mode]
+	if !ok {
+		return fmt.Errorf("unsupported mode %q, must be one of %s", mode, strings.Join(rbacModeNames(), ", "))
+	}
+	if len(output) > 0 && output != "yaml" {
+		return fmt.Errorf("unsupported output format %q, only yaml is supported", output)
+	}
+	if output == "yaml" {
+		namespace, _, err := o.Flags.ToRawKubeConfigLoader().Namespace()
+		if err != nil {
+			return err
+		}
+		return o.writeRoles(rules, name, namespace)
+	}
+
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "API GROUP\tRESOURCE\tVERBS\tSCOPE\tNEEDED FOR")
+	for _, rule := range rules {
+		apiGroup := rule.apiGroup
+		if len(apiGroup) < 1 {
+			apiGroup = "core"
+		}
+		scope := "namespace"
+		if rule.cluster {
+			scope = "cluster"
+		}
+		usedFor := rule.usedFor
+		if len(usedFor) < 1 {
+			usedFor = "every session"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", apiGroup, rule.resource, strings.Join(rule.verbs, ","), scope, usedFor)
+	}
+	return w.Flush()
+}
+
+// writeRoles prints a Role with the namespaced rules and a ClusterRole with the cluster scoped ones
+func (o *DebugOptions) writeRoles(rules []rbacRule, name string, namespace string) error {
+	roles := []role{
+		{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role", Metadata: roleMetadata{Name: name, Namespace: namespace}},
+		{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRole", Metadata: roleMetadata{Name: name}},
+	}
+	for _, rule := range rules {
+		r := &roles[0]
+		if rule.cluster {
+			r = &roles[1]
+		}
+		r.Rules = append(r.Rules, roleRule{APIGroups: []string{rule.apiGroup}, Resources: []string{rule.resource}, Verbs: rule.verbs})
+	}
+	separator := false
+	for _, r := range roles {
+		if len(r.Rules) < 1 {
+			continue
+		}
+		if separator {
+			fmt.Fprintln(o.Out, "---")
+		}
+		separator = true
+		bytes, err := yaml.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := o.Out.Write(bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rbacModeNames() []string {
+	names := make([]string, 0, len(rbacModes))
+	for name := range rbacModes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
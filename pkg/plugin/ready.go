@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"strings"
+	"time"
+)
+
+const readyPollInterval = time.Second
+
+// waitContainerReady returns the pod once the container is ready, waiting up to
+// --ready-wait for a container which is slow to pass its readiness probe
+func (o *DebugOptions) waitContainerReady(pod *corev1.Pod, containerName string) (*corev1.Pod, error) {
+	if !hasContainer(pod, containerName) {
+		return nil, containerNotFoundError(pod, containerName)
+	}
+	if containerReady(pod, containerName) {
+		return pod, nil
+	}
+	if o.ReadyWait <= 0 {
+		return nil, fmt.Errorf("container %s id not ready", containerName)
+	}
+	fmt.Fprintf(o.messageOut(), "Waiting up to %s for container %s to become ready\n", o.ReadyWait, containerName)
+	err := wait.PollImmediate(readyPollInterval, o.ReadyWait, func() (bool, error) {
+		current, err := o.PodClient.Pods(o.Namespace).Get(o.PodName, v1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if current.Status.Phase == corev1.PodSucceeded || current.Status.Phase == corev1.PodFailed {
+			return false, fmt.Errorf("pod completed while waiting for container %s; current phase is %s", containerName, current.Status.Phase)
+		}
+		pod = current
+		return containerReady(pod, containerName), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return nil, fmt.Errorf("container %s is still not ready after waiting %s", containerName, o.ReadyWait)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+func hasContainer(pod *corev1.Pod, containerName string) bool {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			return true
+		}
+	}
+	return false
+}
+
+// containerNotFoundError lists the containers of the pod with their readiness,
+// so that the command can be corrected right away
+func containerNotFoundError(pod *corev1.Pod, containerName string) error {
+	var containers []string
+	for _, container := range pod.Spec.Containers {
+		state := "not ready"
+		if containerReady(pod, container.Name) {
+			state = "ready"
+		}
+		containers = append(containers, fmt.Sprintf("%s (%s)", container.Name, state))
+	}
+	return fmt.Errorf("cannot find specified container %s in pod %s, available containers: %s",
+		containerName, pod.Name, strings.Join(containers, ", "))
+}
+
+func containerReady(pod *corev1.Pod, containerName string) bool {
+	for _, containerStatus := range pod.Status.ContainerStatuses {
+		if containerStatus.Name == containerName {
+			return containerStatus.Ready
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// readinessPod returns a running pod whose container app has the given readiness
+func readinessPod(ready bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}}},
+		Status: corev1.PodStatus{
+			Phase:             corev1.PodRunning,
+			ContainerStatuses: []corev1.ContainerStatus{{Name: "app", Ready: ready}},
+		},
+	}
+}
+
+// newReadyWaitOptions returns options whose pod gets ready after readyAfter gets
+func newReadyWaitOptions(readyWait time.Duration, readyAfter int) (*DebugOptions, *bytes.Buffer) {
+	clientset := fake.NewSimpleClientset()
+	gets := 0
+	clientset.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		gets++
+		return true, readinessPod(gets >= readyAfter), nil
+	})
+	var messages bytes.Buffer
+	o := &DebugOptions{Namespace: "default", PodName: "web", PodClient: clientset.CoreV1(), ReadyWait: readyWait}
+	o.ErrOut = &messages
+	return o, &messages
+}
+
+func TestWaitContainerReadyThenReady(t *testing.T) {
+	o, messages := newReadyWaitOptions(10*time.Second, 2)
+	pod, err := o.waitContainerReady(readinessPod(false), "app")
+	if err != nil {
+		t.Fatalf("expected the container to become ready: %v", err)
+	}
+	if !containerReady(pod, "app") {
+		t.Errorf("expected the ready pod to be returned")
+	}
+	if !strings.Contains(messages.String(), "Waiting up to 10s") {
+		t.Errorf("expected a waiting message, got %q", messages.String())
+	}
+}
+
+func TestWaitContainerReadyTimeout(t *testing.T) {
+	o, _ := newReadyWaitOptions(1500*time.Millisecond, 1000)
+	_, err := o.waitContainerReady(readinessPod(false), "app")
+	if err == nil || !strings.Contains(err.Error(), "still not ready after waiting 1.5s") {
+		t.Errorf("got %v, want a timeout error", err)
+	}
+}
+
+func TestWaitContainerReadyWithoutWait(t *testing.T) {
+	o, _ := newReadyWaitOptions(0, 1)
+	if _, err := o.waitContainerReady(readinessPod(true), "app"); err != nil {
+		t.Errorf("expected a ready container to be accepted right away: %v", err)
+	}
+	if _, err := o.waitContainerReady(readinessPod(false), "app"); err == nil {
+		t.Errorf("expected an error for a container which is not ready without --ready-wait")
+	}
+}
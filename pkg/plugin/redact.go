@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redacted = "***"
+
+// defaultSensitiveKeys are the key fragments whose values are always redacted
+var defaultSensitiveKeys = []string{"token", "authorization", "password", "passwd", "secret", "credential", "apikey", "api_key", "private_key"}
+
+// redactor masks the values of sensitive keys in the output of the plugin, so that
+// errors and verbose output can be shared without scrubbing them by hand
+type redactor struct {
+	// keyValue matches KEY=VALUE, KEY: VALUE and url encoded KEY%3DVALUE
+	keyValue *regexp.Regexp
+	// envVar matches the env vars of a printed pod spec, Name:KEY Value:VALUE
+	envVar *regexp.Regexp
+	// authScheme matches the credentials of an authorization header
+	authScheme *regexp.Regexp
+}
+
+// newRedactor returns a redactor for the default sensitive keys and the given ones,
+// keys match case insensitively as a part of a key, e.g. token matches GITHUB_TOKEN
+func newRedactor(keys []string) *redactor {
+	var quoted []string
+	for _, key := range append(defaultSensitiveKeys, keys...) {
+		if len(key) > 0 {
+			quoted = append(quoted, regexp.QuoteMeta(key))
+		}
+	}
+	key := `[\w.-]*(?:` + strings.Join(quoted, "|") + `)[\w.-]*`
+	return &redactor{
+		keyValue:   regexp.MustCompile(`(?i)(` + key + `\s*(?:[=:]|%3D)\s*)("[^"]*"|[^\s&,;"]+)`),
+		envVar:     regexp.MustCompile(`(?i)(Name:` + key + `\s+Value:)(\S*)`),
+		authScheme: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[^\s"]+`),
+	}
+}
+
+// Redact returns s with the values of sensitive keys masked
+func (r *redactor) Redact(s string) string {
+	s = r.envVar.ReplaceAllString(s, "${1}"+redacted)
+	s = r.authScheme.ReplaceAllString(s, "${1} "+redacted)
+	return r.keyValue.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// redact masks the sensitive values in s with the keys of the debug config
+func (o *DebugOptions) redact(s string) string {
+	if o.redactor == nil {
+		o.redactor = newRedactor(nil)
+	}
+	return o.redactor.Redact(s)
+}
@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   fmt.Sprintf("namespace: %s, pod: %s, args: %v", "default", "web", []string{"env", "PASSWORD=hunter2", "sh"}),
+			want: "namespace: default, pod: web, args: [env PASSWORD=*** sh]",
+		},
+		{in: "Authorization: Bearer hunter2", want: "Authorization: *** ***"},
+		{in: "url?token%3Dabc&x=1", want: "url?token%3D***&x=1"},
+		{in: "{Name:DB_PASSWORD Value:hunter2 ValueFrom:nil}", want: "{Name:DB_PASSWORD Value:*** ValueFrom:nil}"},
+		{in: "MY_KEY=hunter2", want: "MY_KEY=***"},
+		{in: "image: busybox", want: "image: busybox"},
+	}
+	o := &DebugOptions{redactor: newRedactor([]string{"my_key"})}
+	for _, test := range tests {
+		got := o.redact(test.in)
+		if got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+		if strings.Contains(got, "hunter2") {
+			t.Errorf("redact(%q) leaks the secret", test.in)
+		}
+	}
+}
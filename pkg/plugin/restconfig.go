@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"sort"
+)
+
+// restConfigView is the resolved rest config with every credential replaced by
+// whether it is set, so that it can be shared when diagnosing auth problems
+type restConfigView struct {
+	Host        string           `yaml:"host"`
+	APIPath     string           `yaml:"apiPath,omitempty"`
+	AuthMethods []string         `yaml:"authMethods"`
+	TLS         tlsView          `yaml:"tls"`
+	Impersonate *impersonateView `yaml:"impersonate,omitempty"`
+	Proxy       string           `yaml:"proxy,omitempty"`
+}
+
+type tlsView struct {
+	Insecure   bool   `yaml:"insecure"`
+	ServerName string `yaml:"serverName,omitempty"`
+	CA         string `yaml:"ca,omitempty"`
+	ClientCert string `yaml:"clientCert,omitempty"`
+	ClientKey  string `yaml:"clientKey,omitempty"`
+}
+
+type impersonateView struct {
+	UserName string   `yaml:"userName,omitempty"`
+	Groups   []string `yaml:"groups,omitempty"`
+	Extra    []string `yaml:"extra,omitempty"`
+}
+
+// dumpRestConfig prints the rest config used for the api calls and the stream to
+// the agent, credentials are never printed, only where they come from
+func (o *DebugOptions) dumpRestConfig() error {
+	config := o.Config
+	view := restConfigView{
+		Host:    config.Host,
+		APIPath: config.APIPath,
+		TLS: tlsView{
+			Insecure:   config.Insecure,
+			ServerName: config.ServerName,
+			CA:         credentialSource(config.CAFile, len(config.CAData) > 0),
+			ClientCert: credentialSource(config.CertFile, len(config.CertData) > 0),
+			ClientKey:  credentialSource(config.KeyFile, len(config.KeyData) > 0),
+		},
+		Proxy: o.apiProxyView(),
+	}
+	if len(config.BearerToken) > 0 {
+		view.AuthMethods = append(view.AuthMethods, "bearer token")
+	}
+	if len(config.BearerTokenFile) > 0 {
+		view.AuthMethods = append(view.AuthMethods, "bearer token file "+config.BearerTokenFile)
+	}
+	if len(config.Username) > 0 {
+		view.AuthMethods = append(view.AuthMethods, "basic auth as "+config.Username)
+	}
+	if len(config.CertFile) > 0 || len(config.CertData) > 0 {
+		view.AuthMethods = append(view.AuthMethods, "client certificate")
+	}
+	if config.AuthProvider != nil {
+		view.AuthMethods = append(view.AuthMethods, "auth provider "+config.AuthProvider.Name)
+	}
+	if config.ExecProvider != nil {
+		view.AuthMethods = append(view.AuthMethods, "exec plugin "+config.ExecProvider.Command)
+	}
+	if len(view.AuthMethods) < 1 {
+		view.AuthMethods = []string{"none"}
+	}
+	if impersonate := config.Impersonate; len(impersonate.UserName) > 0 || len(impersonate.Groups) > 0 {
+		view.Impersonate = &impersonateView{UserName: impersonate.UserName, Groups: impersonate.Groups}
+		for key := range impersonate.Extra {
+			view.Impersonate.Extra = append(view.Impersonate.Extra, key)
+		}
+		sort.Strings(view.Impersonate.Extra)
+	}
+
+	bytes, err := yaml.Marshal(view)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(o.messageOut(), "%s", bytes)
+	return err
+}
+
+// credentialSource describes where a credential is taken from without revealing it
+func credentialSource(file string, inline bool) string {
+	if len(file) > 0 {
+		return "file " + file
+	}
+	if inline {
+		return "inline data"
+	}
+	return ""
+}
@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"strings"
+)
+
+// inheritedRuntimeArgs returns the runtime args making the debug container run under
+// the security context of the target container: its user, capabilities, privilege
+// escalation and unconfined seccomp. The pod security context is the fallback of the
+// user, like it is for the containers of the pod.
+func inheritedRuntimeArgs(pod *corev1.Pod, containerName string) []string {
+	var container *corev1.Container
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == containerName {
+			container = &pod.Spec.Containers[i]
+		}
+	}
+	if container == nil {
+		return nil
+	}
+	var runAsUser, runAsGroup *int64
+	if podContext := pod.Spec.SecurityContext; podContext != nil {
+		runAsUser, runAsGroup = podContext.RunAsUser, podContext.RunAsGroup
+	}
+	var args []string
+	if context := container.SecurityContext; context != nil {
+		if context.RunAsUser != nil {
+			runAsUser = context.RunAsUser
+		}
+		if context.RunAsGroup != nil {
+			runAsGroup = context.RunAsGroup
+		}
+		if context.Capabilities != nil {
+			for _, capability := range context.Capabilities.Add {
+				args = append(args, "cap-add="+string(capability))
+			}
+			for _, capability := range context.Capabilities.Drop {
+				args = append(args, "cap-drop="+string(capability))
+			}
+		}
+		if context.AllowPrivilegeEscalation != nil && !*context.AllowPrivilegeEscalation {
+			args = append(args, "security-opt=no-new-privileges")
+		}
+	}
+	if runAsUser != nil {
+		user := fmt.Sprintf("%d", *runAsUser)
+		if runAsGroup != nil {
+			user = fmt.Sprintf("%s:%d", user, *runAsGroup)
+		}
+		args = append(args, "user="+user)
+	}
+	// only unconfined is inherited, the other profiles are the runtime default or
+	// local files of the node, which the debug container gets anyway or cannot load
+	seccomp, ok := pod.Annotations[corev1.SeccompContainerAnnotationKeyPrefix+containerName]
+	if !ok {
+		seccomp = pod.Annotations[corev1.SeccompPodAnnotationKey]
+	}
+	if seccomp == "unconfined" {
+		args = append(args, "security-opt=seccomp=unconfined")
+	}
+	return args
+}
+
+// mergeRuntimeArgs combines the inherited and the explicit runtime args, an explicit
+// key replaces all the inherited values of that key
+func mergeRuntimeArgs(inherited, explicit []string) []string {
+	keys := map[string]bool{}
+	for _, arg := range explicit {
+		keys[strings.SplitN(arg, "=", 2)[0]] = true
+	}
+	var merged []string
+	for _, arg := range inherited {
+		if !keys[strings.SplitN(arg, "=", 2)[0]] {
+			merged = append(merged, arg)
+		}
+	}
+	return append(merged, explicit...)
+}
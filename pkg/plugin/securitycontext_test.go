@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestInheritedRuntimeArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		podContext  *corev1.PodSecurityContext
+		context     *corev1.SecurityContext
+		annotations map[string]string
+		want        []string
+	}{
+		{name: "no security context"},
+		{
+			name:       "user of the pod",
+			podContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1000), RunAsGroup: int64Ptr(3000)},
+			want:       []string{"user=1000:3000"},
+		},
+		{
+			name:       "user of the container over the pod",
+			podContext: &corev1.PodSecurityContext{RunAsUser: int64Ptr(1000), RunAsGroup: int64Ptr(3000)},
+			context:    &corev1.SecurityContext{RunAsUser: int64Ptr(2000)},
+			want:       []string{"user=2000:3000"},
+		},
+		{
+			name: "capabilities and privilege escalation",
+			context: &corev1.SecurityContext{
+				Capabilities: &corev1.Capabilities{
+					Add:  []corev1.Capability{"NET_ADMIN"},
+					Drop: []corev1.Capability{"ALL"},
+				},
+				AllowPrivilegeEscalation: boolPtr(false),
+			},
+			want: []string{"cap-add=NET_ADMIN", "cap-drop=ALL", "security-opt=no-new-privileges"},
+		},
+		{
+			name:    "privilege escalation allowed",
+			context: &corev1.SecurityContext{AllowPrivilegeEscalation: boolPtr(true)},
+		},
+		{
+			name:        "unconfined seccomp of the container",
+			annotations: map[string]string{corev1.SeccompContainerAnnotationKeyPrefix + "app": "unconfined"},
+			want:        []string{"security-opt=seccomp=unconfined"},
+		},
+		{
+			name: "seccomp of the container over the pod",
+			annotations: map[string]string{
+				corev1.SeccompPodAnnotationKey:                     "unconfined",
+				corev1.SeccompContainerAnnotationKeyPrefix + "app": "runtime/default",
+			},
+		},
+	}
+	for _, test := range tests {
+		pod := &corev1.Pod{
+			ObjectMeta: v1.ObjectMeta{Annotations: test.annotations},
+			Spec: corev1.PodSpec{
+				SecurityContext: test.podContext,
+				Containers: []corev1.Container{
+					{Name: "sidecar"},
+					{Name: "app", SecurityContext: test.context},
+				},
+			},
+		}
+		if got := inheritedRuntimeArgs(pod, "app"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMergeRuntimeArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		inherited []string
+		explicit  []string
+		want      []string
+	}{
+		{
+			name:      "inherited only",
+			inherited: []string{"user=1000", "cap-drop=ALL"},
+			want:      []string{"user=1000", "cap-drop=ALL"},
+		},
+		{
+			name:      "explicit key replaces the inherited one",
+			inherited: []string{"user=1000", "cap-drop=ALL"},
+			explicit:  []string{"user=0"},
+			want:      []string{"cap-drop=ALL", "user=0"},
+		},
+		{
+			name:      "explicit key replaces all inherited values",
+			inherited: []string{"cap-add=NET_ADMIN", "cap-add=SYS_PTRACE", "user=1000"},
+			explicit:  []string{"cap-add=SYS_ADMIN"},
+			want:      []string{"user=1000", "cap-add=SYS_ADMIN"},
+		},
+		{
+			name:     "explicit only",
+			explicit: []string{"workdir=/tmp"},
+			want:     []string{"workdir=/tmp"},
+		},
+	}
+	for _, test := range tests {
+		if got := mergeRuntimeArgs(test.inherited, test.explicit); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// agentSession mirrors the session info reported by the agent
+type agentSession struct {
+	ContainerID       string    `json:"containerID"`
+	TargetContainerID string    `json:"targetContainerID"`
+	User              string    `json:"user,omitempty"`
+	Namespace         string    `json:"namespace,omitempty"`
+	Pod               string    `json:"pod,omitempty"`
+	Container         string    `json:"container,omitempty"`
+	Image             string    `json:"image"`
+	Command           []string  `json:"command"`
+	StartTime         time.Time `json:"startTime"`
+}
+
+// NewSessionsCmd returns a cobra command listing the active debug sessions on a node
+func NewSessionsCmd(opts *DebugOptions) *cobra.Command {
+	var output string
+	cmd := &cobra.Command{
+		Use:   "sessions NODE",
+		Short: "List the active debug sessions on a node",
+		Args:  cobra.ExactArgs(1),
+		Run: func(c *cobra.Command, args []string) {
+			if err := opts.ListSessions(args[0], output); err != nil {
+				fmt.Fprintln(opts.ErrOut, opts.redact(err.Error()))
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output format, one of: json")
+	opts.addAgentFlags(cmd.Flags())
+	return cmd
+}
+
+// ListSessions queries the agent running on the node for its active debug sessions
+func (o *DebugOptions) ListSessions(nodeName string, output string) error {
+	if len(output) > 0 && output != "json" {
+		return fmt.Errorf("unsupported output format %q, only json is supported", output)
+	}
+	config, err := o.loadConfig()
+	if err != nil {
+		return err
+	}
+	o.redactor = newRedactor(config.SensitiveKeys)
+	o.SSHBastion = config.SSHBastion
+	o.completeAgentPort(config)
+	if o.PortForward && o.UseSSHBastion {
+		return fmt.Errorf("--port-forward cannot be used together with --ssh-bastion")
+	}
+	if o.UseSSHBastion && o.SSHBastion == nil {
+		return fmt.Errorf("--ssh-bastion requires ssh_bastion to be set in the debug config file")
+	}
+	if err := o.completeClient(); err != nil {
+		return err
+	}
+
+	node, err := o.NodeClient.Nodes().Get(nodeName, v1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	address, err := nodeAddress(node)
+	if err != nil {
+		return err
+	}
+	params := agentURLParams{HostIP: address, NodeName: nodeName, Port: o.AgentPort}
+
+	var sessions []agentSession
+	if o.Agentless {
+		// every temporary agent serves a single session, so all of them on the node are asked
+		if o.Namespace, _, err = o.Flags.ToRawKubeConfigLoader().Namespace(); err != nil {
+			return err
+		}
+		agents, err := o.PodClient.Pods(o.Namespace).List(v1.ListOptions{
+			LabelSelector: agentPodLabel + "=true",
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+		})
+		if err != nil {
+			return explainForbidden(err, "list", "pods", "", o.Namespace)
+		}
+		for _, agent := range agents.Items {
+			if agent.Status.Phase != corev1.PodRunning {
+				continue
+			}
+			agentSessions, err := o.agentSessions(params, o.Namespace, agent.Name)
+			if err != nil {
+				return fmt.Errorf("agent pod %s: %v", agent.Name, err)
+			}
+			sessions = append(sessions, agentSessions...)
+		}
+	} else if sessions, err = o.agentSessions(params, o.AgentNamespace, ""); err != nil {
+		return fmt.Errorf("agent on node %s: %v", nodeName, err)
+	}
+
+	if output == "json" {
+		encoder := json.NewEncoder(o.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sessions)
+	}
+	w := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tNAMESPACE\tPOD\tCONTAINER\tIMAGE\tCOMMAND\tAGE")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.User, s.Namespace, s.Pod, s.Container,
+			s.Image, strings.Join(s.Command, " "), duration.HumanDuration(time.Since(s.StartTime)))
+	}
+	return w.Flush()
+}
+
+// agentSessions queries the sessions api of an agent, reached like the debug session
+func (o *DebugOptions) agentSessions(params agentURLParams, agentNamespace string, agentPod string) ([]agentSession, error) {
+	agentURL, closeAgent, err := o.dialAgent(params, agentNamespace, agentPod)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAgent()
+	client, err := o.agentHTTPClient(agentRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(agentAPI(agentURL, "/api/v1/sessions", nil).String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent responded with status %s", resp.Status)
+	}
+	var sessions []agentSession
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("cannot decode sessions from agent: %v", err)
+	}
+	return sessions, nil
+}
+
+// nodeAddress returns the address of the node which the agent listens on
+func nodeAddress(node *corev1.Node) (string, error) {
+	for _, address := range node.Status.Addresses {
+		if address.Type == corev1.NodeInternalIP {
+			return address.Address, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find the internal ip of node %s", node.Name)
+}
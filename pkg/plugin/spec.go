@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// containerSpec is the debug container the agent is asked to create
+type containerSpec struct {
+	Node      string   `yaml:"node"`
+	Image     string   `yaml:"image"`
+	Command   []string `yaml:"command"`
+	Args      []string `yaml:"args,omitempty"`
+	Env       []string `yaml:"env,omitempty"`
+	EnvFrom   *envFrom `yaml:"envFrom,omitempty"`
+	TTY       bool     `yaml:"tty"`
+	Stdin     bool     `yaml:"stdin"`
+	StdinOnce bool     `yaml:"stdinOnce"`
+	// Target is the container whose namespaces are joined, empty for --no-join
+	Target     *targetContainer `yaml:"target,omitempty"`
+	Namespaces namespaceModes   `yaml:"namespaces"`
+	// RuntimeArgs are applied by the agent on top of this spec if allowed
+	RuntimeArgs []string `yaml:"runtimeArgs,omitempty"`
+	// DNS replaces the resolv.conf inherited from the target
+	DNS *dnsConfig `yaml:"dns,omitempty"`
+}
+
+type dnsConfig struct {
+	Nameservers []string `yaml:"nameservers"`
+	Searches    []string `yaml:"searches,omitempty"`
+}
+
+type envFrom struct {
+	ConfigMaps []string `yaml:"configMaps,omitempty"`
+	Secrets    []string `yaml:"secrets,omitempty"`
+}
+
+type targetContainer struct {
+	Name string `yaml:"name"`
+	ID   string `yaml:"id"`
+}
+
+type namespaceModes struct {
+	Network string `yaml:"network"`
+	PID     string `yaml:"pid"`
+	IPC     string `yaml:"ipc"`
+	User    string `yaml:"user"`
+}
+
+// printContainerSpec prints the debug container which would be created for the
+// target container, secret values are not resolved
+func (o *DebugOptions) printContainerSpec(pod *corev1.Pod, containerName, containerId string, tty bool) error {
+	spec := containerSpec{
+		Node:        pod.Spec.NodeName,
+		Image:       o.Image,
+		Command:     o.Command,
+		Env:         o.containerEnv(tty),
+		TTY:         tty,
+		Stdin:       true,
+		StdinOnce:   true,
+		RuntimeArgs: o.RuntimeArgs,
+	}
+	if len(o.Entrypoint) > 0 {
+		spec.Command, spec.Args = []string{o.Entrypoint}, o.Command
+	}
+	if len(o.EnvFromConfigMaps) > 0 || len(o.EnvFromSecrets) > 0 {
+		spec.EnvFrom = &envFrom{ConfigMaps: o.EnvFromConfigMaps, Secrets: o.EnvFromSecrets}
+	}
+	if len(o.DNSServers) > 0 {
+		spec.DNS = &dnsConfig{Nameservers: o.DNSServers, Searches: o.DNSSearches}
+	}
+	mode := "host"
+	if !o.NoJoin {
+		_, id, err := splitContainerID(containerId)
+		if err != nil {
+			return err
+		}
+		spec.Target = &targetContainer{Name: containerName, ID: containerId}
+		mode = "container:" + id
+	}
+	spec.Namespaces = namespaceModes{Network: mode, PID: mode, IPC: mode, User: mode}
+
+	bytes, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	_, err = o.Out.Write(bytes)
+	return err
+}
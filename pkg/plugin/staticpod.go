@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"time"
+)
+
+const (
+	// mirrorPodAnnotation is set on the api object of a static pod
+	mirrorPodAnnotation = "kubernetes.io/config.mirror"
+	agentDialTimeout    = 5 * time.Second
+)
+
+// checkAgentReachable fails with a hint if no agent listens on the node of the pod,
+// which is typical for tainted control-plane nodes running static pods
+func (o *DebugOptions) checkAgentReachable(pod *corev1.Pod, agentAddress string) error {
+	conn, err := net.DialTimeout("tcp", agentAddress, agentDialTimeout)
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+	message := fmt.Sprintf("cannot reach the debug agent on node %s at %s: %v", pod.Spec.NodeName, agentAddress, err)
+	var taints []string
+	if node, nodeErr := o.NodeClient.Nodes().Get(pod.Spec.NodeName, v1.GetOptions{}); nodeErr == nil {
+		for _, taint := range node.Spec.Taints {
+			if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+				taints = append(taints, taint.ToString())
+			}
+		}
+	}
+	if len(taints) > 0 {
+		message += fmt.Sprintf("\nthe node has taints %v, the debug-agent DaemonSet must tolerate them to run there, "+
+			"e.g. with \"tolerations: [{operator: Exists}]\" to cover control-plane nodes", taints)
+	} else if isStaticPod(pod) {
+		message += "\nthe pod is a static pod, make sure the debug-agent DaemonSet is scheduled on its node"
+	}
+	return fmt.Errorf("%s", message)
+}
+
+// isStaticPod returns true for the mirror pod of a static pod, e.g. kube-apiserver-<node>,
+// which newer kubelets also make owned by the node
+func isStaticPod(pod *corev1.Pod) bool {
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return true
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "Node" {
+			return true
+		}
+	}
+	return false
+}
+
+// podNotFoundError hints at the naming of static pods, which are suffixed by the node name
+func (o *DebugOptions) podNotFoundError(err error) error {
+	if o.Namespace != "kube-system" {
+		return err
+	}
+	return fmt.Errorf("%v, note that static pods are named NAME-NODE, e.g. kube-apiserver-master-1", err)
+}
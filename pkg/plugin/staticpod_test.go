@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// staticPod returns a pod shaped like the mirror pod the kubelet reports for a static pod
+func staticPod(annotated bool, nodeOwned bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:        "kube-apiserver-master-1",
+			Namespace:   "kube-system",
+			Annotations: map[string]string{"kubernetes.io/config.source": "file"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName:   "master-1",
+			Containers: []corev1.Container{{Name: "kube-apiserver"}},
+		},
+		Status: corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			HostIP: "10.0.0.1",
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:        "kube-apiserver",
+				Ready:       true,
+				ContainerID: "docker://0123456789abcdef",
+			}},
+		},
+	}
+	if annotated {
+		pod.Annotations[mirrorPodAnnotation] = "0123456789abcdef"
+	}
+	if nodeOwned {
+		pod.OwnerReferences = []v1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: "master-1"}}
+	}
+	return pod
+}
+
+func TestIsStaticPod(t *testing.T) {
+	tests := []struct {
+		name      string
+		annotated bool
+		nodeOwned bool
+		want      bool
+	}{
+		{name: "mirror annotation", annotated: true, want: true},
+		{name: "owned by the node", nodeOwned: true, want: true},
+		{name: "both", annotated: true, nodeOwned: true, want: true},
+		{name: "regular pod", want: false},
+	}
+	for _, test := range tests {
+		if got := isStaticPod(staticPod(test.annotated, test.nodeOwned)); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCheckAgentReachableStaticPod(t *testing.T) {
+	// a port nothing listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name   string
+		taints []corev1.Taint
+		want   string
+	}{
+		{
+			name:   "tainted control-plane node",
+			taints: []corev1.Taint{{Key: "node-role.kubernetes.io/master", Effect: corev1.TaintEffectNoSchedule}},
+			want:   "must tolerate them",
+		},
+		{name: "untainted node", want: "the pod is a static pod"},
+	}
+	for _, test := range tests {
+		node := &corev1.Node{ObjectMeta: v1.ObjectMeta{Name: "master-1"}, Spec: corev1.NodeSpec{Taints: test.taints}}
+		clientset := fake.NewSimpleClientset(node)
+		o := &DebugOptions{NodeClient: clientset.CoreV1()}
+		err := o.checkAgentReachable(staticPod(true, false), address)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestPodNotFoundErrorStaticPodNaming(t *testing.T) {
+	notFound := errors.New(`pods "kube-apiserver" not found`)
+	o := &DebugOptions{Namespace: "kube-system"}
+	if err := o.podNotFoundError(notFound); !strings.Contains(err.Error(), "NAME-NODE") {
+		t.Errorf("got %v, want a hint at the naming of static pods", err)
+	}
+	o.Namespace = "default"
+	if err := o.podNotFoundError(notFound); err != notFound {
+		t.Errorf("got %v, want the error as is outside kube-system", err)
+	}
+}
@@ -0,0 +1,33 @@
+package plugin
+
+import (
+	"io"
+)
+
+// stdinOnceReader forwards the input up to its first EOF, which closes the stdin of the
+// debug container, so that piped scripts terminate, even if the input could be read
+// further, e.g. a terminal after ctrl-d. With keepOpen, the EOF is held back until done
+// is closed, which keeps the stdin of the debug container open until the session ends
+type stdinOnceReader struct {
+	in       io.Reader
+	eof      bool
+	keepOpen bool
+	done     <-chan struct{}
+}
+
+func (r *stdinOnceReader) Read(p []byte) (int, error) {
+	if !r.eof {
+		n, err := r.in.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		r.eof = true
+		if n > 0 {
+			return n, nil
+		}
+	}
+	if r.keepOpen {
+		<-r.done
+	}
+	return 0, io.EOF
+}
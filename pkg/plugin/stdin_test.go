@@ -0,0 +1,97 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chunkReader returns its chunks in order, a nil chunk is an EOF after which reading goes on
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) < 1 {
+		return 0, io.EOF
+	}
+	chunk := r.chunks[0]
+	r.chunks = r.chunks[1:]
+	if chunk == nil {
+		return 0, io.EOF
+	}
+	return copy(p, chunk), nil
+}
+
+// scriptAgent runs like `sh` reading a script, which only ends once stdin is closed
+func scriptAgent() execFunc {
+	return func(in io.Reader, out, errOut io.WriteCloser) error {
+		script, err := ioutil.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "ran %q", script)
+		return err
+	}
+}
+
+func streamScript(t *testing.T, in io.Reader) string {
+	agent := newFakeAgent(scriptAgent())
+	defer agent.Close()
+	var out bytes.Buffer
+	o, uri := newStreamOptions(t, agent, in, &out, ioutil.Discard)
+	result := make(chan error, 1)
+	go func() {
+		result <- o.streamSession(uri, false, nil)
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Fatalf("error streaming: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("session did not end at the EOF of stdin")
+	}
+	return out.String()
+}
+
+func TestStdinOnceHeredoc(t *testing.T) {
+	heredoc := "ss -tnp\necho done\n"
+	if out := streamScript(t, strings.NewReader(heredoc)); out != fmt.Sprintf("ran %q", heredoc) {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestStdinOnceStopsAtFirstEOF(t *testing.T) {
+	in := &chunkReader{chunks: [][]byte{[]byte("echo one\n"), nil, []byte("echo two\n")}}
+	if out := streamScript(t, in); out != fmt.Sprintf("ran %q", "echo one\n") {
+		t.Errorf("expected only the input before the first EOF, got %q", out)
+	}
+}
+
+func TestStdinKeptOpenUntilDone(t *testing.T) {
+	done := make(chan struct{})
+	r := &stdinOnceReader{in: strings.NewReader("input"), keepOpen: true, done: done}
+	buf := make([]byte, 16)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "input" {
+		t.Fatalf("expected the input, got %q, %v", buf[:n], err)
+	}
+	eof := make(chan error, 1)
+	go func() {
+		_, err := r.Read(buf)
+		eof <- err
+	}()
+	select {
+	case <-eof:
+		t.Fatalf("EOF before the session ended")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(done)
+	if err := <-eof; err != io.EOF {
+		t.Errorf("expected EOF once the session ended, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// sessionSummary describes a finished debug session, it is the data of --summary-template
+type sessionSummary struct {
+	Namespace         string    `json:"namespace,omitempty"`
+	Pod               string    `json:"pod,omitempty"`
+	Node              string    `json:"node"`
+	Container         string    `json:"container,omitempty"`
+	TargetContainerID string    `json:"targetContainerID,omitempty"`
+	Image             string    `json:"image"`
+	Command           []string  `json:"command"`
+	StartTime         time.Time `json:"startTime"`
+	EndTime           time.Time `json:"endTime"`
+	// Duration is the duration of the session, e.g. 1m30s
+	Duration string `json:"duration"`
+	// Error is empty if the session succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// parseSummaryTemplate compiles --summary-template
+func parseSummaryTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("summary").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --summary-template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// endSession completes the summary of the session which just ended with err, prints
+// it with --summary-template and writes the audit record, if the session got to start
+func (o *DebugOptions) endSession(err error) {
+	summary := o.summary
+	o.summary = nil
+	if summary == nil {
+		return
+	}
+	summary.EndTime = time.Now()
+	summary.Duration = summary.EndTime.Sub(summary.StartTime).Round(time.Second).String()
+	if err != nil {
+		summary.Error = o.redact(err.Error())
+	}
+	o.printSummary(summary)
+	o.audit(summary, exitCode(err))
+}
+
+// printSummary renders the summary to stdout if --summary-template is set
+func (o *DebugOptions) printSummary(summary *sessionSummary) {
+	if o.summaryTemplate == nil {
+		return
+	}
+	var rendered bytes.Buffer
+	if err := o.summaryTemplate.Execute(&rendered, summary); err != nil {
+		fmt.Fprintf(o.messageOut(), "cannot render --summary-template: %v\n", err)
+		return
+	}
+	if rendered.Len() > 0 && !bytes.HasSuffix(rendered.Bytes(), []byte("\n")) {
+		rendered.WriteString("\n")
+	}
+	o.Out.Write(rendered.Bytes())
+}
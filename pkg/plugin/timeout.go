@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"fmt"
+	utilexec "k8s.io/utils/exec"
+	"net/url"
+	osexec "os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// commandTimeoutExitCode is the exit code when --command-timeout is hit, like timeout(1)
+	commandTimeoutExitCode = 124
+	// commandTimeoutMessage is reported by the agent when it killed the debug container
+	commandTimeoutMessage = "command timed out after"
+)
+
+// commandTimeoutError is returned when the debug container was killed by --command-timeout
+type commandTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *commandTimeoutError) Error() string {
+	return fmt.Sprintf("debug command killed after the command timeout of %s", e.timeout)
+}
+
+// addTimeoutParams passes the command and attach timeouts, which the agent enforces by
+// killing the debug container
+func (o *DebugOptions) addTimeoutParams(params url.Values) {
+	if o.CommandTimeout > 0 {
+		params.Add("commandtimeout", o.CommandTimeout.String())
+	}
+	if o.AttachTimeout > 0 {
+		params.Add("attachtimeout", o.AttachTimeout.String())
+	}
+}
+
+// commandTimeoutErr returns a commandTimeoutError if the session ended with err because
+// the agent killed the debug container for --command-timeout, nil otherwise
+func (o *DebugOptions) commandTimeoutErr(err error) error {
+	if o.CommandTimeout > 0 && err != nil && strings.Contains(err.Error(), commandTimeoutMessage) {
+		return &commandTimeoutError{timeout: o.CommandTimeout}
+	}
+	return nil
+}
+
+// exitCode returns the exit code of a session which ended with err
+func exitCode(err error) int {
+	switch err.(type) {
+	case nil:
+		return 0
+	case *commandTimeoutError:
+		return commandTimeoutExitCode
+	case *podDeletedError:
+		return podDeletedExitCode
+	default:
+		if code, ok := commandExitCode(err); ok {
+			return code
+		}
+		return 1
+	}
+}
+
+// commandExitCode returns the non-zero exit code of the command of the debug
+// container, or of the local process with --local-exec, if err carries one
+func commandExitCode(err error) (int, bool) {
+	switch e := err.(type) {
+	case utilexec.ExitError:
+		return e.ExitStatus(), true
+	case *osexec.ExitError:
+		return e.ExitCode(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	remoteapi "k8s.io/apimachinery/pkg/util/remotecommand"
+	kubeletremote "k8s.io/kubernetes/pkg/kubelet/server/remotecommand"
+)
+
+// TestCommandTimeoutExitCode runs a sleeping command on a fake agent which kills it on
+// the command timeout it receives, like the agent does, the session must exit with 124
+func TestCommandTimeoutExitCode(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	var received string
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		received = req.FormValue("commandtimeout")
+		commandTimeout, err := time.ParseDuration(received)
+		if err != nil {
+			http.Error(w, "invalid commandtimeout", http.StatusBadRequest)
+			return
+		}
+		opts := &kubeletremote.Options{Stdin: true, Stdout: true, Stderr: true}
+		kubeletremote.ServeExec(w, req, execFunc(func(in io.Reader, out, errOut io.WriteCloser) error {
+			// sleep 60
+			select {
+			case <-time.After(time.Minute):
+				return nil
+			case <-time.After(commandTimeout):
+				return fmt.Errorf("%s %s", commandTimeoutMessage, commandTimeout)
+			}
+		}), "", "", "", []string{"debug"}, opts, time.Minute, 10*time.Second, remoteapi.SupportedStreamingProtocols)
+	}))
+	defer agent.Close()
+	var out, errOut bytes.Buffer
+	o, uri := newStreamOptions(t, agent, strings.NewReader(""), &out, &errOut)
+	o.CommandTimeout = timeout
+	params := url.Values{}
+	o.addTimeoutParams(params)
+	uri.RawQuery = params.Encode()
+
+	start := time.Now()
+	err := o.commandTimeoutErr(o.streamSession(uri, false, nil))
+	if received != timeout.String() {
+		t.Fatalf("the agent received the command timeout %q, want %q", received, timeout)
+	}
+	if time.Since(start) > 30*time.Second {
+		t.Fatalf("the session was not ended by the command timeout")
+	}
+	if _, ok := err.(*commandTimeoutError); !ok {
+		t.Fatalf("got %v, want a command timeout error", err)
+	}
+	if code := exitCode(err); code != commandTimeoutExitCode {
+		t.Errorf("got exit code %d, want %d", code, commandTimeoutExitCode)
+	}
+}
+
+func TestCommandTimeoutErrOnlyWithTimeout(t *testing.T) {
+	err := fmt.Errorf("%s 1s", commandTimeoutMessage)
+	o := &DebugOptions{}
+	if timeoutErr := o.commandTimeoutErr(err); timeoutErr != nil {
+		t.Errorf("got %v without --command-timeout, want nil", timeoutErr)
+	}
+	o.CommandTimeout = time.Second
+	if timeoutErr := o.commandTimeoutErr(fmt.Errorf("connection reset")); timeoutErr != nil {
+		t.Errorf("got %v for another error, want nil", timeoutErr)
+	}
+	if code := exitCode(fmt.Errorf("connection reset")); code != 1 {
+		t.Errorf("got exit code %d for another error, want 1", code)
+	}
+}
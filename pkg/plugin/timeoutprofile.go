@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/spf13/pflag"
+	"sort"
+	"strings"
+)
+
+// timeoutProfiles set the timeout flags for common scenarios, keyed by flag name,
+// timeout_profiles of the config file override or add to them
+var timeoutProfiles = map[string]map[string]string{
+	// a person at the terminal, who may step away but should not lose the session quickly
+	"interactive": {
+		"attach-timeout":     "1m",
+		"command-timeout":    "0",
+		"idle-timeout":       "30m",
+		"ready-wait":         "30s",
+		"keepalive-interval": "30s",
+		"api-retries":        "3",
+	},
+	// long running unattended commands, bounded in total rather than by idleness
+	"batch": {
+		"attach-timeout":     "2m",
+		"command-timeout":    "1h",
+		"idle-timeout":       "0",
+		"ready-wait":         "2m",
+		"keepalive-interval": "30s",
+		"api-retries":        "5",
+	},
+	// pipelines, which must fail fast instead of hanging a build
+	"ci": {
+		"attach-timeout":     "1m",
+		"command-timeout":    "15m",
+		"idle-timeout":       "5m",
+		"ready-wait":         "1m",
+		"keepalive-interval": "15s",
+		"api-retries":        "3",
+	},
+}
+
+// applyTimeoutProfile sets the flags of the named profile which are not set on
+// the command line or by the defaults of the config file
+func applyTimeoutProfile(flags *pflag.FlagSet, name string, overrides map[string]map[string]string) error {
+	profile := resolveTimeoutProfile(name, overrides)
+	if len(profile) < 1 {
+		return fmt.Errorf("unknown --timeout-profile %q, must be one of %s", name, strings.Join(timeoutProfileNames(overrides), ", "))
+	}
+	flagNames := make([]string, 0, len(profile))
+	for flag := range profile {
+		flagNames = append(flagNames, flag)
+	}
+	sort.Strings(flagNames)
+	for _, flagName := range flagNames {
+		flag := flags.Lookup(flagName)
+		if flag == nil {
+			return fmt.Errorf("unknown flag %q in timeout profile %s", flagName, name)
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := flags.Set(flagName, profile[flagName]); err != nil {
+			return fmt.Errorf("invalid value %q for flag %q in timeout profile %s: %v", profile[flagName], flagName, name, err)
+		}
+	}
+	return nil
+}
+
+// resolveTimeoutProfile returns the flags of the named profile, the built-in ones
+// overridden by those of the config file, empty if there is no such profile
+func resolveTimeoutProfile(name string, overrides map[string]map[string]string) map[string]string {
+	profile := map[string]string{}
+	for flag, value := range timeoutProfiles[name] {
+		profile[flag] = value
+	}
+	for flag, value := range overrides[name] {
+		profile[flag] = value
+	}
+	return profile
+}
+
+func timeoutProfileNames(overrides map[string]map[string]string) []string {
+	var names []string
+	for name := range timeoutProfiles {
+		names = append(names, name)
+	}
+	for name := range overrides {
+		if _, ok := timeoutProfiles[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// transcript writes a plain text log of the session output to a file. ANSI
+// escape sequences, unless preserved, and control characters are stripped,
+// backspaces are applied and lines are written once complete.
+type transcript struct {
+	file   *os.File
+	line   []byte
+	parser ansiParser
+	// preserveANSI keeps the escape sequences, e.g. colors for later rendering
+	preserveANSI bool
+	lock         sync.Mutex
+}
+
+func newTranscript(path string, preserveANSI bool) (*transcript, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &transcript{file: file, preserveANSI: preserveANSI}, nil
+}
+
+// Wrap returns a writer which writes to out and records to the transcript
+func (t *transcript) Wrap(out io.Writer) io.Writer {
+	if out == nil {
+		return nil
+	}
+	return writerFunc(func(p []byte) (int, error) {
+		n, err := out.Write(p)
+		t.record(p[:n])
+		return n, err
+	})
+}
+
+func (t *transcript) record(p []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, b := range p {
+		if t.parser.text(b) {
+			t.text(b)
+		} else if t.preserveANSI {
+			t.line = append(t.line, b)
+		}
+	}
+}
+
+func (t *transcript) text(b byte) {
+	switch {
+	case b == '\n':
+		t.line = append(t.line, '\n')
+		t.file.Write(t.line)
+		t.line = t.line[:0]
+	case b == '\b':
+		if len(t.line) > 0 {
+			_, size := utf8.DecodeLastRune(t.line)
+			t.line = t.line[:len(t.line)-size]
+		}
+	case b == '\t' || b >= 0x20 && b != 0x7f:
+		t.line = append(t.line, b)
+	}
+}
+
+// Close writes the incomplete last line and closes the file
+func (t *transcript) Close() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if len(bytes.TrimSpace(t.line)) > 0 {
+		t.file.Write(append(t.line, '\n'))
+	}
+	return t.file.Close()
+}
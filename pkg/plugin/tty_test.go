@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSetupTTYFallsBackWithoutTerminal(t *testing.T) {
+	var out, errOut bytes.Buffer
+	o := &DebugOptions{TTY: true, Stdin: true}
+	o.In, o.Out, o.ErrOut = strings.NewReader("piped"), &out, &errOut
+	if tty := o.setupTTY(); tty.Raw {
+		t.Fatalf("expected a session without tty for piped stdin")
+	}
+	if !strings.Contains(errOut.String(), "Unable to use a TTY") {
+		t.Errorf("expected a notice about the missing tty, got %q", errOut.String())
+	}
+}
+
+func TestBinaryStreamWithoutTTY(t *testing.T) {
+	// every byte value, line endings and control characters a tty would translate
+	blob := []byte("\r\n\n\r\x03\x04\x1a\x1b[0m")
+	for i := 0; i < 256; i++ {
+		blob = append(blob, byte(i))
+	}
+	random := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	blob = append(blob, random...)
+
+	agent := newFakeAgent(func(in io.Reader, out, errOut io.WriteCloser) error {
+		_, err := io.Copy(out, in)
+		return err
+	})
+	defer agent.Close()
+	var out, errOut bytes.Buffer
+	o, uri := newStreamOptions(t, agent, bytes.NewReader(blob), &out, &errOut)
+	if err := o.streamSession(uri, false, nil); err != nil {
+		t.Fatalf("error streaming: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), blob) {
+		t.Fatalf("stream altered the data: sent %d bytes, received %d bytes", len(blob), out.Len())
+	}
+	if errOut.Len() > 0 {
+		t.Errorf("unexpected stderr %q", errOut.String())
+	}
+}
@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	pluginversion "github.com/aylei/kubectl-debug/pkg/version"
+	"k8s.io/apimachinery/pkg/util/version"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultUpdateURL is the latest release of the plugin, overridden by update_url of the config
+	defaultUpdateURL   = "https://api.github.com/repos/aylei/kubectl-debug/releases/latest"
+	updateCheckTimeout = 5 * time.Second
+)
+
+// checkUpdate queries the release url in the background if --check-update is set,
+// the returned channel yields the latest version if it is newer than the plugin
+func (o *DebugOptions) checkUpdate() <-chan string {
+	if !o.CheckUpdate {
+		return nil
+	}
+	releaseURL := o.UpdateURL
+	if len(releaseURL) < 1 {
+		releaseURL = defaultUpdateURL
+	}
+	latest := make(chan string, 1)
+	go func() {
+		defer close(latest)
+		release, err := getLatestRelease(releaseURL)
+		if err != nil {
+			return
+		}
+		current, err := version.ParseGeneric(pluginversion.Version)
+		if err != nil {
+			return
+		}
+		if v, err := version.ParseGeneric(release); err == nil && current.LessThan(v) {
+			latest <- release
+		}
+	}()
+	return latest
+}
+
+// notifyUpdate prints a notice if the update check found a newer version,
+// it never waits for a check which has not finished yet
+func (o *DebugOptions) notifyUpdate(latest <-chan string) {
+	select {
+	case release, ok := <-latest:
+		if ok {
+			fmt.Fprintf(o.messageOut(), "kubectl-debug %s is available, you are running %s\n", release, pluginversion.Version)
+		}
+	default:
+	}
+}
+
+// getLatestRelease reads the latest version from the release url, which responds with
+// a json object holding either tag_name, like the github releases api, or version
+func getLatestRelease(releaseURL string) (string, error) {
+	client := &http.Client{Timeout: updateCheckTimeout}
+	resp, err := client.Get(releaseURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("release url responded with status %s", resp.Status)
+	}
+	var body struct {
+		TagName string `json:"tag_name"`
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if len(body.TagName) > 0 {
+		return body.TagName, nil
+	}
+	return body.Version, nil
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/util/version"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const agentVersionTimeout = 10 * time.Second
+
+// checkAgentVersion fails if the version of the agent is out of the bounds
+// configured by min_agent_version and max_agent_version
+func (o *DebugOptions) checkAgentVersion(agentURL *url.URL, nodeName string) error {
+	if len(o.MinAgentVersion) < 1 && len(o.MaxAgentVersion) < 1 {
+		return nil
+	}
+	client, err := o.agentHTTPClient(agentVersionTimeout)
+	if err != nil {
+		return err
+	}
+	info, err := getAgentInfo(client, agentURL)
+	if err != nil {
+		return fmt.Errorf("cannot check the version of the agent on node %s: %v", nodeName, err)
+	}
+	agentVersion := info.Version
+	current, err := version.ParseGeneric(agentVersion)
+	if err != nil {
+		return fmt.Errorf("agent on node %s reported an invalid version %q: %v", nodeName, agentVersion, err)
+	}
+	if len(o.MinAgentVersion) > 0 && current.LessThan(version.MustParseGeneric(o.MinAgentVersion)) {
+		return fmt.Errorf("agent on node %s is version %s, older than min_agent_version %s of the debug config, "+
+			"upgrade the debug-agent DaemonSet or wait for its rollout to finish", nodeName, agentVersion, o.MinAgentVersion)
+	}
+	if len(o.MaxAgentVersion) > 0 && version.MustParseGeneric(o.MaxAgentVersion).LessThan(current) {
+		return fmt.Errorf("agent on node %s is version %s, newer than max_agent_version %s of the debug config, "+
+			"upgrade kubectl-debug and the debug config", nodeName, agentVersion, o.MaxAgentVersion)
+	}
+	return nil
+}
+
+// agentInfo is reported by the version api of the agent
+type agentInfo struct {
+	Version string `json:"version"`
+	// Features are the optional capabilities of the agent, absent in older agents
+	Features []string `json:"features,omitempty"`
+}
+
+func (i *agentInfo) hasFeature(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// agentFeatures asks the agent of a session for its features at most once and only if needed
+type agentFeatures struct {
+	client   *http.Client
+	agentURL *url.URL
+	info     *agentInfo
+	err      error
+}
+
+func (f *agentFeatures) has(feature string) (bool, error) {
+	if f.info == nil && f.err == nil {
+		f.info, f.err = getAgentInfo(f.client, f.agentURL)
+	}
+	if f.err != nil {
+		return false, f.err
+	}
+	return f.info.hasFeature(feature), nil
+}
+
+// version returns the version of the agent once has succeeded
+func (f *agentFeatures) version() string {
+	if f.info == nil {
+		return ""
+	}
+	return f.info.Version
+}
+
+// getAgentInfo queries the version of the agent with the client of agentHTTPClient,
+// agents predating the version api are reported as such
+func getAgentInfo(client *http.Client, agentURL *url.URL) (*agentInfo, error) {
+	resp, err := client.Get(agentAPI(agentURL, "/api/v1/version", nil).String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("the agent is too old to report its version")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("agent responded with status %s", resp.Status)
+	}
+	info := &agentInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, fmt.Errorf("cannot decode the version from agent: %v", err)
+	}
+	return info, nil
+}
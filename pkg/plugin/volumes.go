@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"strings"
+)
+
+// volumeParams returns the volumes of --mount-volume as NAME:PATH, where PATH is
+// the mount path of the volume in the target container, at which the agent mounts
+// it in the debug container as well
+func (o *DebugOptions) volumeParams(pod *corev1.Pod, containerName string) ([]string, error) {
+	if len(o.MountVolumes) < 1 {
+		return nil, nil
+	}
+	var mounts []corev1.VolumeMount
+	for _, container := range pod.Spec.Containers {
+		if container.Name == containerName {
+			mounts = container.VolumeMounts
+		}
+	}
+	var params []string
+	for _, name := range o.MountVolumes {
+		found := false
+		for _, mount := range mounts {
+			// a volume mounted several times, e.g. with sub paths, is taken at its first mount
+			if mount.Name == name {
+				params = append(params, name+":"+mount.MountPath)
+				found = true
+				break
+			}
+		}
+		if !found {
+			var names []string
+			for _, mount := range mounts {
+				names = append(names, mount.Name)
+			}
+			return nil, fmt.Errorf("volume %s is not mounted in container %s, its volumes are: %s", name, containerName, strings.Join(names, ", "))
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"time"
+)
+
+const (
+	defaultWatchTimeout = 5 * time.Minute
+	watchPollInterval   = 2 * time.Second
+)
+
+// revisionLabels differ between the revisions of a workload and are ignored
+// when looking for the replacement of a pod
+var revisionLabels = []string{"pod-template-hash", "controller-revision-hash"}
+
+// RunWatch runs the debug session and, with --watch, runs it again in the
+// replacement of the pod whenever the pod is gone after the session, e.g.
+// deleted or recreated by its controller
+func (o *DebugOptions) RunWatch() error {
+	// the audit records are sent in the background, but not given up on exit
+	defer o.audits.Wait()
+	for {
+		err := o.Run()
+		o.endSession(err)
+		if !o.Watch || o.targetPod == nil {
+			return err
+		}
+		gone, goneErr := o.podGone(o.targetPod)
+		if goneErr != nil || !gone {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(o.messageOut(), "session in pod %s ended: %v\n", o.targetPod.Name, o.redact(err.Error()))
+		}
+		fmt.Fprintf(o.messageOut(), "pod %s is gone, waiting up to %s for its replacement\n", o.targetPod.Name, o.WatchTimeout)
+		name, err := o.waitReplacementPod(o.targetPod)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(o.messageOut(), "reattaching to pod %s\n", name)
+		o.PodName = name
+	}
+}
+
+// podGone returns true if the pod is deleted, terminating or recreated with the same name
+func (o *DebugOptions) podGone(pod *corev1.Pod) (bool, error) {
+	current, err := o.PodClient.Pods(pod.Namespace).Get(pod.Name, v1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return current.UID != pod.UID || current.DeletionTimestamp != nil, nil
+}
+
+// waitReplacementPod waits up to --watch-timeout for a running pod of the same
+// controller as the gone pod, or recreated with the same name if it has none
+func (o *DebugOptions) waitReplacementPod(gone *corev1.Pod) (string, error) {
+	selector := labels.Set{}
+	for key, value := range gone.Labels {
+		selector[key] = value
+	}
+	for _, key := range revisionLabels {
+		delete(selector, key)
+	}
+	controller := v1.GetControllerOf(gone)
+
+	var replacement string
+	err := wait.PollImmediate(watchPollInterval, o.WatchTimeout, func() (bool, error) {
+		pods, err := o.PodClient.Pods(gone.Namespace).List(v1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return false, err
+		}
+		var latest *corev1.Pod
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if pod.UID == gone.UID || pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+				continue
+			}
+			if controller != nil {
+				if owner := v1.GetControllerOf(pod); owner == nil || owner.UID != controller.UID {
+					continue
+				}
+			} else if pod.Name != gone.Name {
+				continue
+			}
+			if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+				latest = pod
+			}
+		}
+		if latest == nil {
+			return false, nil
+		}
+		replacement = latest.Name
+		return true, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return "", fmt.Errorf("no replacement of pod %s is running after waiting %s", gone.Name, o.WatchTimeout)
+	}
+	return replacement, err
+}
@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	osLabel     = "kubernetes.io/os"
+	betaOSLabel = "beta.kubernetes.io/os"
+	osWindows   = "windows"
+
+	// windowsCommand replaces the default bash on windows nodes
+	windowsCommand = "cmd.exe"
+)
+
+// nodeOS returns the operating system of the node of the pod, taken from the node selector
+// of the pod or the labels of the node, or empty if it cannot be determined
+func (o *DebugOptions) nodeOS(pod *corev1.Pod) string {
+	for _, label := range []string{osLabel, betaOSLabel} {
+		if os, ok := pod.Spec.NodeSelector[label]; ok {
+			return os
+		}
+	}
+	if len(pod.Spec.NodeName) < 1 {
+		return ""
+	}
+	node, err := o.NodeClient.Nodes().Get(pod.Spec.NodeName, v1.GetOptions{})
+	if err != nil {
+		return ""
+	}
+	for _, label := range []string{osLabel, betaOSLabel} {
+		if os, ok := node.Labels[label]; ok {
+			return os
+		}
+	}
+	return ""
+}
+
+// completeWindows adapts the session to a windows node, whose agent runs the command as
+// a host process with the tools of the node, as windows containers cannot share their
+// namespaces with a debug container
+func (o *DebugOptions) completeWindows(pod *corev1.Pod) error {
+	nodeName := pod.Spec.NodeName
+	if !o.NoJoin || len(o.ContainerID) > 0 {
+		return fmt.Errorf("pod %s runs on the windows node %s, whose containers cannot share their namespaces with a debug container, "+
+			"debug the node with --no-join or node/%s instead", pod.Name, nodeName, nodeName)
+	}
+	if o.Agentless {
+		return fmt.Errorf("--agentless is not supported on the windows node %s, run the windows agent as a HostProcess DaemonSet instead", nodeName)
+	}
+	if o.commandDefaulted {
+		o.Command = []string{windowsCommand}
+	}
+	fmt.Fprintf(o.messageOut(), "node %s runs windows, the command runs as a host process with the tools of the node, the image is not used\n", nodeName)
+	if o.TTY {
+		// there is no pty on windows, the terminal stays in line mode instead
+		o.TTY = false
+		fmt.Fprintf(o.messageOut(), "node %s runs windows, the session runs without a tty\n", nodeName)
+	}
+	return nil
+}
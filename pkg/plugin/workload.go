@@ -0,0 +1,243 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/aylei/kubectl-debug/pkg/util"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sort"
+	"strings"
+	"time"
+)
+
+// completeNamespace takes the namespace from a POD argument in the form of
+// NAMESPACE/POD or NAMESPACE/KIND/NAME and returns the rest of the argument.
+// KIND/NAME takes precedence over a namespace named like a supported kind.
+func (o *DebugOptions) completeNamespace(arg string) (string, error) {
+	parts := strings.SplitN(arg, "/", 3)
+	if len(parts) < 2 || (len(parts) == 2 && len(workloadKind(parts[0])) > 0) {
+		return arg, nil
+	}
+	namespace := parts[0]
+	if len(namespace) < 1 {
+		return "", fmt.Errorf("invalid argument %q, namespace must be specified", arg)
+	}
+	if o.Flags.Namespace != nil && len(*o.Flags.Namespace) > 0 && *o.Flags.Namespace != namespace {
+		return "", fmt.Errorf("namespace %s of argument %q conflicts with --namespace %s", namespace, arg, *o.Flags.Namespace)
+	}
+	o.Namespace = namespace
+	return strings.Join(parts[1:], "/"), nil
+}
+
+// resolvePodName resolves the POD argument, which is either a bare pod name
+// or KIND/NAME of a workload whose most recent running pod is picked. Pods are
+// only listed for the workload forms, so a bare pod name works with nothing
+// more than get permission on that pod.
+func (o *DebugOptions) resolvePodName(arg string) (string, error) {
+	parts := strings.SplitN(arg, "/", 2)
+	if len(parts) < 2 {
+		return arg, nil
+	}
+	name := parts[1]
+	if len(name) < 1 {
+		return "", fmt.Errorf("invalid argument %q, name must be specified", arg)
+	}
+	switch workloadKind(parts[0]) {
+	case "pod":
+		return name, nil
+	case "job":
+		return o.podOfJob(name)
+	case "cronjob":
+		return o.podOfCronJob(name)
+	case "deployment", "statefulset", "daemonset", "replicaset":
+		return o.podOfWorkload(workloadKind(parts[0]), name)
+	case "node":
+		return "", fmt.Errorf("invalid argument %q, nodes are not namespaced, use node/%s", arg, name)
+	default:
+		return "", fmt.Errorf("unsupported resource kind %q, must be one of pod, deployment, statefulset, daemonset, replicaset, job, cronjob, node", parts[0])
+	}
+}
+
+// nodeArg returns NAME of a node/NAME argument, which targets a node instead of a pod
+func nodeArg(arg string) (string, bool) {
+	parts := strings.SplitN(arg, "/", 2)
+	if len(parts) < 2 || workloadKind(parts[0]) != "node" {
+		return "", false
+	}
+	return parts[1], true
+}
+
+// nodePod returns a placeholder for the target pod when debugging a node given
+// as node/NAME, it only carries the node name and address the session needs
+func (o *DebugOptions) nodePod() (*corev1.Pod, error) {
+	node, err := o.NodeClient.Nodes().Get(o.NodeName, v1.GetOptions{})
+	if err != nil {
+		return nil, explainForbidden(err, "get", "node", o.NodeName, "")
+	}
+	address, err := nodeAddress(node)
+	if err != nil {
+		return nil, err
+	}
+	return &corev1.Pod{
+		Spec:   corev1.PodSpec{NodeName: node.Name},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning, HostIP: address},
+	}, nil
+}
+
+// workloadKind returns the canonical name of a supported resource kind or
+// one of its aliases, or empty if the kind is not supported
+func workloadKind(kind string) string {
+	switch strings.ToLower(kind) {
+	case "pod", "pods", "po":
+		return "pod"
+	case "job", "jobs":
+		return "job"
+	case "cronjob", "cronjobs", "cj":
+		return "cronjob"
+	case "deployment", "deployments", "deploy":
+		return "deployment"
+	case "statefulset", "statefulsets", "sts":
+		return "statefulset"
+	case "daemonset", "daemonsets", "ds":
+		return "daemonset"
+	case "replicaset", "replicasets", "rs":
+		return "replicaset"
+	case "node", "nodes", "no":
+		return "node"
+	default:
+		return ""
+	}
+}
+
+func (o *DebugOptions) podOfJob(name string) (string, error) {
+	job, err := o.KubeCli.BatchV1().Jobs(o.Namespace).Get(name, v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if jobFinished(job) {
+		return "", fmt.Errorf("job %s has completed, there is no running pod to debug", name)
+	}
+	selector, err := v1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return "", err
+	}
+	return o.latestRunningPod(selector.String(), "job/"+name)
+}
+
+func (o *DebugOptions) podOfCronJob(name string) (string, error) {
+	cronJob, err := o.KubeCli.BatchV1beta1().CronJobs(o.Namespace).Get(name, v1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if len(cronJob.Status.Active) < 1 {
+		return "", fmt.Errorf("cronjob %s has no active job", name)
+	}
+	var latest *batchv1.Job
+	for _, ref := range cronJob.Status.Active {
+		job, err := o.KubeCli.BatchV1().Jobs(o.Namespace).Get(ref.Name, v1.GetOptions{})
+		if err != nil || jobFinished(job) {
+			continue
+		}
+		if latest == nil || latest.CreationTimestamp.Before(&job.CreationTimestamp) {
+			latest = job
+		}
+	}
+	if latest == nil {
+		return "", fmt.Errorf("cronjob %s has no active job", name)
+	}
+	return o.podOfJob(latest.Name)
+}
+
+// podOfWorkload picks a running pod of the deployment, statefulset, daemonset or replicaset
+func (o *DebugOptions) podOfWorkload(kind string, name string) (string, error) {
+	apps := o.KubeCli.AppsV1()
+	var selector *v1.LabelSelector
+	switch kind {
+	case "deployment":
+		deployment, err := apps.Deployments(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = deployment.Spec.Selector
+	case "statefulset":
+		statefulSet, err := apps.StatefulSets(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = statefulSet.Spec.Selector
+	case "daemonset":
+		daemonSet, err := apps.DaemonSets(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = daemonSet.Spec.Selector
+	case "replicaset":
+		replicaSet, err := apps.ReplicaSets(o.Namespace).Get(name, v1.GetOptions{})
+		if err != nil {
+			return "", err
+		}
+		selector = replicaSet.Spec.Selector
+	}
+	labelSelector, err := v1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return "", err
+	}
+	return o.latestRunningPod(labelSelector.String(), kind+"/"+name)
+}
+
+// latestRunningPod returns the most recently created running pod matching the selector
+func (o *DebugOptions) latestRunningPod(selector string, owner string) (string, error) {
+	pods, err := o.PodClient.Pods(o.Namespace).List(v1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		if errors.IsForbidden(err) {
+			return "", fmt.Errorf("cannot list the pods of %s, pass the pod name instead if you are only allowed to get pods: %v", owner, err)
+		}
+		return "", err
+	}
+	var running []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.Status.Phase == corev1.PodRunning && pod.DeletionTimestamp == nil {
+			running = append(running, pod)
+		}
+	}
+	if len(running) < 1 {
+		return "", fmt.Errorf("%s has no running pod", owner)
+	}
+	sort.Slice(running, func(i, j int) bool {
+		return running[j].CreationTimestamp.Before(&running[i].CreationTimestamp)
+	})
+	if o.PickPod && len(running) > 1 {
+		return o.pickPod(running, owner)
+	}
+	return running[0].Name, nil
+}
+
+// pickPod prompts for one of the running pods of the workload, newest first
+func (o *DebugOptions) pickPod(pods []corev1.Pod, owner string) (string, error) {
+	if !(term.TTY{In: o.In}).IsTerminalIn() {
+		return "", fmt.Errorf("--pick-pod requires a terminal to prompt for the pod of %s", owner)
+	}
+	fmt.Fprintf(o.ErrOut, "%s has %d running pods, newest first:\n", owner, len(pods))
+	items := make([]string, len(pods))
+	for i, pod := range pods {
+		items[i] = fmt.Sprintf("%s\t%s\t%s", pod.Name, pod.Spec.NodeName, duration.HumanDuration(time.Since(pod.CreationTimestamp.Time)))
+	}
+	i, err := o.promptChoice("pod", items, 0)
+	if err != nil {
+		return "", err
+	}
+	return pods[i].Name, nil
+}
+
+func jobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// TestResolvePodNameListDenied runs the resolution of a service account which may
+// get pods but not list them
+func TestResolvePodNameListDenied(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    string
+		wantErr string
+	}{
+		{arg: "mypod", want: "mypod"},
+		{arg: "pod/mypod", want: "mypod"},
+		{arg: "po/mypod", want: "mypod"},
+		{arg: "job/web", wantErr: "pass the pod name instead"},
+		{arg: "deployment/web", wantErr: "pass the pod name instead"},
+	}
+	for _, test := range tests {
+		selector := &v1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+		clientset := fake.NewSimpleClientset(&batchv1.Job{
+			ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       batchv1.JobSpec{Selector: selector},
+		}, &appsv1.Deployment{
+			ObjectMeta: v1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Selector: selector},
+		})
+		clientset.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.NewForbidden(schema.GroupResource{Resource: "pods"}, "", nil)
+		})
+		o := &DebugOptions{Namespace: "default", KubeCli: clientset, PodClient: clientset.CoreV1()}
+
+		got, err := o.resolvePodName(test.arg)
+		if len(test.wantErr) > 0 {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: got error %v, want %q", test.arg, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.arg, got, err, test.want)
+		}
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "list" {
+				t.Errorf("%s: pods were listed for a pod name", test.arg)
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package term
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// AuditHashHeader carries the hash of a chained audit record posted to the webhook,
+	// which thereby holds the end of the chain
+	AuditHashHeader = "X-Audit-Hash"
+
+	auditWebhookTimeout = 5 * time.Second
+)
+
+// AppendAuditFile appends the audit record as a json line and syncs it, the file is
+// only readable by its owner
+func AppendAuditFile(filename string, record []byte) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(record, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	// the record must survive a crash of the node, which may be what is being debugged
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// PostAuditWebhook posts the json audit record to the webhook, with its hash in
+// AuditHashHeader unless the hash is empty
+func PostAuditWebhook(webhook string, record []byte, hash string) error {
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(record))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(hash) > 0 {
+		req.Header.Set(AuditHashHeader, hash)
+	}
+	client := &http.Client{Timeout: auditWebhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook responded with status %s", resp.Status)
+	}
+	return nil
+}
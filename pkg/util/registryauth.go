@@ -0,0 +1,94 @@
+package term
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"strings"
+)
+
+// RegistryAuthHeader carries the credentials of the registry of the debug image
+// from the plugin to the agent, encoded like the X-Registry-Auth header of docker
+const RegistryAuthHeader = "X-Registry-Auth"
+
+// dockerConfig is the content of a docker config.json, or of a secret of type
+// kubernetes.io/dockerconfigjson, the legacy .dockercfg is the auths map alone
+type dockerConfig struct {
+	Auths map[string]types.AuthConfig `json:"auths"`
+}
+
+// RegistryAuth returns the credentials for the registry of the image found in the
+// docker config, or nil if there are none
+func RegistryAuth(config []byte, image string) (*types.AuthConfig, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image %q: %v", image, err)
+	}
+	auths := dockerConfig{}
+	if err := json.Unmarshal(config, &auths); err != nil {
+		return nil, fmt.Errorf("invalid docker config: %v", err)
+	}
+	if auths.Auths == nil {
+		// .dockercfg
+		if err := json.Unmarshal(config, &auths.Auths); err != nil {
+			return nil, fmt.Errorf("invalid docker config: %v", err)
+		}
+	}
+	domain := reference.Domain(named)
+	for server, auth := range auths.Auths {
+		if normalizeRegistry(server) != domain {
+			continue
+		}
+		if len(auth.Username) < 1 && len(auth.Auth) > 0 {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of registry %s: %v", server, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) < 2 {
+				return nil, fmt.Errorf("invalid auth of registry %s, must be username:password", server)
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+		auth.Auth = ""
+		auth.ServerAddress = domain
+		return &auth, nil
+	}
+	return nil, nil
+}
+
+// normalizeRegistry returns the domain of a registry key of a docker config,
+// e.g. docker.io for https://index.docker.io/v1/
+func normalizeRegistry(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	server = strings.SplitN(server, "/", 2)[0]
+	switch server {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+	return server
+}
+
+// EncodeRegistryAuth encodes the credentials for the RegistryAuthHeader
+func EncodeRegistryAuth(auth *types.AuthConfig) (string, error) {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
+
+// DecodeRegistryAuth decodes the credentials of the RegistryAuthHeader
+func DecodeRegistryAuth(header string) (*types.AuthConfig, error) {
+	data, err := base64.URLEncoding.DecodeString(header)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry auth: %v", err)
+	}
+	auth := &types.AuthConfig{}
+	if err := json.Unmarshal(data, auth); err != nil {
+		return nil, fmt.Errorf("invalid registry auth: %v", err)
+	}
+	return auth, nil
+}
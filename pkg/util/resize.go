@@ -25,6 +25,10 @@ import (
 	"k8s.io/client-go/tools/remotecommand"
 )
 
+// maxSizeFailures is the number of consecutive failures to get the terminal size after which
+// resize monitoring gives up
+const maxSizeFailures = 3
+
 // GetSize returns the current size of the user's terminal. If it isn't a terminal,
 // nil is returned.
 func (t TTY) GetSize() *remotecommand.TerminalSize {
@@ -62,7 +66,7 @@ func (t *TTY) MonitorSize(initialSizes ...*remotecommand.TerminalSize) remotecom
 		stopResizing: make(chan struct{}),
 	}
 
-	t.sizeQueue.monitorSize(outFd, initialSizes...)
+	t.sizeQueue.monitorSize(func() *remotecommand.TerminalSize { return GetSize(outFd) }, initialSizes...)
 
 	return t.sizeQueue
 }
@@ -79,8 +83,8 @@ type sizeQueue struct {
 var _ remotecommand.TerminalSizeQueue = &sizeQueue{}
 
 // monitorSize primes resizeChan with initialSizes and then monitors for resize events. With each
-// new event, it sends the current terminal size to resizeChan.
-func (s *sizeQueue) monitorSize(outFd uintptr, initialSizes ...*remotecommand.TerminalSize) {
+// new event, it sends the current terminal size, as returned by getSize, to resizeChan.
+func (s *sizeQueue) monitorSize(getSize func() *remotecommand.TerminalSize, initialSizes ...*remotecommand.TerminalSize) {
 	// send the initial sizes
 	for i := range initialSizes {
 		if initialSizes[i] != nil {
@@ -90,16 +94,29 @@ func (s *sizeQueue) monitorSize(outFd uintptr, initialSizes ...*remotecommand.Te
 
 	resizeEvents := make(chan remotecommand.TerminalSize, 1)
 
-	monitorResizeEvents(outFd, resizeEvents, s.stopResizing)
+	monitorResizeEvents(getSize, resizeEvents, s.stopResizing)
 
 	// listen for resize events in the background
 	go func() {
-		defer runtime.HandleCrash()
+		defer recoverResizeMonitor()
 
 		for {
 			select {
 			case size, ok := <-resizeEvents:
 				if !ok {
+					// monitoring gave up on a misbehaving terminal, settle on a fixed size
+					// unless it was stopped on purpose
+					select {
+					case <-s.stopResizing:
+						return
+					default:
+					}
+					if s.t.FallbackSize != nil {
+						select {
+						case s.resizeChan <- *s.t.FallbackSize:
+						default:
+						}
+					}
 					return
 				}
 
@@ -117,6 +134,14 @@ func (s *sizeQueue) monitorSize(outFd uintptr, initialSizes ...*remotecommand.Te
 	}()
 }
 
+// recoverResizeMonitor recovers a panic of the resize monitoring, so that a misbehaving
+// terminal does not take down the session
+func recoverResizeMonitor() {
+	if r := recover(); r != nil {
+		runtime.HandleError(fmt.Errorf("terminal resize monitoring stopped: %v", r))
+	}
+}
+
 // Next returns the new terminal size after the terminal has been resized. It returns nil when
 // monitoring has been stopped.
 func (s *sizeQueue) Next() *remotecommand.TerminalSize {
@@ -0,0 +1,59 @@
+// +build !windows
+
+package term
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// TestMonitorSizeFailingSource checks that a terminal whose size cannot be got, or whose
+// size source panics, ends up with the fallback size instead of taking down the session
+func TestMonitorSizeFailingSource(t *testing.T) {
+	sources := map[string]func() *remotecommand.TerminalSize{
+		"no size": func() *remotecommand.TerminalSize { return nil },
+		"zero size": func() *remotecommand.TerminalSize {
+			return &remotecommand.TerminalSize{}
+		},
+		"panic": func() *remotecommand.TerminalSize { panic("bad terminal") },
+	}
+	for name, getSize := range sources {
+		fallback := remotecommand.TerminalSize{Width: 80, Height: 24}
+		initial := &remotecommand.TerminalSize{Width: 100, Height: 40}
+		s := &sizeQueue{
+			t:            TTY{FallbackSize: &fallback},
+			resizeChan:   make(chan remotecommand.TerminalSize, 1),
+			stopResizing: make(chan struct{}),
+		}
+		s.monitorSize(getSize, initial)
+		if size := s.Next(); size == nil || *size != *initial {
+			t.Fatalf("%s: got initial size %v, want %v", name, size, initial)
+		}
+
+		sizes := make(chan *remotecommand.TerminalSize, 1)
+		go func() {
+			sizes <- s.Next()
+		}()
+		deadline := time.After(5 * time.Second)
+	resize:
+		for {
+			// resize until the monitoring gives up
+			unix.Kill(os.Getpid(), unix.SIGWINCH)
+			select {
+			case size := <-sizes:
+				if size == nil || *size != fallback {
+					t.Errorf("%s: got size %v, want the fallback %v", name, size, fallback)
+				}
+				break resize
+			case <-deadline:
+				t.Fatalf("%s: the fallback size was not sent", name)
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+		s.stop()
+	}
+}
@@ -19,6 +19,7 @@ limitations under the License.
 package term
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 
@@ -28,23 +29,32 @@ import (
 )
 
 // monitorResizeEvents spawns a goroutine that waits for SIGWINCH signals (these indicate the
-// terminal has resized). After receiving a SIGWINCH, this gets the terminal size and tries to send
-// it to the resizeEvents channel. The goroutine stops when the stop channel is closed.
-func monitorResizeEvents(fd uintptr, resizeEvents chan<- remotecommand.TerminalSize, stop chan struct{}) {
+// terminal has resized). After receiving a SIGWINCH, this gets the terminal size with getSize and tries to send
+// it to the resizeEvents channel. The goroutine stops when the stop channel is closed, or closes
+// the resizeEvents channel if the terminal size cannot be got repeatedly.
+func monitorResizeEvents(getSize func() *remotecommand.TerminalSize, resizeEvents chan<- remotecommand.TerminalSize, stop chan struct{}) {
 	go func() {
-		defer runtime.HandleCrash()
+		defer close(resizeEvents)
+		defer recoverResizeMonitor()
 
 		winch := make(chan os.Signal, 1)
 		signal.Notify(winch, unix.SIGWINCH)
 		defer signal.Stop(winch)
 
+		failures := 0
 		for {
 			select {
 			case <-winch:
-				size := GetSize(fd)
-				if size == nil {
-					return
+				size := getSize()
+				if size == nil || size.Width < 1 || size.Height < 1 {
+					failures++
+					if failures >= maxSizeFailures {
+						runtime.HandleError(fmt.Errorf("unable to get terminal size %d times, stop monitoring resize", failures))
+						return
+					}
+					continue
 				}
+				failures = 0
 
 				// try to send size
 				select {
@@ -17,25 +17,28 @@ limitations under the License.
 package term
 
 import (
+	"fmt"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/remotecommand"
 )
 
-// monitorResizeEvents spawns a goroutine that periodically gets the terminal size and tries to send
+// monitorResizeEvents spawns a goroutine that periodically gets the terminal size with getSize and tries to send
 // it to the resizeEvents channel if the size has changed. The goroutine stops when the stop channel
-// is closed.
-func monitorResizeEvents(fd uintptr, resizeEvents chan<- remotecommand.TerminalSize, stop chan struct{}) {
+// is closed, or closes the resizeEvents channel if the terminal size cannot be got repeatedly.
+func monitorResizeEvents(getSize func() *remotecommand.TerminalSize, resizeEvents chan<- remotecommand.TerminalSize, stop chan struct{}) {
 	go func() {
-		defer runtime.HandleCrash()
+		defer close(resizeEvents)
+		defer recoverResizeMonitor()
 
-		size := GetSize(fd)
+		size := getSize()
 		if size == nil {
 			return
 		}
 		lastSize := *size
 
+		failures := 0
 		for {
 			// see if we need to stop running
 			select {
@@ -44,10 +47,17 @@ func monitorResizeEvents(fd uintptr, resizeEvents chan<- remotecommand.TerminalS
 			default:
 			}
 
-			size := GetSize(fd)
-			if size == nil {
-				return
+			size := getSize()
+			if size == nil || size.Width < 1 || size.Height < 1 {
+				failures++
+				if failures >= maxSizeFailures {
+					runtime.HandleError(fmt.Errorf("unable to get terminal size %d times, stop monitoring resize", failures))
+					return
+				}
+				time.Sleep(250 * time.Millisecond)
+				continue
 			}
+			failures = 0
 
 			if size.Height != lastSize.Height || size.Width != lastSize.Width {
 				lastSize.Height = size.Height
@@ -23,6 +23,7 @@ import (
 
 	"github.com/docker/docker/pkg/term"
 
+	"k8s.io/client-go/tools/remotecommand"
 	"k8s.io/kubernetes/pkg/util/interrupt"
 )
 
@@ -47,6 +48,9 @@ type TTY struct {
 	// it will be invoked after the terminal state is restored. If it is not provided,
 	// a signal received during the TTY will result in os.Exit(0) being invoked.
 	Parent *interrupt.Handler
+	// FallbackSize is an optional size sent once if monitoring the terminal size fails
+	// repeatedly.
+	FallbackSize *remotecommand.TerminalSize
 
 	// sizeQueue is set after a call to MonitorSize() and is used to monitor SIGWINCH signals when the
 	// user's terminal resizes.
@@ -0,0 +1,5 @@
+package version
+
+// Version of kubectl-debug, overridden at build time by
+// -ldflags "-X github.com/aylei/kubectl-debug/pkg/version.Version=x.y.z"
+var Version = "0.0.1"